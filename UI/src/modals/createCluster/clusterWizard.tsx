@@ -63,7 +63,7 @@ const ClusterWizard: FC<Props> = ({ handleClose }) => {
   const providerOptions = [{ value: provider, label: 'aws' }]
 
   const handleAction = () => {
-    const getWorkers = workers.map(elm => ({ machineType: elm.machineType, replicas: elm.replicas, infraNode: elm.infraNode }))
+    const getWorkers = workers.map((elm, i) => ({ name: `${i}`, machineType: elm.machineType, replicas: elm.replicas, infraNode: elm.infraNode }))
 
     const cluster = {
       "name": clusterName,
@@ -18,13 +18,17 @@ package v1alpha1
 
 import (
 	"fmt"
+	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/getupio-undistro/undistro/pkg/meta"
 	"github.com/pkg/errors"
 	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
 	capi "sigs.k8s.io/cluster-api/api/v1alpha3"
 )
 
@@ -71,6 +75,20 @@ type ControlPlaneNode struct {
 	Node       `json:",inline,omitempty"`
 	Endpoint   capi.APIEndpoint `json:"endpoint,omitempty"`
 	InternalLB bool             `json:"internalLB,omitempty"`
+	// HealthCheck overrides the default health check of the control plane machines
+	HealthCheck *HealthCheckPolicy `json:"healthCheck,omitempty"`
+}
+
+// HealthCheckPolicy configures when the machines are considered unhealthy and replaced
+type HealthCheckPolicy struct {
+	// UnhealthyConditions make a node unhealthy when any of them lasts its timeout.
+	// Defaults to the Ready condition being False or Unknown for 5 minutes.
+	UnhealthyConditions []capi.UnhealthyCondition `json:"unhealthyConditions,omitempty"`
+	// MaxUnhealthy stops the replacement when more machines are unhealthy. Defaults to 100%.
+	MaxUnhealthy *intstr.IntOrString `json:"maxUnhealthy,omitempty"`
+	// NodeStartupTimeout is how long a machine can take to join the cluster. Defaults to 10 minutes.
+	// Machine pools are checked by their nodes, so it doesn't apply to them.
+	NodeStartupTimeout *metav1.Duration `json:"nodeStartupTimeout,omitempty"`
 }
 
 type LaunchTemplateReference struct {
@@ -81,11 +99,52 @@ type LaunchTemplateReference struct {
 	Version string `json:"version,omitempty"`
 }
 
+// Volume is a disk of the machines in a worker pool
+type Volume struct {
+	// Size of the volume in GiB
+	Size int64 `json:"size"`
+	// Type of the volume, like gp2, gp3 or io1 on AWS
+	Type string `json:"type,omitempty"`
+	// IOPS requested for the volume, required by provisioned IOPS volume types
+	IOPS      int64 `json:"iops,omitempty"`
+	Encrypted bool  `json:"encrypted,omitempty"`
+	// DeviceName is required by data volumes, like /dev/sdb
+	DeviceName string `json:"deviceName,omitempty"`
+}
+
+// CapacityType is the purchase option of the machines in a worker pool
+type CapacityType string
+
+const (
+	OnDemandCapacity CapacityType = "OnDemand"
+	SpotCapacity     CapacityType = "Spot"
+)
+
 type WorkerNode struct {
+	// Name identifies the worker pool and names its machine pool or machine deployment.
+	// It is required and can't be changed. Pools created before it existed are named by their index.
+	// +kubebuilder:validation:Pattern=`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`
+	Name                    string `json:"name,omitempty"`
 	Node                    `json:",inline,omitempty"`
 	Autoscale               Autoscaling             `json:"autoscaling,omitempty"`
 	InfraNode               bool                    `json:"infraNode,omitempty"`
 	LaunchTemplateReference LaunchTemplateReference `json:"launchTemplateReference,omitempty"`
+	// ImageID overrides the image looked up by Kubernetes version, like an AMI ID on AWS
+	ImageID     string   `json:"imageID,omitempty"`
+	RootVolume  *Volume  `json:"rootVolume,omitempty"`
+	DataVolumes []Volume `json:"dataVolumes,omitempty"`
+	// +kubebuilder:validation:Enum=OnDemand;Spot
+	CapacityType CapacityType `json:"capacityType,omitempty"`
+	// FallbackMachineTypes are launched when there is no capacity of MachineType.
+	// On-demand pools try them in the given order.
+	FallbackMachineTypes []string `json:"fallbackMachineTypes,omitempty"`
+	// HealthCheck enables replacing the unhealthy machines of the pool
+	HealthCheck *HealthCheckPolicy `json:"healthCheck,omitempty"`
+}
+
+// IsSpot returns if the pool machines are spot instances
+func (w WorkerNode) IsSpot() bool {
+	return w.CapacityType == SpotCapacity
 }
 
 type Autoscaling struct {
@@ -97,21 +156,70 @@ type Autoscaling struct {
 }
 
 type InfrastructureProvider struct {
-	Name   string          `json:"name,omitempty"`
-	SSHKey string          `json:"sshKey,omitempty"`
-	Flavor string          `json:"flavor,omitempty"`
-	Region string          `json:"region,omitempty"`
-	Env    []corev1.EnvVar `json:"env,omitempty"`
+	Name      string           `json:"name,omitempty"`
+	SSHKey    string           `json:"sshKey,omitempty"`
+	Flavor    string           `json:"flavor,omitempty"`
+	Region    string           `json:"region,omitempty"`
+	Env       []corev1.EnvVar  `json:"env,omitempty"`
+	OpenStack *OpenStackConfig `json:"openstack,omitempty"`
+	VSphere   *VSphereConfig   `json:"vsphere,omitempty"`
+}
+
+// OpenStackConfig holds the settings used only by clusters created on OpenStack
+type OpenStackConfig struct {
+	// CloudName is the entry of the clouds.yaml used to reach the OpenStack API
+	CloudName string `json:"cloudName,omitempty"`
+	// ExternalNetworkID is the network used to allocate floating IPs and router gateways
+	ExternalNetworkID string `json:"externalNetworkID,omitempty"`
+	// Image is the Glance image name used by all machines
+	Image          string   `json:"image,omitempty"`
+	DNSNameservers []string `json:"dnsNameservers,omitempty"`
+}
+
+// VSphereConfig holds the settings used only by clusters created on vSphere
+type VSphereConfig struct {
+	Datacenter string `json:"datacenter,omitempty"`
+	Datastore  string `json:"datastore,omitempty"`
+	// Network is the port group attached to all machines
+	Network string `json:"network,omitempty"`
+	// Template is the VM template cloned to create machines
+	Template     string `json:"template,omitempty"`
+	Folder       string `json:"folder,omitempty"`
+	ResourcePool string `json:"resourcePool,omitempty"`
+	DiskGiB      int32  `json:"diskGiB,omitempty"`
+}
+
+// vSphere has no instance types, so machineType is written as <cpus>cpu-<memory>gb
+var vsphereMachineTypeRegex = regexp.MustCompile(`^([1-9][0-9]*)cpu-([1-9][0-9]*)gb$`)
+
+// ParseVSphereMachineType returns the number of CPUs and the memory in MiB of a machine type like 4cpu-8gb
+func ParseVSphereMachineType(machineType string) (numCPUs int32, memoryMiB int64, err error) {
+	m := vsphereMachineTypeRegex.FindStringSubmatch(machineType)
+	if m == nil {
+		return 0, 0, errors.Errorf("invalid vSphere machine type %q, expected format is <cpus>cpu-<memory>gb", machineType)
+	}
+	cpus, err := strconv.ParseInt(m[1], 10, 32)
+	if err != nil {
+		return 0, 0, err
+	}
+	mem, err := strconv.ParseInt(m[2], 10, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+	return int32(cpus), mem * 1024, nil
 }
 
 type SupportedInfraProvider int8
 
 const (
 	Amazon SupportedInfraProvider = iota
+	OpenStack
+	Docker
+	VSphere
 )
 
 func (s SupportedInfraProvider) String() string {
-	return [...]string{"aws"}[s]
+	return [...]string{"aws", "openstack", "docker", "vsphere"}[s]
 }
 
 type SupportedInfraProviderFlavor int8
@@ -119,22 +227,76 @@ type SupportedInfraProviderFlavor int8
 const (
 	EC2 SupportedInfraProviderFlavor = iota
 	EKS
+	Kubeadm
 )
 
 func (s SupportedInfraProviderFlavor) String() string {
-	return [...]string{"ec2", "eks"}[s]
+	return [...]string{"ec2", "eks", "kubeadm"}[s]
+}
+
+// InfraFlavor describes a way to create clusters in an infrastructure provider
+// +kubebuilder:object:generate=false
+type InfraFlavor struct {
+	Name string
+	// Managed is true when the control plane is managed by the infrastructure provider
+	Managed bool
+}
+
+// builtinFlavors are the flavors of the providers built in UnDistro,
+// so they are known by the API without importing pkg/cloud
+var builtinFlavors = map[string][]InfraFlavor{
+	Amazon.String(): {
+		{Name: EC2.String()},
+		{Name: EKS.String(), Managed: true},
+	},
+	OpenStack.String(): {{Name: Kubeadm.String()}},
+	Docker.String():    {{Name: Kubeadm.String()}},
+	VSphere.String():   {{Name: Kubeadm.String()}},
+}
+
+var (
+	flavorsMu sync.RWMutex
+	flavors   = make(map[string][]InfraFlavor)
+)
+
+// BuiltinFlavors returns the flavors of a provider built in UnDistro
+func BuiltinFlavors(provider string) []InfraFlavor {
+	return builtinFlavors[provider]
+}
+
+// RegisterFlavors makes the flavors of an infrastructure provider known to the API.
+// It's called when a provider is registered in pkg/cloud, the built-in providers are known without it.
+func RegisterFlavors(provider string, f []InfraFlavor) {
+	flavorsMu.Lock()
+	defer flavorsMu.Unlock()
+	flavors[provider] = f
+}
+
+func providerFlavors(provider string) []InfraFlavor {
+	flavorsMu.RLock()
+	defer flavorsMu.RUnlock()
+	if f, ok := flavors[provider]; ok {
+		return f
+	}
+	return builtinFlavors[provider]
 }
 
 func (i InfrastructureProvider) Flavors() []string {
-	switch i.Name {
-	case Amazon.String():
-		return []string{EC2.String(), EKS.String()}
+	f := providerFlavors(i.Name)
+	names := make([]string, 0, len(f))
+	for _, flavor := range f {
+		names = append(names, flavor.Name)
 	}
-	return nil
+	return names
 }
 
 func (i InfrastructureProvider) IsManaged() bool {
-	return i.Name == Amazon.String() && i.Flavor == EKS.String()
+	for _, f := range providerFlavors(i.Name) {
+		if f.Name == i.Flavor {
+			return f.Managed
+		}
+	}
+	return false
 }
 
 type NetworkSpec struct {
@@ -144,11 +306,54 @@ type NetworkSpec struct {
 	IsPublic  bool   `json:"isPublic,omitempty"`
 }
 
+// CNIProvider is the network plugin installed in the cluster
+type CNIProvider string
+
+const (
+	CalicoCNI CNIProvider = "calico"
+	CiliumCNI CNIProvider = "cilium"
+	// NoCNI leaves the network plugin installation to the user
+	NoCNI CNIProvider = "none"
+)
+
+// CNI is the network plugin installed by UnDistro as a HelmRelease
+type CNI struct {
+	// +kubebuilder:validation:Enum=calico;cilium;none
+	Provider CNIProvider `json:"provider,omitempty"`
+	// Version of the plugin chart
+	Version string `json:"version,omitempty"`
+	// Values are merged over the ones set by UnDistro for the infrastructure provider
+	Values *apiextensionsv1.JSON `json:"values,omitempty"`
+}
+
+// DefaultCNIVersions are the chart versions installed when the CNI version isn't set
+var DefaultCNIVersions = map[CNIProvider]string{
+	CalicoCNI: "3.19.1",
+	CiliumCNI: "1.10.4",
+}
+
 type Network struct {
 	capi.ClusterNetwork `json:",inline"`
 	VPC                 NetworkSpec   `json:"vpc,omitempty"`
 	Subnets             []NetworkSpec `json:"subnets,omitempty"`
 	MultiZone           bool          `json:"multiZone,omitempty"`
+	CNI                 *CNI          `json:"cni,omitempty"`
+}
+
+// GetCNI returns the CNI with defaults set.
+// Clusters created before the CNI was selectable run Calico.
+func (n Network) GetCNI() CNI {
+	cni := CNI{}
+	if n.CNI != nil {
+		cni = *n.CNI
+	}
+	if cni.Provider == "" {
+		cni.Provider = CalicoCNI
+	}
+	if cni.Version == "" {
+		cni.Version = DefaultCNIVersions[cni.Provider]
+	}
+	return cni
 }
 
 type Bastion struct {
@@ -158,6 +363,73 @@ type Bastion struct {
 	InstanceType        string   `json:"instanceType,omitempty"`
 }
 
+// DeletionPolicy is what happens to the cluster infrastructure when the Cluster is deleted
+type DeletionPolicy string
+
+const (
+	// DeletePolicy destroys the cluster machines and network
+	DeletePolicy DeletionPolicy = "Delete"
+	// OrphanPolicy detaches the cluster from UnDistro and keeps it running
+	OrphanPolicy DeletionPolicy = "Orphan"
+)
+
+// Addon is a Helm chart installed in the cluster as a HelmRelease owned by the Cluster
+type Addon struct {
+	// Name identifies the addon in the cluster
+	// +kubebuilder:validation:Pattern=`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`
+	Name  string      `json:"name"`
+	Chart ChartSource `json:"chart"`
+	// TargetNamespace is where the chart is installed. Defaults to the addon name
+	TargetNamespace string `json:"targetNamespace,omitempty"`
+	// Values holds the values of the chart
+	Values *apiextensionsv1.JSON `json:"values,omitempty"`
+	// DependsOn lists the addons that must be ready before this one is installed
+	DependsOn []string `json:"dependsOn,omitempty"`
+}
+
+// GetTargetNamespace returns the namespace where the addon chart is installed
+func (a Addon) GetTargetNamespace() string {
+	if a.TargetNamespace != "" {
+		return a.TargetNamespace
+	}
+	return a.Name
+}
+
+// Backup schedules etcd snapshots of self managed control planes to an S3 compatible bucket
+type Backup struct {
+	// Schedule is when the snapshots are taken, in cron format
+	Schedule    string            `json:"schedule"`
+	Destination BackupDestination `json:"destination"`
+}
+
+// BackupDestination is the S3 compatible bucket where the snapshots are stored
+type BackupDestination struct {
+	Bucket string `json:"bucket"`
+	// Prefix of the snapshot keys. Defaults to <cluster namespace>/<cluster name>
+	Prefix string `json:"prefix,omitempty"`
+	Region string `json:"region,omitempty"`
+	// Endpoint of S3 compatible storages, like MinIO. Defaults to AWS S3
+	Endpoint string `json:"endpoint,omitempty"`
+	// SecretRef is a secret in the cluster namespace with the accessKeyID and secretAccessKey keys.
+	// The control plane machines credentials are used when it isn't set.
+	SecretRef *corev1.LocalObjectReference `json:"secretRef,omitempty"`
+}
+
+// GetPrefix returns the prefix of the snapshot keys of the cluster
+func (d BackupDestination) GetPrefix(cl *Cluster) string {
+	if d.Prefix != "" {
+		return strings.Trim(d.Prefix, "/")
+	}
+	return fmt.Sprintf("%s/%s", cl.GetNamespace(), cl.Name)
+}
+
+// BackupStatus is the last successful etcd snapshot
+type BackupStatus struct {
+	// Snapshot is the key of the snapshot in the bucket
+	Snapshot string      `json:"snapshot,omitempty"`
+	Time     metav1.Time `json:"time,omitempty"`
+}
+
 // ClusterSpec defines the desired state of Cluster
 type ClusterSpec struct {
 	Paused                 bool                   `json:"paused,omitempty"`
@@ -167,6 +439,42 @@ type ClusterSpec struct {
 	Bastion                *Bastion               `json:"bastion,omitempty"`
 	ControlPlane           *ControlPlaneNode      `json:"controlPlane,omitempty"`
 	Workers                []WorkerNode           `json:"workers,omitempty"`
+	// +kubebuilder:validation:Enum=Delete;Orphan
+	DeletionPolicy DeletionPolicy `json:"deletionPolicy,omitempty"`
+	// NodeDrainTimeout is how long UnDistro waits for the nodes to be drained before
+	// removing them from a worker pool. Defaults to 10 minutes, 0 disables the drain.
+	NodeDrainTimeout *metav1.Duration `json:"nodeDrainTimeout,omitempty"`
+	// HealthCheckInterval is how often the workload cluster API server, nodes and addons are checked.
+	// Defaults to 5 minutes, 0 disables the health checks.
+	HealthCheckInterval *metav1.Duration `json:"healthCheckInterval,omitempty"`
+	// KubeconfigRotationInterval is how often the admin kubeconfig client certificate is reissued.
+	// Unset or 0 disables the rotation. Managed clusters don't support it.
+	KubeconfigRotationInterval *metav1.Duration `json:"kubeconfigRotationInterval,omitempty"`
+	// Backup takes etcd snapshots of the control plane. Managed clusters don't support it.
+	Backup *Backup `json:"backup,omitempty"`
+	// Addons are Helm charts installed in the cluster after the CNI, like metrics-server or an ingress controller
+	Addons []Addon `json:"addons,omitempty"`
+	// TemplateRef is a ClusterTemplate in the cluster namespace rendered instead of
+	// the template built into UnDistro for the infrastructure provider flavor
+	TemplateRef *corev1.LocalObjectReference `json:"templateRef,omitempty"`
+	// ProfileRef is a ClusterProfile in the cluster namespace with defaults merged into the cluster
+	ProfileRef *ProfileReference `json:"profileRef,omitempty"`
+}
+
+// WorkerPoolStatus is the observed state of a worker pool
+type WorkerPoolStatus struct {
+	Name string `json:"name,omitempty"`
+	// KubernetesVersion is the oldest version reported by the pool nodes
+	KubernetesVersion string `json:"kubernetesVersion,omitempty"`
+	Replicas          int32  `json:"replicas,omitempty"`
+	ReadyReplicas     int32  `json:"readyReplicas,omitempty"`
+	// SpotReplicas is the number of nodes running on spot capacity
+	SpotReplicas     int32 `json:"spotReplicas,omitempty"`
+	OnDemandReplicas int32 `json:"onDemandReplicas,omitempty"`
+	// ReadyNodes is the number of pool nodes reporting Ready in the last health check
+	ReadyNodes int32 `json:"readyNodes,omitempty"`
+	// Remediations is the number of unhealthy machines replaced
+	Remediations int32 `json:"remediations,omitempty"`
 }
 
 // ClusterStatus defines the observed state of Cluster
@@ -184,9 +492,24 @@ type ClusterStatus struct {
 	BastionPublicIP     string             `json:"bastionPublicIP,omitempty"`
 	LastUsedUID         string             `json:"lastUsedUID,omitempty"`
 	BastionConfig       *Bastion           `json:"bastionConfig,omitempty"`
-	KubernetesVersion   string             `json:"kubernetesVersion,omitempty"`
-	ControlPlane        ControlPlaneNode   `json:"controlPlane,omitempty"`
-	Workers             []WorkerNode       `json:"workers,omitempty"`
+	// KubernetesVersion is the oldest version reported by the control plane
+	KubernetesVersion string `json:"kubernetesVersion,omitempty"`
+	// TargetKubernetesVersion is the version the cluster templates were last applied with
+	TargetKubernetesVersion string             `json:"targetKubernetesVersion,omitempty"`
+	ControlPlane            ControlPlaneNode   `json:"controlPlane,omitempty"`
+	Workers                 []WorkerNode       `json:"workers,omitempty"`
+	WorkerPools             []WorkerPoolStatus `json:"workerPools,omitempty"`
+	// LastHealthCheckTime is when the workload cluster was last checked
+	LastHealthCheckTime *metav1.Time `json:"lastHealthCheckTime,omitempty"`
+	// ControlPlaneRemediations is the number of unhealthy control plane machines replaced
+	ControlPlaneRemediations int32 `json:"controlPlaneRemediations,omitempty"`
+	// LastKubeconfigRotationTime is when the admin kubeconfig was last rotated
+	LastKubeconfigRotationTime *metav1.Time `json:"lastKubeconfigRotationTime,omitempty"`
+	// LastBackup is the last successful etcd snapshot
+	LastBackup *BackupStatus `json:"lastBackup,omitempty"`
+	// TemplateName is the ClusterTemplate last applied, empty when the built in template is used
+	TemplateName       string `json:"templateName,omitempty"`
+	TemplateGeneration int64  `json:"templateGeneration,omitempty"`
 }
 
 // +genclient
@@ -194,6 +517,7 @@ type ClusterStatus struct {
 // +kubebuilder:resource:shortName=cl,scope=Namespaced
 // +kubebuilder:subresource:status
 // +kubebuilder:printcolumn:name="k8s",type="string",JSONPath=".spec.kubernetesVersion",description=""
+// +kubebuilder:printcolumn:name="Observed k8s",type="string",JSONPath=".status.kubernetesVersion",description=""
 // +kubebuilder:printcolumn:name="Infra",type="string",JSONPath=".spec.infrastructureProvider.name",description=""
 // +kubebuilder:printcolumn:name="Worker Pools",type="integer",JSONPath=".status.totalWorkerPools",description=""
 // +kubebuilder:printcolumn:name="Worker Replicas",type="integer",JSONPath=".status.totalWorkerReplicas",description=""
@@ -237,20 +561,62 @@ func (c *Cluster) GetStatusConditions() *[]metav1.Condition {
 }
 
 func (c *Cluster) GetWorkerRefByMachinePool(mpName string) (WorkerNode, error) {
-	split := strings.Split(mpName, "-")
-	indexStr := split[len(split)-1]
-	index, err := strconv.Atoi(indexStr)
+	index, err := c.GetWorkerIndexByMachinePool(mpName)
 	if err != nil {
 		return WorkerNode{}, err
 	}
-	if index > len(c.Spec.Workers)-1 {
-		return WorkerNode{}, InvalidMP
-	}
 	return c.Spec.Workers[index], nil
 }
 
+func (c *Cluster) GetWorkerIndexByMachinePool(mpName string) (int, error) {
+	for i := range c.Spec.Workers {
+		if mpName == c.MachinePoolName(i) || mpName == c.MachineDeploymentName(i) {
+			return i, nil
+		}
+	}
+	return 0, InvalidMP
+}
+
+// WorkerPoolName returns the name of the worker pool at the index.
+// Pools created before they were named are identified by their index.
+func (c *Cluster) WorkerPoolName(i int) string {
+	if c.Spec.Workers[i].Name != "" {
+		return c.Spec.Workers[i].Name
+	}
+	return strconv.Itoa(i)
+}
+
+// GetWorkerIndexByName returns the index of the named worker pool or -1
+func (c *Cluster) GetWorkerIndexByName(name string) int {
+	for i := range c.Spec.Workers {
+		if c.WorkerPoolName(i) == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// MachinePoolName returns the name of the machine pool of the worker pool at the index
+func (c *Cluster) MachinePoolName(i int) string {
+	return fmt.Sprintf("%s-mp-%s", c.Name, c.WorkerPoolName(i))
+}
+
+// MachineDeploymentName returns the name of the machine deployment of the worker pool at the index
+func (c *Cluster) MachineDeploymentName(i int) string {
+	return fmt.Sprintf("%s-md-%s", c.Name, c.WorkerPoolName(i))
+}
+
 var InvalidMP = errors.New("invalid machinepool")
 
+// AutoscalerReleaseName is the name of the cluster-autoscaler chart, whose release
+// is named like an addon, so it's reserved in the addons
+const AutoscalerReleaseName = "cluster-autoscaler"
+
+// AddonReleaseName returns the name of the HelmRelease of the addon
+func (c *Cluster) AddonReleaseName(addon string) string {
+	return fmt.Sprintf("%s-%s", addon, c.Name)
+}
+
 // ClusterProgressing resets any failures and registers progress toward
 // reconciling the given Cluster by setting the meta.ReadyCondition to
 // 'Unknown' for meta.ProgressingReason.
@@ -0,0 +1,64 @@
+/*
+Copyright 2020-2021 The UnDistro authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"reflect"
+	"testing"
+)
+
+// the built-in providers are known without pkg/cloud registering them
+func TestInfrastructureProvider_Flavors(t *testing.T) {
+	tests := []struct {
+		name        string
+		infra       InfrastructureProvider
+		wantFlavors []string
+		wantManaged bool
+	}{
+		{
+			name:        "ec2",
+			infra:       InfrastructureProvider{Name: Amazon.String(), Flavor: EC2.String()},
+			wantFlavors: []string{EC2.String(), EKS.String()},
+		},
+		{
+			name:        "eks",
+			infra:       InfrastructureProvider{Name: Amazon.String(), Flavor: EKS.String()},
+			wantFlavors: []string{EC2.String(), EKS.String()},
+			wantManaged: true,
+		},
+		{
+			name:        "openstack",
+			infra:       InfrastructureProvider{Name: OpenStack.String(), Flavor: Kubeadm.String()},
+			wantFlavors: []string{Kubeadm.String()},
+		},
+		{
+			name:        "unknown",
+			infra:       InfrastructureProvider{Name: "unknown"},
+			wantFlavors: []string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.infra.Flavors(); !reflect.DeepEqual(got, tt.wantFlavors) {
+				t.Errorf("Flavors() = %v, want %v", got, tt.wantFlavors)
+			}
+			if got := tt.infra.IsManaged(); got != tt.wantManaged {
+				t.Errorf("IsManaged() = %v, want %v", got, tt.wantManaged)
+			}
+		})
+	}
+}
@@ -18,9 +18,14 @@ package v1alpha1
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"net/url"
 	"reflect"
+	"regexp"
+	"strconv"
 	"strings"
+	"time"
 	"unicode"
 
 	"github.com/getupio-undistro/undistro/pkg/meta"
@@ -29,9 +34,12 @@ import (
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/validation"
 	"k8s.io/apimachinery/pkg/util/validation/field"
 	capi "sigs.k8s.io/cluster-api/api/v1alpha3"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
 )
@@ -63,9 +71,22 @@ func (r *Cluster) Default() {
 	r.Labels[meta.LabelUndistroClusterName] = r.Name
 	r.Labels[capi.ClusterLabelName] = r.Name
 	r.Labels[meta.LabelUndistroClusterType] = "workload"
+	r.applyProfile()
 	if r.Spec.ControlPlane == nil {
 		r.Spec.ControlPlane = &ControlPlaneNode{}
 	}
+	if r.Spec.DeletionPolicy == "" {
+		r.Spec.DeletionPolicy = DeletePolicy
+	}
+	switch r.Spec.InfrastructureProvider.Name {
+	case OpenStack.String():
+		r.defaultOpenStack()
+	case VSphere.String():
+		r.defaultVSphere()
+	}
+	cni := r.Spec.Network.GetCNI()
+	r.Spec.Network.CNI = &cni
+	r.defaultWorkerNames()
 	bastionEnabled := true
 	if r.Spec.Bastion == nil && r.Spec.InfrastructureProvider.SSHKey != "" {
 		r.Spec.Bastion = &Bastion{
@@ -97,7 +118,73 @@ func (r *Cluster) Default() {
 	}
 }
 
-//+kubebuilder:webhook:path=/validate-app-undistro-io-v1alpha1-cluster,mutating=false,failurePolicy=fail,sideEffects=None,groups=app.undistro.io,resources=clusters,verbs=create;update,versions=v1alpha1,name=vcluster.undistro.io,admissionReviewVersions={v1,v1beta1}
+// applyProfile merges the referenced profile into the cluster when it wasn't merged yet.
+// Errors getting the profile are reported by the validation.
+func (r *Cluster) applyProfile() {
+	if r.Spec.ProfileRef == nil || r.Spec.ProfileRef.Generation != 0 {
+		return
+	}
+	p := ClusterProfile{}
+	key := client.ObjectKey{
+		Name:      r.Spec.ProfileRef.Name,
+		Namespace: r.GetNamespace(),
+	}
+	err := k8sClient.Get(context.TODO(), key, &p)
+	if err != nil {
+		clusterlog.Error(err, "unable to get profile", "name", r.Name, "profile", r.Spec.ProfileRef.Name)
+		return
+	}
+	p.Merge(r)
+	r.Spec.ProfileRef.Generation = p.Generation
+}
+
+// defaultWorkerNames migrates clusters created before worker pools were named.
+// Their pools keep the names derived from the index, so the existing machine pools are kept.
+func (r *Cluster) defaultWorkerNames() {
+	if r.CreationTimestamp.IsZero() {
+		return
+	}
+	for i := range r.Spec.Workers {
+		if r.Spec.Workers[i].Name == "" {
+			r.Spec.Workers[i].Name = strconv.Itoa(i)
+		}
+	}
+}
+
+func (r *Cluster) defaultOpenStack() {
+	if r.Spec.InfrastructureProvider.OpenStack == nil {
+		r.Spec.InfrastructureProvider.OpenStack = &OpenStackConfig{}
+	}
+	if r.Spec.InfrastructureProvider.OpenStack.CloudName == "" {
+		r.Spec.InfrastructureProvider.OpenStack.CloudName = "openstack"
+	}
+	// every OpenStack cluster gets its own network, so the same CIDR can be safely reused
+	if r.Spec.Network.VPC.ID == "" && r.Spec.Network.VPC.CIDRBlock == "" {
+		r.Spec.Network.VPC.CIDRBlock = "10.6.0.0/24"
+	}
+}
+
+func (r *Cluster) defaultVSphere() {
+	if r.Spec.InfrastructureProvider.VSphere == nil {
+		r.Spec.InfrastructureProvider.VSphere = &VSphereConfig{}
+	}
+	if r.Spec.InfrastructureProvider.VSphere.DiskGiB == 0 {
+		r.Spec.InfrastructureProvider.VSphere.DiskGiB = 25
+	}
+	// sshKey is an authorized key added to machines, it doesn't enable a bastion
+	if r.Spec.Bastion == nil {
+		bastionEnabled := false
+		r.Spec.Bastion = &Bastion{
+			Enabled: &bastionEnabled,
+		}
+	}
+	// the endpoint is a virtual IP announced by kube-vip in control plane nodes
+	if r.Spec.ControlPlane.Endpoint.Host != "" && r.Spec.ControlPlane.Endpoint.Port == 0 {
+		r.Spec.ControlPlane.Endpoint.Port = 6443
+	}
+}
+
+//+kubebuilder:webhook:path=/validate-app-undistro-io-v1alpha1-cluster,mutating=false,failurePolicy=fail,sideEffects=None,groups=app.undistro.io,resources=clusters,verbs=create;update;delete,versions=v1alpha1,name=vcluster.undistro.io,admissionReviewVersions={v1,v1beta1}
 
 var _ webhook.Validator = &Cluster{}
 
@@ -140,6 +227,49 @@ func (r *Cluster) validate(old *Cluster) error {
 			"kubernetesVersion must to be a semantic versioning",
 		))
 	}
+	if old != nil && err == nil {
+		allErrs = r.validateKubernetesUpgrade(old, allErrs)
+	}
+	allErrs = r.validateWorkerNames(old, allErrs)
+	for i, w := range r.Spec.Workers {
+		allErrs = validateAutoscaling(field.NewPath("spec", "workers").Index(i), w, allErrs)
+		allErrs = validateHealthCheck(field.NewPath("spec", "workers").Index(i).Child("healthCheck"), w.HealthCheck, allErrs)
+	}
+	if r.Spec.ControlPlane != nil {
+		allErrs = validateHealthCheck(field.NewPath("spec", "controlPlane", "healthCheck"), r.Spec.ControlPlane.HealthCheck, allErrs)
+	}
+	allErrs = r.validateCNI(old, allErrs)
+	allErrs = r.validateBackup(allErrs)
+	allErrs = r.validateAddons(allErrs)
+	if r.Spec.NodeDrainTimeout != nil && r.Spec.NodeDrainTimeout.Duration < 0 {
+		allErrs = append(allErrs, field.Invalid(
+			field.NewPath("spec", "nodeDrainTimeout"),
+			r.Spec.NodeDrainTimeout.Duration.String(),
+			"must be greater than or equal to 0",
+		))
+	}
+	if r.Spec.HealthCheckInterval != nil && r.Spec.HealthCheckInterval.Duration < 0 {
+		allErrs = append(allErrs, field.Invalid(
+			field.NewPath("spec", "healthCheckInterval"),
+			r.Spec.HealthCheckInterval.Duration.String(),
+			"must be greater than or equal to 0",
+		))
+	}
+	if r.Spec.KubeconfigRotationInterval != nil && r.Spec.KubeconfigRotationInterval.Duration != 0 {
+		if r.Spec.InfrastructureProvider.IsManaged() {
+			allErrs = append(allErrs, field.Invalid(
+				field.NewPath("spec", "kubeconfigRotationInterval"),
+				r.Spec.KubeconfigRotationInterval.Duration.String(),
+				"is not supported in managed clusters",
+			))
+		} else if r.Spec.KubeconfigRotationInterval.Duration < time.Hour {
+			allErrs = append(allErrs, field.Invalid(
+				field.NewPath("spec", "kubeconfigRotationInterval"),
+				r.Spec.KubeconfigRotationInterval.Duration.String(),
+				"must be 0 or at least 1h",
+			))
+		}
+	}
 	const immutableMsg = "field is immutable"
 	if old != nil && r.Spec.ControlPlane != nil && !r.Spec.InfrastructureProvider.IsManaged() {
 		if !reflect.DeepEqual(old.Spec.ControlPlane.Endpoint, capi.APIEndpoint{}) &&
@@ -168,8 +298,39 @@ func (r *Cluster) validate(old *Cluster) error {
 	switch r.Spec.InfrastructureProvider.Name {
 	case Amazon.String():
 		allErrs = r.validateAWS(old, allErrs)
+	case OpenStack.String():
+		allErrs = r.validateWorkerOptions(allErrs)
+		allErrs = r.validateOpenStack(old, allErrs)
+	case Docker.String():
+		allErrs = r.validateWorkerOptions(allErrs)
+		allErrs = r.validateDocker(allErrs)
+	case VSphere.String():
+		allErrs = r.validateWorkerOptions(allErrs)
+		allErrs = r.validateVSphere(old, allErrs)
 	}
-	if old == nil {
+	if r.Spec.ProfileRef != nil {
+		allErrs, err = r.validateProfile(old, allErrs)
+		if err != nil {
+			return err
+		}
+	}
+	if r.Spec.TemplateRef != nil {
+		ct := ClusterTemplate{}
+		key := client.ObjectKey{
+			Name:      r.Spec.TemplateRef.Name,
+			Namespace: r.GetNamespace(),
+		}
+		err = k8sClient.Get(context.TODO(), key, &ct)
+		if err != nil {
+			allErrs = append(allErrs, field.NotFound(
+				field.NewPath("spec", "templateRef", "name"),
+				r.Spec.TemplateRef.Name,
+			))
+		}
+	}
+	// docker clusters share the network of the kind cluster and
+	// vSphere clusters are attached to an existing port group
+	if old == nil && r.Spec.InfrastructureProvider.Name != Docker.String() && r.Spec.InfrastructureProvider.Name != VSphere.String() {
 		// check network just on creation
 		clList := ClusterList{}
 		err = k8sClient.List(context.TODO(), &clList)
@@ -198,7 +359,7 @@ func (r *Cluster) validate(old *Cluster) error {
 	return apierrors.NewInvalid(GroupVersion.WithKind("Cluster").GroupKind(), r.Name, allErrs)
 }
 
-func (r *Cluster) validateAWS(old runtime.Object, allErrs field.ErrorList) field.ErrorList {
+func (r *Cluster) validateAWS(old *Cluster, allErrs field.ErrorList) field.ErrorList {
 	if r.Spec.InfrastructureProvider.Name == Amazon.String() && r.Spec.InfrastructureProvider.Flavor == EC2.String() && r.Spec.InfrastructureProvider.SSHKey == "" {
 		allErrs = append(allErrs, field.Required(
 			field.NewPath("spec", "infrastructureProvider", "sshKey"),
@@ -212,6 +373,576 @@ func (r *Cluster) validateAWS(old runtime.Object, allErrs field.ErrorList) field
 			"Invalid cluster name for AWS",
 		))
 	}
+	for i, w := range r.Spec.Workers {
+		var oldWorker *WorkerNode
+		if old != nil {
+			if j := old.GetWorkerIndexByName(r.WorkerPoolName(i)); j >= 0 {
+				oldWorker = &old.Spec.Workers[j]
+			}
+		}
+		allErrs = r.validateAWSWorker(field.NewPath("spec", "workers").Index(i), w, oldWorker, allErrs)
+	}
+	return r.validateAWSAutoscaling(allErrs)
+}
+
+// validateAWSAutoscaling rejects autoscaling both machine pools and machine deployments,
+// because machine pools are scaled by the aws provider of cluster-autoscaler and machine deployments
+// by its clusterapi provider, and a cluster runs just one of them
+func (r *Cluster) validateAWSAutoscaling(allErrs field.ErrorList) field.ErrorList {
+	first := -1
+	for i, w := range r.Spec.Workers {
+		if !w.Autoscale.Enabled {
+			continue
+		}
+		if first < 0 {
+			first = i
+			continue
+		}
+		if (len(w.DataVolumes) > 0) != (len(r.Spec.Workers[first].DataVolumes) > 0) {
+			allErrs = append(allErrs, field.Forbidden(
+				field.NewPath("spec", "workers").Index(i).Child("autoscaling", "enabled"),
+				fmt.Sprintf("can't be autoscaled with pool %s, as just one of them has data volumes", r.WorkerPoolName(first)),
+			))
+		}
+	}
+	return allErrs
+}
+
+var (
+	awsVolumeTypes = []string{"standard", "gp2", "gp3", "io1", "io2", "st1", "sc1"}
+	awsAMIRegex    = regexp.MustCompile(`^ami-[0-9a-f]+$`)
+)
+
+// auto scaling groups accept up to 20 instance types
+const awsMaxFallbackMachineTypes = 19
+
+// validateAWSWorker checks the machine image and disks of a worker pool.
+// EKS managed node groups only allow to change the root disk size.
+func (r *Cluster) validateAWSWorker(wPath *field.Path, w WorkerNode, old *WorkerNode, allErrs field.ErrorList) field.ErrorList {
+	if r.Spec.InfrastructureProvider.IsManaged() {
+		if w.ImageID != "" {
+			allErrs = append(allErrs, field.Forbidden(wPath.Child("imageID"), "custom images aren't supported by EKS node groups"))
+		}
+		if w.RootVolume != nil && (w.RootVolume.Type != "" || w.RootVolume.IOPS != 0 || w.RootVolume.Encrypted || w.RootVolume.DeviceName != "") {
+			allErrs = append(allErrs, field.Forbidden(wPath.Child("rootVolume"), "just the size of the root volume can be set in EKS node groups"))
+		}
+		if len(w.DataVolumes) > 0 {
+			allErrs = append(allErrs, field.Forbidden(wPath.Child("dataVolumes"), "data volumes aren't supported by EKS node groups"))
+		}
+		if w.IsSpot() {
+			allErrs = append(allErrs, field.Forbidden(wPath.Child("capacityType"), "spot instances aren't supported by EKS node groups"))
+		}
+		if len(w.FallbackMachineTypes) > 0 {
+			allErrs = append(allErrs, field.Forbidden(wPath.Child("fallbackMachineTypes"), "mixed instances aren't supported by EKS node groups"))
+		}
+	}
+	if len(w.DataVolumes) > 0 && len(w.FallbackMachineTypes) > 0 {
+		allErrs = append(allErrs, field.Forbidden(wPath.Child("fallbackMachineTypes"), "mixed instances aren't supported by pools with data volumes"))
+	}
+	if len(w.FallbackMachineTypes) > awsMaxFallbackMachineTypes {
+		allErrs = append(allErrs, field.TooMany(wPath.Child("fallbackMachineTypes"), len(w.FallbackMachineTypes), awsMaxFallbackMachineTypes))
+	}
+	machineTypes := map[string]bool{w.MachineType: true}
+	for i, mt := range w.FallbackMachineTypes {
+		if machineTypes[mt] {
+			allErrs = append(allErrs, field.Duplicate(wPath.Child("fallbackMachineTypes").Index(i), mt))
+		}
+		machineTypes[mt] = true
+	}
+	if w.ImageID != "" && !awsAMIRegex.MatchString(w.ImageID) {
+		allErrs = append(allErrs, field.Invalid(wPath.Child("imageID"), w.ImageID, "must be an AMI ID like ami-0123456789abcdef0"))
+	}
+	if w.RootVolume != nil {
+		allErrs = validateAWSVolume(wPath.Child("rootVolume"), *w.RootVolume, 8, allErrs)
+	}
+	devices := make(map[string]bool)
+	for i, v := range w.DataVolumes {
+		vPath := wPath.Child("dataVolumes").Index(i)
+		allErrs = validateAWSVolume(vPath, v, 1, allErrs)
+		switch {
+		case v.DeviceName == "":
+			allErrs = append(allErrs, field.Required(vPath.Child("deviceName"), "deviceName is required by data volumes"))
+		case devices[v.DeviceName]:
+			allErrs = append(allErrs, field.Duplicate(vPath.Child("deviceName"), v.DeviceName))
+		}
+		devices[v.DeviceName] = true
+	}
+	// pools with data volumes are machine deployments instead of machine pools,
+	// because the launch templates of machine pools don't support them
+	if old != nil && (len(old.DataVolumes) > 0) != (len(w.DataVolumes) > 0) {
+		allErrs = append(allErrs, field.Forbidden(wPath.Child("dataVolumes"), "an existing pool can't switch between having data volumes and not"))
+	}
+	return allErrs
+}
+
+func validateAWSVolume(vPath *field.Path, v Volume, minSize int64, allErrs field.ErrorList) field.ErrorList {
+	if v.Size < minSize {
+		allErrs = append(allErrs, field.Invalid(vPath.Child("size"), v.Size, fmt.Sprintf("must be at least %dGiB", minSize)))
+	}
+	if v.Type != "" && !util.ContainsStringInSlice(awsVolumeTypes, v.Type) {
+		allErrs = append(allErrs, field.NotSupported(vPath.Child("type"), v.Type, awsVolumeTypes))
+	}
+	provisionedIOPS := v.Type == "io1" || v.Type == "io2"
+	if provisionedIOPS && v.IOPS == 0 {
+		allErrs = append(allErrs, field.Required(vPath.Child("iops"), fmt.Sprintf("iops is required by %s volumes", v.Type)))
+	}
+	if v.IOPS != 0 && !provisionedIOPS && v.Type != "gp3" {
+		allErrs = append(allErrs, field.Forbidden(vPath.Child("iops"), "iops can be set only in gp3, io1 and io2 volumes"))
+	}
+	return allErrs
+}
+
+// validateWorkerNames checks the worker pools are uniquely named and they are not renamed.
+// Replacing a pool by a new one at the same position can't be told apart from a rename,
+// so it must be done in two updates.
+func (r *Cluster) validateWorkerNames(old *Cluster, allErrs field.ErrorList) field.ErrorList {
+	names := make(map[string]bool)
+	for i, w := range r.Spec.Workers {
+		namePath := field.NewPath("spec", "workers").Index(i).Child("name")
+		if w.Name == "" {
+			allErrs = append(allErrs, field.Required(namePath, "worker pools must be named"))
+			continue
+		}
+		for _, msg := range validation.IsDNS1123Label(w.Name) {
+			allErrs = append(allErrs, field.Invalid(namePath, w.Name, msg))
+		}
+		// machine deployment names are used as label values
+		if len(r.MachineDeploymentName(i)) > validation.DNS1123LabelMaxLength {
+			allErrs = append(allErrs, field.Invalid(namePath, w.Name, fmt.Sprintf("%s must be no more than %d characters", r.MachineDeploymentName(i), validation.DNS1123LabelMaxLength)))
+		}
+		if names[w.Name] {
+			allErrs = append(allErrs, field.Duplicate(namePath, w.Name))
+		}
+		names[w.Name] = true
+		if old == nil || i >= len(old.Spec.Workers) {
+			continue
+		}
+		oldName := old.WorkerPoolName(i)
+		if w.Name != oldName && r.GetWorkerIndexByName(oldName) < 0 && old.GetWorkerIndexByName(w.Name) < 0 {
+			allErrs = append(allErrs, field.Invalid(namePath, w.Name, fmt.Sprintf("field is immutable, worker pool %s was renamed", oldName)))
+		}
+	}
+	return allErrs
+}
+
+// validateWorkerOptions rejects the worker pool options supported just by AWS clusters
+func (r *Cluster) validateWorkerOptions(allErrs field.ErrorList) field.ErrorList {
+	for i, w := range r.Spec.Workers {
+		wPath := field.NewPath("spec", "workers").Index(i)
+		msg := fmt.Sprintf("not supported by %s clusters", r.Spec.InfrastructureProvider.Name)
+		if w.ImageID != "" {
+			allErrs = append(allErrs, field.Forbidden(wPath.Child("imageID"), msg))
+		}
+		if w.RootVolume != nil {
+			allErrs = append(allErrs, field.Forbidden(wPath.Child("rootVolume"), msg))
+		}
+		if len(w.DataVolumes) > 0 {
+			allErrs = append(allErrs, field.Forbidden(wPath.Child("dataVolumes"), msg))
+		}
+		if w.IsSpot() {
+			allErrs = append(allErrs, field.Forbidden(wPath.Child("capacityType"), msg))
+		}
+		if len(w.FallbackMachineTypes) > 0 {
+			allErrs = append(allErrs, field.Forbidden(wPath.Child("fallbackMachineTypes"), msg))
+		}
+	}
+	return allErrs
+}
+
+func (r *Cluster) validateOpenStack(old *Cluster, allErrs field.ErrorList) field.ErrorList {
+	const immutableMsg = "field is immutable"
+	osPath := field.NewPath("spec", "infrastructureProvider", "openstack")
+	cfg := r.Spec.InfrastructureProvider.OpenStack
+	if cfg == nil {
+		return append(allErrs, field.Required(osPath, "openstack must to be populated"))
+	}
+	if cfg.Image == "" {
+		allErrs = append(allErrs, field.Required(osPath.Child("image"), "image is required to create machines"))
+	}
+	if cfg.ExternalNetworkID == "" && r.Spec.Network.VPC.ID == "" {
+		allErrs = append(allErrs, field.Required(
+			osPath.Child("externalNetworkID"),
+			"externalNetworkID is required when the cluster network is created by UnDistro",
+		))
+	}
+	if r.Spec.ControlPlane != nil && r.Spec.ControlPlane.MachineType == "" {
+		allErrs = append(allErrs, field.Required(
+			field.NewPath("spec", "controlPlane", "machineType"),
+			"machineType must be an OpenStack flavor",
+		))
+	}
+	for i, w := range r.Spec.Workers {
+		if w.MachineType == "" {
+			allErrs = append(allErrs, field.Required(
+				field.NewPath("spec", "workers").Index(i).Child("machineType"),
+				"machineType must be an OpenStack flavor",
+			))
+		}
+	}
+	if old != nil && old.Spec.InfrastructureProvider.OpenStack != nil {
+		oldCfg := old.Spec.InfrastructureProvider.OpenStack
+		if oldCfg.CloudName != "" && cfg.CloudName != oldCfg.CloudName {
+			allErrs = append(allErrs, field.Invalid(osPath.Child("cloudName"), cfg.CloudName, immutableMsg))
+		}
+		if oldCfg.ExternalNetworkID != "" && cfg.ExternalNetworkID != oldCfg.ExternalNetworkID {
+			allErrs = append(allErrs, field.Invalid(osPath.Child("externalNetworkID"), cfg.ExternalNetworkID, immutableMsg))
+		}
+	}
+	return allErrs
+}
+
+func (r *Cluster) validateDocker(allErrs field.ErrorList) field.ErrorList {
+	if r.Spec.Bastion != nil && r.Spec.Bastion.Enabled != nil && *r.Spec.Bastion.Enabled {
+		allErrs = append(allErrs, field.Invalid(
+			field.NewPath("spec", "bastion", "enabled"),
+			*r.Spec.Bastion.Enabled,
+			"bastion is not supported by docker",
+		))
+	}
+	if r.Spec.Network.VPC.ID != "" || r.Spec.Network.VPC.CIDRBlock != "" || len(r.Spec.Network.Subnets) > 0 {
+		allErrs = append(allErrs, field.Forbidden(
+			field.NewPath("spec", "network"),
+			"vpc and subnets are not supported by docker",
+		))
+	}
+	return allErrs
+}
+
+func (r *Cluster) validateVSphere(old *Cluster, allErrs field.ErrorList) field.ErrorList {
+	const immutableMsg = "field is immutable"
+	vsPath := field.NewPath("spec", "infrastructureProvider", "vsphere")
+	cfg := r.Spec.InfrastructureProvider.VSphere
+	if cfg == nil {
+		return append(allErrs, field.Required(vsPath, "vsphere must to be populated"))
+	}
+	required := []struct {
+		name, value string
+	}{
+		{"datacenter", cfg.Datacenter},
+		{"datastore", cfg.Datastore},
+		{"network", cfg.Network},
+		{"template", cfg.Template},
+	}
+	for _, f := range required {
+		if f.value == "" {
+			allErrs = append(allErrs, field.Required(vsPath.Child(f.name), fmt.Sprintf("%s is required to create machines", f.name)))
+		}
+	}
+	if r.Spec.Bastion != nil && r.Spec.Bastion.Enabled != nil && *r.Spec.Bastion.Enabled {
+		allErrs = append(allErrs, field.Invalid(
+			field.NewPath("spec", "bastion", "enabled"),
+			*r.Spec.Bastion.Enabled,
+			"bastion is not supported by vsphere",
+		))
+	}
+	if r.Spec.ControlPlane != nil {
+		if r.Spec.ControlPlane.Endpoint.Host == "" {
+			allErrs = append(allErrs, field.Required(
+				field.NewPath("spec", "controlPlane", "endpoint", "host"),
+				"a free IP address is required to be the control plane virtual IP",
+			))
+		}
+		_, _, err := ParseVSphereMachineType(r.Spec.ControlPlane.MachineType)
+		if err != nil {
+			allErrs = append(allErrs, field.Invalid(
+				field.NewPath("spec", "controlPlane", "machineType"),
+				r.Spec.ControlPlane.MachineType,
+				err.Error(),
+			))
+		}
+	}
+	for i, w := range r.Spec.Workers {
+		_, _, err := ParseVSphereMachineType(w.MachineType)
+		if err != nil {
+			allErrs = append(allErrs, field.Invalid(
+				field.NewPath("spec", "workers").Index(i).Child("machineType"),
+				w.MachineType,
+				err.Error(),
+			))
+		}
+	}
+	if old != nil && old.Spec.InfrastructureProvider.VSphere != nil {
+		oldCfg := old.Spec.InfrastructureProvider.VSphere
+		immutable := []struct {
+			name     string
+			old, new string
+		}{
+			{"datacenter", oldCfg.Datacenter, cfg.Datacenter},
+			{"datastore", oldCfg.Datastore, cfg.Datastore},
+			{"network", oldCfg.Network, cfg.Network},
+			{"folder", oldCfg.Folder, cfg.Folder},
+			{"resourcePool", oldCfg.ResourcePool, cfg.ResourcePool},
+		}
+		for _, f := range immutable {
+			if f.old != f.new {
+				allErrs = append(allErrs, field.Invalid(vsPath.Child(f.name), f.new, immutableMsg))
+			}
+		}
+	}
+	return allErrs
+}
+
+// validateAutoscaling checks the bounds of the worker pool size set in the cluster autoscaler
+func validateAutoscaling(wPath *field.Path, w WorkerNode, allErrs field.ErrorList) field.ErrorList {
+	if !w.Autoscale.Enabled {
+		return allErrs
+	}
+	aPath := wPath.Child("autoscaling")
+	if w.Autoscale.MinSize < 0 {
+		allErrs = append(allErrs, field.Invalid(aPath.Child("minSize"), w.Autoscale.MinSize, "must be greater than or equal to 0"))
+	}
+	if w.Autoscale.MaxSize < 1 {
+		allErrs = append(allErrs, field.Invalid(aPath.Child("maxSize"), w.Autoscale.MaxSize, "must be greater than 0"))
+	}
+	if w.Autoscale.MinSize > w.Autoscale.MaxSize {
+		allErrs = append(allErrs, field.Invalid(
+			aPath.Child("minSize"),
+			w.Autoscale.MinSize,
+			fmt.Sprintf("must be less than or equal to maxSize %d", w.Autoscale.MaxSize),
+		))
+		return allErrs
+	}
+	if w.Replicas != nil && (*w.Replicas < w.Autoscale.MinSize || *w.Replicas > w.Autoscale.MaxSize) {
+		allErrs = append(allErrs, field.Invalid(
+			wPath.Child("replicas"),
+			*w.Replicas,
+			fmt.Sprintf("must be between minSize %d and maxSize %d when autoscaling is enabled", w.Autoscale.MinSize, w.Autoscale.MaxSize),
+		))
+	}
+	return allErrs
+}
+
+// minNodeStartupTimeout is the smallest node startup timeout accepted by machine health checks
+const minNodeStartupTimeout = 30 * time.Second
+
+func validateHealthCheck(hPath *field.Path, h *HealthCheckPolicy, allErrs field.ErrorList) field.ErrorList {
+	if h == nil {
+		return allErrs
+	}
+	for i, c := range h.UnhealthyConditions {
+		cPath := hPath.Child("unhealthyConditions").Index(i)
+		if c.Type == "" {
+			allErrs = append(allErrs, field.Required(cPath.Child("type"), "condition type is required"))
+		}
+		if c.Status == "" {
+			allErrs = append(allErrs, field.Required(cPath.Child("status"), "condition status is required"))
+		}
+		if c.Timeout.Duration < 0 {
+			allErrs = append(allErrs, field.Invalid(cPath.Child("timeout"), c.Timeout.Duration.String(), "must be greater than or equal to 0"))
+		}
+	}
+	if h.MaxUnhealthy != nil {
+		v, err := intstr.GetScaledValueFromIntOrPercent(h.MaxUnhealthy, 100, false)
+		if err != nil || v < 0 {
+			allErrs = append(allErrs, field.Invalid(hPath.Child("maxUnhealthy"), h.MaxUnhealthy.String(), "must be a number or a percentage greater than or equal to 0"))
+		}
+	}
+	if h.NodeStartupTimeout != nil && h.NodeStartupTimeout.Duration < minNodeStartupTimeout {
+		allErrs = append(allErrs, field.Invalid(
+			hPath.Child("nodeStartupTimeout"),
+			h.NodeStartupTimeout.Duration.String(),
+			fmt.Sprintf("must be at least %s", minNodeStartupTimeout),
+		))
+	}
+	return allErrs
+}
+
+// validateCNI checks the network plugin. It can't be replaced after the cluster
+// is created because pods keep the network set up by the previous one.
+func (r *Cluster) validateCNI(old *Cluster, allErrs field.ErrorList) field.ErrorList {
+	cni := r.Spec.Network.CNI
+	if cni == nil {
+		return allErrs
+	}
+	cniPath := field.NewPath("spec", "network", "cni")
+	switch cni.Provider {
+	case CalicoCNI, CiliumCNI:
+		_, err := version.ParseVersion(cni.Version)
+		if err != nil {
+			allErrs = append(allErrs, field.Invalid(cniPath.Child("version"), cni.Version, "version must to be a semantic versioning"))
+		}
+	case NoCNI:
+		if cni.Version != "" {
+			allErrs = append(allErrs, field.Forbidden(cniPath.Child("version"), "version can't be set when the CNI is provided by the user"))
+		}
+		if cni.Values != nil {
+			allErrs = append(allErrs, field.Forbidden(cniPath.Child("values"), "values can't be set when the CNI is provided by the user"))
+		}
+	default:
+		allErrs = append(allErrs, field.NotSupported(
+			cniPath.Child("provider"),
+			cni.Provider,
+			[]string{string(CalicoCNI), string(CiliumCNI), string(NoCNI)},
+		))
+	}
+	if cni.Values != nil {
+		values := make(map[string]interface{})
+		err := json.Unmarshal(cni.Values.Raw, &values)
+		if err != nil {
+			allErrs = append(allErrs, field.Invalid(cniPath.Child("values"), string(cni.Values.Raw), "values must be an object"))
+		}
+	}
+	if old == nil {
+		return allErrs
+	}
+	if cni.Provider != old.Spec.Network.GetCNI().Provider {
+		allErrs = append(allErrs, field.Invalid(cniPath.Child("provider"), cni.Provider, "field is immutable"))
+	}
+	return allErrs
+}
+
+// validateBackup checks the etcd snapshots schedule and destination.
+// Managed control planes have no etcd reachable by UnDistro.
+func (r *Cluster) validateBackup(allErrs field.ErrorList) field.ErrorList {
+	b := r.Spec.Backup
+	if b == nil {
+		return allErrs
+	}
+	backupPath := field.NewPath("spec", "backup")
+	if r.Spec.InfrastructureProvider.IsManaged() {
+		return append(allErrs, field.Forbidden(backupPath, "backup is not supported in managed clusters"))
+	}
+	if !isValidSchedule(b.Schedule) {
+		allErrs = append(allErrs, field.Invalid(backupPath.Child("schedule"), b.Schedule, "schedule must be in cron format"))
+	}
+	destPath := backupPath.Child("destination")
+	if b.Destination.Bucket == "" {
+		allErrs = append(allErrs, field.Required(destPath.Child("bucket"), "bucket is required"))
+	}
+	if b.Destination.Endpoint != "" {
+		u, err := url.Parse(b.Destination.Endpoint)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			allErrs = append(allErrs, field.Invalid(destPath.Child("endpoint"), b.Destination.Endpoint, "endpoint must be an http or https URL"))
+		}
+	}
+	if b.Destination.SecretRef != nil && b.Destination.SecretRef.Name == "" {
+		allErrs = append(allErrs, field.Required(destPath.Child("secretRef", "name"), "name is required"))
+	}
+	return allErrs
+}
+
+// isValidSchedule returns if the schedule has the 5 cron fields or is a predefined one like @daily
+func isValidSchedule(schedule string) bool {
+	if strings.HasPrefix(schedule, "@") {
+		switch schedule {
+		case "@yearly", "@annually", "@monthly", "@weekly", "@daily", "@midnight", "@hourly":
+			return true
+		}
+		return false
+	}
+	return len(strings.Fields(schedule)) == 5
+}
+
+// validateAddons checks the addon names and that their dependencies exist and have no cycles
+func (r *Cluster) validateAddons(allErrs field.ErrorList) field.ErrorList {
+	addonsPath := field.NewPath("spec", "addons")
+	deps := make(map[string][]string, len(r.Spec.Addons))
+	for i, a := range r.Spec.Addons {
+		namePath := addonsPath.Index(i).Child("name")
+		for _, msg := range validation.IsDNS1123Label(a.Name) {
+			allErrs = append(allErrs, field.Invalid(namePath, a.Name, msg))
+		}
+		// release names are used as label values
+		if len(r.AddonReleaseName(a.Name)) > validation.DNS1123LabelMaxLength {
+			allErrs = append(allErrs, field.Invalid(namePath, a.Name, fmt.Sprintf("%s must be no more than %d characters", r.AddonReleaseName(a.Name), validation.DNS1123LabelMaxLength)))
+		}
+		// the CNI releases are named after their provider
+		switch CNIProvider(a.Name) {
+		case CalicoCNI, CiliumCNI:
+			allErrs = append(allErrs, field.Invalid(namePath, a.Name, "name is reserved for the CNI"))
+		}
+		if a.Name == AutoscalerReleaseName {
+			allErrs = append(allErrs, field.Invalid(namePath, a.Name, "name is reserved for cluster-autoscaler"))
+		}
+		if _, ok := deps[a.Name]; ok {
+			allErrs = append(allErrs, field.Duplicate(namePath, a.Name))
+		}
+		deps[a.Name] = a.DependsOn
+		chartPath := addonsPath.Index(i).Child("chart")
+		if a.Chart.Git == nil {
+			if a.Chart.RepoURL == "" {
+				allErrs = append(allErrs, field.Required(chartPath.Child("repository"), "repository is required"))
+			}
+			if a.Chart.Name == "" {
+				allErrs = append(allErrs, field.Required(chartPath.Child("name"), "name is required"))
+			}
+			if a.Chart.Version == "" {
+				allErrs = append(allErrs, field.Required(chartPath.Child("version"), "version is required"))
+			}
+		}
+		allErrs = validateChartSource(chartPath, a.Chart, allErrs)
+		if a.Values != nil {
+			values := make(map[string]interface{})
+			err := json.Unmarshal(a.Values.Raw, &values)
+			if err != nil {
+				allErrs = append(allErrs, field.Invalid(addonsPath.Index(i).Child("values"), string(a.Values.Raw), "values must be an object"))
+			}
+		}
+	}
+	for i, a := range r.Spec.Addons {
+		for j, d := range a.DependsOn {
+			if _, ok := deps[d]; !ok {
+				allErrs = append(allErrs, field.NotFound(addonsPath.Index(i).Child("dependsOn").Index(j), d))
+			}
+		}
+		if dependsOn(deps, a.Name, a.Name, make(map[string]bool)) {
+			allErrs = append(allErrs, field.Invalid(addonsPath.Index(i).Child("dependsOn"), a.DependsOn, "addons can't depend on themselves"))
+		}
+	}
+	return allErrs
+}
+
+// dependsOn returns if the addon depends directly or transitively on the target
+func dependsOn(deps map[string][]string, addon, target string, visited map[string]bool) bool {
+	for _, d := range deps[addon] {
+		if d == target {
+			return true
+		}
+		if visited[d] {
+			continue
+		}
+		visited[d] = true
+		if dependsOn(deps, d, target, visited) {
+			return true
+		}
+	}
+	return false
+}
+
+// validateKubernetesUpgrade enforces the Kubernetes version skew policy.
+// The version is compared with the one running on the control plane,
+// so an upgrade in progress can't be retargeted to skip a minor version.
+func (r *Cluster) validateKubernetesUpgrade(old *Cluster, allErrs field.ErrorList) field.ErrorList {
+	if r.Spec.KubernetesVersion == old.Spec.KubernetesVersion {
+		return allErrs
+	}
+	current := old.Status.KubernetesVersion
+	if current == "" {
+		current = old.Spec.KubernetesVersion
+	}
+	from, err := version.ParseVersion(current)
+	if err != nil {
+		return allErrs
+	}
+	to, err := version.ParseVersion(r.Spec.KubernetesVersion)
+	if err != nil {
+		return allErrs
+	}
+	k8sPath := field.NewPath("spec", "kubernetesVersion")
+	switch {
+	case to.LessThan(from):
+		allErrs = append(allErrs, field.Invalid(
+			k8sPath,
+			r.Spec.KubernetesVersion,
+			fmt.Sprintf("downgrade from %s isn't supported", current),
+		))
+	case to.Major() != from.Major() || to.Minor() > from.Minor()+1:
+		allErrs = append(allErrs, field.Invalid(
+			k8sPath,
+			r.Spec.KubernetesVersion,
+			fmt.Sprintf("upgrade from %s can't skip minor versions", current),
+		))
+	}
 	return allErrs
 }
 
@@ -221,6 +952,39 @@ func (r *Cluster) ValidateCreate() error {
 	return r.validate(nil)
 }
 
+// validateProfile checks the profile exists and was merged. Another profile can only be
+// referenced after the reference is removed, so the generation merged is never mistaken.
+func (r *Cluster) validateProfile(old *Cluster, allErrs field.ErrorList) (field.ErrorList, error) {
+	ref := r.Spec.ProfileRef
+	path := field.NewPath("spec", "profileRef")
+	if old != nil && old.Spec.ProfileRef != nil && old.Spec.ProfileRef.Name != ref.Name {
+		return append(allErrs, field.Forbidden(
+			path.Child("name"),
+			"profile can't be changed, remove the profileRef before referencing another profile",
+		)), nil
+	}
+	p := ClusterProfile{}
+	key := client.ObjectKey{
+		Name:      ref.Name,
+		Namespace: r.GetNamespace(),
+	}
+	err := k8sClient.Get(context.TODO(), key, &p)
+	if apierrors.IsNotFound(err) {
+		return append(allErrs, field.NotFound(path.Child("name"), ref.Name)), nil
+	}
+	if err != nil {
+		return allErrs, err
+	}
+	if ref.Generation == 0 || ref.Generation > p.Generation {
+		allErrs = append(allErrs, field.Invalid(
+			path.Child("generation"),
+			ref.Generation,
+			fmt.Sprintf("must be a merged generation of profile %s, up to %d", ref.Name, p.Generation),
+		))
+	}
+	return allErrs, nil
+}
+
 // ValidateUpdate implements webhook.Validator so a webhook will be registered for the type
 func (r *Cluster) ValidateUpdate(old runtime.Object) error {
 	clusterlog.Info("validate update", "name", r.Name)
@@ -234,6 +998,13 @@ func (r *Cluster) ValidateUpdate(old runtime.Object) error {
 // ValidateDelete implements webhook.Validator so a webhook will be registered for the type
 func (r *Cluster) ValidateDelete() error {
 	clusterlog.Info("validate delete", "name", r.Name)
+	if r.Annotations[meta.ProtectAnnotation] == "true" {
+		return apierrors.NewForbidden(
+			GroupVersion.WithResource("clusters").GroupResource(),
+			r.Name,
+			fmt.Errorf("cluster is protected, remove the annotation %s to delete it", meta.ProtectAnnotation),
+		)
+	}
 	return nil
 }
 
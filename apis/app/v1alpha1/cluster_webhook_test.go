@@ -18,6 +18,15 @@ package v1alpha1
 
 import (
 	"testing"
+	"time"
+
+	"github.com/getupio-undistro/undistro/pkg/meta"
+	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	capi "sigs.k8s.io/cluster-api/api/v1alpha3"
 )
 
 func Test_isValidNameForAWS(t *testing.T) {
@@ -73,3 +82,922 @@ func Test_isValidNameForAWS(t *testing.T) {
 		})
 	}
 }
+
+func Test_validateOpenStack(t *testing.T) {
+	replicas := int32(1)
+	newCluster := func(cfg *OpenStackConfig) *Cluster {
+		return &Cluster{
+			Spec: ClusterSpec{
+				InfrastructureProvider: InfrastructureProvider{
+					Name:      OpenStack.String(),
+					Flavor:    Kubeadm.String(),
+					OpenStack: cfg,
+				},
+				ControlPlane: &ControlPlaneNode{
+					Node: Node{
+						Replicas:    &replicas,
+						MachineType: "m1.large",
+					},
+				},
+				Workers: []WorkerNode{
+					{
+						Node: Node{
+							Replicas:    &replicas,
+							MachineType: "m1.large",
+						},
+					},
+				},
+			},
+		}
+	}
+	tests := []struct {
+		name    string
+		cl      *Cluster
+		old     *Cluster
+		wantErr int
+	}{
+		{
+			name: "valid",
+			cl: newCluster(&OpenStackConfig{
+				CloudName:         "openstack",
+				ExternalNetworkID: "public",
+				Image:             "ubuntu-2004-kube-v1.20.6",
+			}),
+		},
+		{
+			name:    "missing openstack",
+			cl:      newCluster(nil),
+			wantErr: 1,
+		},
+		{
+			name:    "missing image and external network",
+			cl:      newCluster(&OpenStackConfig{CloudName: "openstack"}),
+			wantErr: 2,
+		},
+		{
+			name: "missing worker flavor",
+			cl: func() *Cluster {
+				cl := newCluster(&OpenStackConfig{
+					CloudName:         "openstack",
+					ExternalNetworkID: "public",
+					Image:             "ubuntu-2004-kube-v1.20.6",
+				})
+				cl.Spec.Workers[0].MachineType = ""
+				return cl
+			}(),
+			wantErr: 1,
+		},
+		{
+			name: "cloud name changed",
+			cl: newCluster(&OpenStackConfig{
+				CloudName:         "other",
+				ExternalNetworkID: "public",
+				Image:             "ubuntu-2004-kube-v1.20.6",
+			}),
+			old: newCluster(&OpenStackConfig{
+				CloudName:         "openstack",
+				ExternalNetworkID: "public",
+				Image:             "ubuntu-2004-kube-v1.20.6",
+			}),
+			wantErr: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.cl.validateOpenStack(tt.old, nil); len(got) != tt.wantErr {
+				t.Errorf("validateOpenStack() = %v, want %d errors", got, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_validateDocker(t *testing.T) {
+	enabled := true
+	tests := []struct {
+		name    string
+		spec    ClusterSpec
+		wantErr int
+	}{
+		{
+			name: "valid",
+		},
+		{
+			name: "bastion enabled",
+			spec: ClusterSpec{
+				Bastion: &Bastion{Enabled: &enabled},
+			},
+			wantErr: 1,
+		},
+		{
+			name: "vpc set",
+			spec: ClusterSpec{
+				Network: Network{
+					VPC: NetworkSpec{CIDRBlock: "10.0.0.0/16"},
+				},
+			},
+			wantErr: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cl := &Cluster{Spec: tt.spec}
+			if got := cl.validateDocker(nil); len(got) != tt.wantErr {
+				t.Errorf("validateDocker() = %v, want %d errors", got, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_validateVSphere(t *testing.T) {
+	replicas := int32(1)
+	newCluster := func(cfg *VSphereConfig, machineType string) *Cluster {
+		cl := &Cluster{
+			Spec: ClusterSpec{
+				InfrastructureProvider: InfrastructureProvider{
+					Name:    VSphere.String(),
+					Flavor:  Kubeadm.String(),
+					VSphere: cfg,
+				},
+				ControlPlane: &ControlPlaneNode{
+					Node: Node{
+						Replicas:    &replicas,
+						MachineType: machineType,
+					},
+				},
+				Workers: []WorkerNode{
+					{
+						Node: Node{
+							Replicas:    &replicas,
+							MachineType: machineType,
+						},
+					},
+				},
+			},
+		}
+		cl.Spec.ControlPlane.Endpoint.Host = "10.0.0.5"
+		return cl
+	}
+	valid := func() *VSphereConfig {
+		return &VSphereConfig{
+			Datacenter: "dc1",
+			Datastore:  "ds1",
+			Network:    "VM Network",
+			Template:   "ubuntu-2004-kube-v1.20.8",
+		}
+	}
+	tests := []struct {
+		name    string
+		cl      *Cluster
+		old     *Cluster
+		wantErr int
+	}{
+		{
+			name: "valid",
+			cl:   newCluster(valid(), "4cpu-8gb"),
+		},
+		{
+			name:    "missing vsphere",
+			cl:      newCluster(nil, "4cpu-8gb"),
+			wantErr: 1,
+		},
+		{
+			name:    "missing required fields",
+			cl:      newCluster(&VSphereConfig{}, "4cpu-8gb"),
+			wantErr: 4,
+		},
+		{
+			name:    "invalid machine type",
+			cl:      newCluster(valid(), "m5.large"),
+			wantErr: 2,
+		},
+		{
+			name: "missing endpoint",
+			cl: func() *Cluster {
+				cl := newCluster(valid(), "4cpu-8gb")
+				cl.Spec.ControlPlane.Endpoint.Host = ""
+				return cl
+			}(),
+			wantErr: 1,
+		},
+		{
+			name: "datastore changed",
+			cl: func() *Cluster {
+				cfg := valid()
+				cfg.Datastore = "ds2"
+				return newCluster(cfg, "4cpu-8gb")
+			}(),
+			old:     newCluster(valid(), "4cpu-8gb"),
+			wantErr: 1,
+		},
+		{
+			name: "template changed",
+			cl: func() *Cluster {
+				cfg := valid()
+				cfg.Template = "ubuntu-2004-kube-v1.21.2"
+				return newCluster(cfg, "4cpu-8gb")
+			}(),
+			old: newCluster(valid(), "4cpu-8gb"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.cl.validateVSphere(tt.old, nil); len(got) != tt.wantErr {
+				t.Errorf("validateVSphere() = %v, want %d errors", got, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_validateKubernetesUpgrade(t *testing.T) {
+	newCluster := func(spec, status string) *Cluster {
+		return &Cluster{
+			Spec: ClusterSpec{
+				KubernetesVersion: spec,
+			},
+			Status: ClusterStatus{
+				KubernetesVersion: status,
+			},
+		}
+	}
+	tests := []struct {
+		name    string
+		cl      *Cluster
+		old     *Cluster
+		wantErr int
+	}{
+		{
+			name: "unchanged",
+			cl:   newCluster("v1.20.8", ""),
+			old:  newCluster("v1.20.8", "v1.19.12"),
+		},
+		{
+			name: "patch upgrade",
+			cl:   newCluster("v1.20.8", ""),
+			old:  newCluster("v1.20.7", "v1.20.7"),
+		},
+		{
+			name: "minor upgrade",
+			cl:   newCluster("v1.21.2", ""),
+			old:  newCluster("v1.20.8", "v1.20.8"),
+		},
+		{
+			name: "minor upgrade without observed version",
+			cl:   newCluster("v1.21.2", ""),
+			old:  newCluster("v1.20.8", ""),
+		},
+		{
+			name:    "skip minor",
+			cl:      newCluster("v1.21.2", ""),
+			old:     newCluster("v1.19.12", "v1.19.12"),
+			wantErr: 1,
+		},
+		{
+			name:    "retarget upgrade in progress",
+			cl:      newCluster("v1.21.2", ""),
+			old:     newCluster("v1.20.8", "v1.19.12"),
+			wantErr: 1,
+		},
+		{
+			name:    "downgrade",
+			cl:      newCluster("v1.19.12", ""),
+			old:     newCluster("v1.20.8", "v1.20.8"),
+			wantErr: 1,
+		},
+		{
+			name:    "major upgrade",
+			cl:      newCluster("v2.0.0", ""),
+			old:     newCluster("v1.20.8", "v1.20.8"),
+			wantErr: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.cl.validateKubernetesUpgrade(tt.old, nil); len(got) != tt.wantErr {
+				t.Errorf("validateKubernetesUpgrade() = %v, want %d errors", got, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_validateAWSWorker(t *testing.T) {
+	wPath := field.NewPath("spec", "workers").Index(0)
+	tests := []struct {
+		name    string
+		flavor  string
+		w       WorkerNode
+		old     *WorkerNode
+		wantErr int
+	}{
+		{
+			name:   "ec2 custom disks",
+			flavor: EC2.String(),
+			w: WorkerNode{
+				ImageID:      "ami-0123456789abcdef0",
+				RootVolume:   &Volume{Size: 50, Type: "gp3", IOPS: 3000},
+				DataVolumes:  []Volume{{Size: 500, Type: "st1", DeviceName: "/dev/sdb"}},
+				CapacityType: SpotCapacity,
+			},
+		},
+		{
+			name:    "ec2 invalid image",
+			flavor:  EC2.String(),
+			w:       WorkerNode{ImageID: "ubuntu"},
+			wantErr: 1,
+		},
+		{
+			name:    "ec2 small root volume",
+			flavor:  EC2.String(),
+			w:       WorkerNode{RootVolume: &Volume{Size: 4}},
+			wantErr: 1,
+		},
+		{
+			name:    "ec2 volume type",
+			flavor:  EC2.String(),
+			w:       WorkerNode{RootVolume: &Volume{Size: 20, Type: "ssd"}},
+			wantErr: 1,
+		},
+		{
+			name:    "ec2 iops",
+			flavor:  EC2.String(),
+			w:       WorkerNode{RootVolume: &Volume{Size: 20, Type: "io1"}, DataVolumes: []Volume{{Size: 20, Type: "gp2", IOPS: 100, DeviceName: "/dev/sdb"}}},
+			wantErr: 2,
+		},
+		{
+			name:   "ec2 data volume devices",
+			flavor: EC2.String(),
+			w: WorkerNode{DataVolumes: []Volume{
+				{Size: 20, DeviceName: "/dev/sdb"},
+				{Size: 20, DeviceName: "/dev/sdb"},
+				{Size: 20},
+			}},
+			wantErr: 2,
+		},
+		{
+			name:    "ec2 data volumes added to pool",
+			flavor:  EC2.String(),
+			w:       WorkerNode{DataVolumes: []Volume{{Size: 20, DeviceName: "/dev/sdb"}}},
+			old:     &WorkerNode{},
+			wantErr: 1,
+		},
+		{
+			name:   "ec2 data volumes changed",
+			flavor: EC2.String(),
+			w:      WorkerNode{DataVolumes: []Volume{{Size: 40, DeviceName: "/dev/sdb"}}},
+			old:    &WorkerNode{DataVolumes: []Volume{{Size: 20, DeviceName: "/dev/sdb"}}},
+		},
+		{
+			name:   "ec2 spot with fallback",
+			flavor: EC2.String(),
+			w: WorkerNode{
+				Node:                 Node{MachineType: "m5.large"},
+				CapacityType:         SpotCapacity,
+				FallbackMachineTypes: []string{"m5a.large", "m4.large"},
+			},
+		},
+		{
+			name:   "ec2 duplicated fallback",
+			flavor: EC2.String(),
+			w: WorkerNode{
+				Node:                 Node{MachineType: "m5.large"},
+				FallbackMachineTypes: []string{"m5a.large", "m5.large", "m5a.large"},
+			},
+			wantErr: 2,
+		},
+		{
+			name:   "ec2 fallback with data volumes",
+			flavor: EC2.String(),
+			w: WorkerNode{
+				Node:                 Node{MachineType: "m5.large"},
+				DataVolumes:          []Volume{{Size: 20, DeviceName: "/dev/sdb"}},
+				FallbackMachineTypes: []string{"m5a.large"},
+			},
+			wantErr: 1,
+		},
+		{
+			name:    "eks fallback",
+			flavor:  EKS.String(),
+			w:       WorkerNode{FallbackMachineTypes: []string{"m5a.large"}},
+			wantErr: 1,
+		},
+		{
+			name:   "eks root volume size",
+			flavor: EKS.String(),
+			w:      WorkerNode{RootVolume: &Volume{Size: 50}},
+		},
+		{
+			name:   "eks unsupported",
+			flavor: EKS.String(),
+			w: WorkerNode{
+				ImageID:      "ami-0123456789abcdef0",
+				RootVolume:   &Volume{Size: 50, Type: "gp3"},
+				DataVolumes:  []Volume{{Size: 500, DeviceName: "/dev/sdb"}},
+				CapacityType: SpotCapacity,
+			},
+			wantErr: 4,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cl := &Cluster{
+				Spec: ClusterSpec{
+					InfrastructureProvider: InfrastructureProvider{
+						Name:   Amazon.String(),
+						Flavor: tt.flavor,
+					},
+				},
+			}
+			if got := cl.validateAWSWorker(wPath, tt.w, tt.old, nil); len(got) != tt.wantErr {
+				t.Errorf("validateAWSWorker() = %v, want %d errors", got, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_validateAutoscaling(t *testing.T) {
+	replicas := func(r int32) *int32 {
+		return &r
+	}
+	wPath := field.NewPath("spec", "workers").Index(0)
+	tests := []struct {
+		name    string
+		w       WorkerNode
+		wantErr int
+	}{
+		{
+			name: "disabled",
+			w: WorkerNode{
+				Node:      Node{Replicas: replicas(5)},
+				Autoscale: Autoscaling{MinSize: 3, MaxSize: 1},
+			},
+		},
+		{
+			name: "valid",
+			w: WorkerNode{
+				Node:      Node{Replicas: replicas(2)},
+				Autoscale: Autoscaling{Enabled: true, MinSize: 1, MaxSize: 5},
+			},
+		},
+		{
+			name: "min greater than max",
+			w: WorkerNode{
+				Node:      Node{Replicas: replicas(2)},
+				Autoscale: Autoscaling{Enabled: true, MinSize: 3, MaxSize: 2},
+			},
+			wantErr: 1,
+		},
+		{
+			name: "replicas below min",
+			w: WorkerNode{
+				Node:      Node{Replicas: replicas(1)},
+				Autoscale: Autoscaling{Enabled: true, MinSize: 2, MaxSize: 5},
+			},
+			wantErr: 1,
+		},
+		{
+			name: "replicas above max",
+			w: WorkerNode{
+				Node:      Node{Replicas: replicas(6)},
+				Autoscale: Autoscaling{Enabled: true, MinSize: 2, MaxSize: 5},
+			},
+			wantErr: 1,
+		},
+		{
+			name: "zero max",
+			w: WorkerNode{
+				Node:      Node{Replicas: replicas(0)},
+				Autoscale: Autoscaling{Enabled: true},
+			},
+			wantErr: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := validateAutoscaling(wPath, tt.w, nil); len(got) != tt.wantErr {
+				t.Errorf("validateAutoscaling() = %v, want %d errors", got, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_validateAWSAutoscaling(t *testing.T) {
+	dataVolumes := []Volume{{Size: 20, DeviceName: "/dev/sdb"}}
+	autoscale := Autoscaling{Enabled: true, MinSize: 1, MaxSize: 5}
+	tests := []struct {
+		name    string
+		workers []WorkerNode
+		wantErr int
+	}{
+		{
+			name:    "machine pools",
+			workers: []WorkerNode{{Autoscale: autoscale}, {Autoscale: autoscale}},
+		},
+		{
+			name:    "machine deployments",
+			workers: []WorkerNode{{Autoscale: autoscale, DataVolumes: dataVolumes}, {Autoscale: autoscale, DataVolumes: dataVolumes}},
+		},
+		{
+			name:    "machine deployment not autoscaled",
+			workers: []WorkerNode{{Autoscale: autoscale}, {DataVolumes: dataVolumes}},
+		},
+		{
+			name:    "machine pool and machine deployment",
+			workers: []WorkerNode{{Autoscale: autoscale}, {Autoscale: autoscale, DataVolumes: dataVolumes}, {Autoscale: autoscale}},
+			wantErr: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cl := &Cluster{}
+			cl.Spec.Workers = tt.workers
+			if got := cl.validateAWSAutoscaling(nil); len(got) != tt.wantErr {
+				t.Errorf("validateAWSAutoscaling() = %v, want %d errors", got, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_validateCNI(t *testing.T) {
+	cluster := func(cni *CNI) *Cluster {
+		cl := &Cluster{}
+		cl.Spec.Network.CNI = cni
+		return cl
+	}
+	tests := []struct {
+		name    string
+		cl      *Cluster
+		old     *Cluster
+		wantErr int
+	}{
+		{
+			name: "cilium",
+			cl:   cluster(&CNI{Provider: CiliumCNI, Version: "1.10.4", Values: &apiextensionsv1.JSON{Raw: []byte(`{"hubble":{"enabled":true}}`)}}),
+		},
+		{
+			name:    "invalid version",
+			cl:      cluster(&CNI{Provider: CalicoCNI, Version: "latest"}),
+			wantErr: 1,
+		},
+		{
+			name:    "values not an object",
+			cl:      cluster(&CNI{Provider: CalicoCNI, Version: "3.19.1", Values: &apiextensionsv1.JSON{Raw: []byte(`[]`)}}),
+			wantErr: 1,
+		},
+		{
+			name:    "none with version",
+			cl:      cluster(&CNI{Provider: NoCNI, Version: "1.0.0"}),
+			wantErr: 1,
+		},
+		{
+			name:    "unknown provider",
+			cl:      cluster(&CNI{Provider: "flannel"}),
+			wantErr: 1,
+		},
+		{
+			name: "version update",
+			cl:   cluster(&CNI{Provider: CalicoCNI, Version: "3.20.0"}),
+			old:  cluster(&CNI{Provider: CalicoCNI, Version: "3.19.1"}),
+		},
+		{
+			name:    "provider change",
+			cl:      cluster(&CNI{Provider: CiliumCNI, Version: "1.10.4"}),
+			old:     cluster(&CNI{Provider: CalicoCNI, Version: "3.19.1"}),
+			wantErr: 1,
+		},
+		{
+			name: "calico set in legacy cluster",
+			cl:   cluster(&CNI{Provider: CalicoCNI, Version: "3.19.1"}),
+			old:  cluster(nil),
+		},
+		{
+			name:    "none set in legacy cluster",
+			cl:      cluster(&CNI{Provider: NoCNI}),
+			old:     cluster(nil),
+			wantErr: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.cl.validateCNI(tt.old, nil); len(got) != tt.wantErr {
+				t.Errorf("validateCNI() = %v, want %d errors", got, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_validateWorkerNames(t *testing.T) {
+	cluster := func(names ...string) *Cluster {
+		cl := &Cluster{}
+		cl.Name = "test"
+		for _, n := range names {
+			cl.Spec.Workers = append(cl.Spec.Workers, WorkerNode{Name: n})
+		}
+		return cl
+	}
+	tests := []struct {
+		name    string
+		cl      *Cluster
+		old     *Cluster
+		wantErr int
+	}{
+		{
+			name: "named pools",
+			cl:   cluster("general", "gpu"),
+		},
+		{
+			name:    "missing name",
+			cl:      cluster("general", ""),
+			wantErr: 1,
+		},
+		{
+			name:    "duplicated name",
+			cl:      cluster("general", "general"),
+			wantErr: 1,
+		},
+		{
+			name:    "invalid name",
+			cl:      cluster("General"),
+			wantErr: 1,
+		},
+		{
+			name:    "too long",
+			cl:      cluster("a-very-long-worker-pool-name-that-does-not-fit-in-a-label"),
+			wantErr: 1,
+		},
+		{
+			name: "middle pool removed",
+			cl:   cluster("general", "gpu"),
+			old:  cluster("general", "infra", "gpu"),
+		},
+		{
+			name: "pools reordered",
+			cl:   cluster("gpu", "general"),
+			old:  cluster("general", "gpu"),
+		},
+		{
+			name: "pool added",
+			cl:   cluster("general", "gpu"),
+			old:  cluster("general"),
+		},
+		{
+			name:    "pool renamed",
+			cl:      cluster("general", "accelerated"),
+			old:     cluster("general", "gpu"),
+			wantErr: 1,
+		},
+		{
+			name: "legacy pools migrated",
+			cl:   cluster("0", "1"),
+			old:  cluster("", ""),
+		},
+		{
+			name:    "legacy pool renamed",
+			cl:      cluster("general", "1"),
+			old:     cluster("", ""),
+			wantErr: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.cl.validateWorkerNames(tt.old, nil); len(got) != tt.wantErr {
+				t.Errorf("validateWorkerNames() = %v, want %d errors", got, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCluster_defaultWorkerNames(t *testing.T) {
+	cl := &Cluster{}
+	cl.CreationTimestamp = metav1.Now()
+	cl.Spec.Workers = []WorkerNode{{}, {}}
+	cl.defaultWorkerNames()
+	if cl.Spec.Workers[0].Name != "0" || cl.Spec.Workers[1].Name != "1" {
+		t.Errorf("defaultWorkerNames() = %v, want pools named by index", cl.Spec.Workers)
+	}
+	// a legacy cluster adding a named pool in the same update
+	cl.Spec.Workers = []WorkerNode{{}, {}, {Name: "gpu"}}
+	cl.defaultWorkerNames()
+	if cl.Spec.Workers[0].Name != "0" || cl.Spec.Workers[1].Name != "1" || cl.Spec.Workers[2].Name != "gpu" {
+		t.Errorf("defaultWorkerNames() = %v, want unnamed pools named by index", cl.Spec.Workers)
+	}
+	if errs := cl.validateWorkerNames(nil, nil); len(errs) > 0 {
+		t.Errorf("validateWorkerNames() = %v, want no errors", errs)
+	}
+	cl = &Cluster{}
+	cl.Spec.Workers = []WorkerNode{{}}
+	cl.defaultWorkerNames()
+	if cl.Spec.Workers[0].Name != "" {
+		t.Errorf("defaultWorkerNames() named the pool of a new cluster %q", cl.Spec.Workers[0].Name)
+	}
+}
+
+func TestCluster_ValidateDelete(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		wantErr     bool
+	}{
+		{
+			name: "not protected",
+		},
+		{
+			name:        "protected",
+			annotations: map[string]string{meta.ProtectAnnotation: "true"},
+			wantErr:     true,
+		},
+		{
+			name:        "protection disabled",
+			annotations: map[string]string{meta.ProtectAnnotation: "false"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cl := &Cluster{}
+			cl.Annotations = tt.annotations
+			if err := cl.ValidateDelete(); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateDelete() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_validateHealthCheck(t *testing.T) {
+	percent := intstr.FromString("40%")
+	invalid := intstr.FromString("some")
+	negative := intstr.FromInt(-1)
+	tests := []struct {
+		name    string
+		h       *HealthCheckPolicy
+		wantErr int
+	}{
+		{
+			name: "no policy",
+		},
+		{
+			name: "valid",
+			h: &HealthCheckPolicy{
+				UnhealthyConditions: []capi.UnhealthyCondition{{Type: corev1.NodeReady, Status: corev1.ConditionFalse, Timeout: metav1.Duration{Duration: time.Minute}}},
+				MaxUnhealthy:        &percent,
+				NodeStartupTimeout:  &metav1.Duration{Duration: 10 * time.Minute},
+			},
+		},
+		{
+			name: "condition without status",
+			h: &HealthCheckPolicy{
+				UnhealthyConditions: []capi.UnhealthyCondition{{Type: corev1.NodeReady}},
+			},
+			wantErr: 1,
+		},
+		{
+			name:    "invalid max unhealthy",
+			h:       &HealthCheckPolicy{MaxUnhealthy: &invalid},
+			wantErr: 1,
+		},
+		{
+			name:    "negative max unhealthy",
+			h:       &HealthCheckPolicy{MaxUnhealthy: &negative},
+			wantErr: 1,
+		},
+		{
+			name:    "short node startup timeout",
+			h:       &HealthCheckPolicy{NodeStartupTimeout: &metav1.Duration{Duration: time.Second}},
+			wantErr: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := validateHealthCheck(field.NewPath("spec", "controlPlane", "healthCheck"), tt.h, nil); len(got) != tt.wantErr {
+				t.Errorf("validateHealthCheck() = %v, want %d errors", got, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_validateBackup(t *testing.T) {
+	cluster := func(infra string, b *Backup) *Cluster {
+		cl := &Cluster{}
+		cl.Spec.InfrastructureProvider.Name = infra
+		cl.Spec.InfrastructureProvider.Flavor = "ec2"
+		cl.Spec.Backup = b
+		return cl
+	}
+	tests := []struct {
+		name    string
+		cl      *Cluster
+		wantErr int
+	}{
+		{
+			name: "no backup",
+			cl:   cluster("aws", nil),
+		},
+		{
+			name: "minio",
+			cl: cluster("aws", &Backup{
+				Schedule: "0 */6 * * *",
+				Destination: BackupDestination{
+					Bucket:    "backups",
+					Endpoint:  "http://minio.minio.svc:9000",
+					SecretRef: &corev1.LocalObjectReference{Name: "minio"},
+				},
+			}),
+		},
+		{
+			name: "predefined schedule",
+			cl:   cluster("aws", &Backup{Schedule: "@daily", Destination: BackupDestination{Bucket: "backups"}}),
+		},
+		{
+			name:    "invalid schedule",
+			cl:      cluster("aws", &Backup{Schedule: "every day", Destination: BackupDestination{Bucket: "backups"}}),
+			wantErr: 1,
+		},
+		{
+			name:    "without bucket",
+			cl:      cluster("aws", &Backup{Schedule: "@hourly"}),
+			wantErr: 1,
+		},
+		{
+			name:    "invalid endpoint",
+			cl:      cluster("aws", &Backup{Schedule: "@hourly", Destination: BackupDestination{Bucket: "backups", Endpoint: "minio:9000"}}),
+			wantErr: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.cl.validateBackup(nil); len(got) != tt.wantErr {
+				t.Errorf("validateBackup() = %v, want %d errors", got, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_validateAddons(t *testing.T) {
+	addon := func(name string, dependsOn ...string) Addon {
+		return Addon{
+			Name: name,
+			Chart: ChartSource{
+				RepoChartSource: RepoChartSource{
+					RepoURL: "https://charts.example.com",
+					Name:    name,
+					Version: "1.0.0",
+				},
+			},
+			DependsOn: dependsOn,
+		}
+	}
+	cluster := func(addons ...Addon) *Cluster {
+		cl := &Cluster{}
+		cl.Name = "test"
+		cl.Spec.Addons = addons
+		return cl
+	}
+	tests := []struct {
+		name    string
+		cl      *Cluster
+		wantErr int
+	}{
+		{
+			name: "no addons",
+			cl:   cluster(),
+		},
+		{
+			name: "ordered",
+			cl:   cluster(addon("cert-manager"), addon("ingress", "cert-manager"), addon("metrics-server")),
+		},
+		{
+			name:    "duplicated",
+			cl:      cluster(addon("ingress"), addon("ingress")),
+			wantErr: 1,
+		},
+		{
+			name:    "reserved name",
+			cl:      cluster(addon("calico")),
+			wantErr: 1,
+		},
+		{
+			name:    "autoscaler name",
+			cl:      cluster(addon("cluster-autoscaler")),
+			wantErr: 1,
+		},
+		{
+			name:    "unknown dependency",
+			cl:      cluster(addon("ingress", "cert-manager")),
+			wantErr: 1,
+		},
+		{
+			name:    "cycle",
+			cl:      cluster(addon("a", "b"), addon("b", "c"), addon("c", "a")),
+			wantErr: 3,
+		},
+		{
+			name:    "without version",
+			cl:      cluster(Addon{Name: "ingress", Chart: ChartSource{RepoChartSource: RepoChartSource{RepoURL: "https://charts.example.com", Name: "ingress"}}}),
+			wantErr: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.cl.validateAddons(nil); len(got) != tt.wantErr {
+				t.Errorf("validateAddons() = %v, want %d errors", got, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,383 @@
+/*
+Copyright 2020-2021 The UnDistro authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"encoding/json"
+	"reflect"
+
+	"github.com/getupio-undistro/undistro/pkg/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	capi "sigs.k8s.io/cluster-api/api/v1alpha3"
+)
+
+// ClusterProfileSpec defines the desired state of ClusterProfile.
+// Its fields are defaults for the clusters referencing the profile.
+type ClusterProfileSpec struct {
+	Network      *Network          `json:"network,omitempty"`
+	Bastion      *Bastion          `json:"bastion,omitempty"`
+	ControlPlane *ControlPlaneNode `json:"controlPlane,omitempty"`
+	// Workers are added to the clusters without a worker pool of the same name
+	// and fill the unset fields of the ones with it
+	Workers []WorkerNode `json:"workers,omitempty"`
+	// Addons are added to the clusters without an addon of the same name
+	Addons []Addon `json:"addons,omitempty"`
+}
+
+// ProfileReference selects the ClusterProfile merged into the cluster
+type ProfileReference struct {
+	Name string `json:"name"`
+	// Generation of the profile merged into the cluster, set when it's merged.
+	// The profile is only merged again when it's cleared, so profile changes are rolled out deliberately.
+	Generation int64 `json:"generation,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp",description=""
+
+// ClusterProfile is the Schema for the clusterprofiles API
+type ClusterProfile struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec ClusterProfileSpec `json:"spec,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// ClusterProfileList contains a list of ClusterProfile
+type ClusterProfileList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ClusterProfile `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&ClusterProfile{}, &ClusterProfileList{})
+}
+
+// Merge fills the fields unset in the cluster with the ones of the profile.
+// Fields set in the cluster take precedence over the profile, except the ones still
+// equal to the profile merged before, recorded in the AppliedProfileAnnotation,
+// which take the values of this profile.
+func (p *ClusterProfile) Merge(cl *Cluster) {
+	applied := ClusterProfileSpec{}
+	if err := json.Unmarshal([]byte(cl.Annotations[meta.AppliedProfileAnnotation]), &applied); err == nil {
+		unmerge(cl, &applied)
+	}
+	appliedWorkers := make(map[string]bool, len(applied.Workers))
+	for _, w := range applied.Workers {
+		appliedWorkers[w.Name] = true
+	}
+	spec := p.Spec.DeepCopy()
+	if spec.Network != nil {
+		mergeNetwork(&cl.Spec.Network, spec.Network)
+	}
+	if cl.Spec.Bastion == nil {
+		cl.Spec.Bastion = spec.Bastion
+	} else if spec.Bastion != nil {
+		mergeBastion(cl.Spec.Bastion, spec.Bastion)
+	}
+	if cl.Spec.ControlPlane == nil {
+		cl.Spec.ControlPlane = spec.ControlPlane
+	} else if spec.ControlPlane != nil {
+		mergeNode(&cl.Spec.ControlPlane.Node, &spec.ControlPlane.Node)
+		if cl.Spec.ControlPlane.Endpoint.IsZero() {
+			cl.Spec.ControlPlane.Endpoint = spec.ControlPlane.Endpoint
+		}
+		cl.Spec.ControlPlane.InternalLB = cl.Spec.ControlPlane.InternalLB || spec.ControlPlane.InternalLB
+		if cl.Spec.ControlPlane.HealthCheck == nil {
+			cl.Spec.ControlPlane.HealthCheck = spec.ControlPlane.HealthCheck
+		}
+	}
+	for _, pw := range spec.Workers {
+		found := false
+		for i := range cl.Spec.Workers {
+			if cl.Spec.Workers[i].Name == pw.Name {
+				mergeWorker(&cl.Spec.Workers[i], &pw)
+				found = true
+				break
+			}
+		}
+		if !found {
+			cl.Spec.Workers = append(cl.Spec.Workers, pw)
+		}
+	}
+	for _, pa := range spec.Addons {
+		found := false
+		for _, a := range cl.Spec.Addons {
+			if a.Name == pa.Name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			cl.Spec.Addons = append(cl.Spec.Addons, pa)
+		}
+	}
+	// pools of the applied profile left with only the name were removed from this one
+	workers := cl.Spec.Workers[:0]
+	for _, w := range cl.Spec.Workers {
+		if !appliedWorkers[w.Name] || !reflect.DeepEqual(w, WorkerNode{Name: w.Name}) {
+			workers = append(workers, w)
+		}
+	}
+	cl.Spec.Workers = workers
+	b, err := json.Marshal(p.Spec)
+	if err != nil {
+		return
+	}
+	if cl.Annotations == nil {
+		cl.Annotations = make(map[string]string)
+	}
+	cl.Annotations[meta.AppliedProfileAnnotation] = string(b)
+}
+
+// unmerge clears the cluster fields still equal to the applied profile,
+// so they're filled by the profile merged next.
+func unmerge(cl *Cluster, applied *ClusterProfileSpec) {
+	if applied.Network != nil {
+		unmergeNetwork(&cl.Spec.Network, applied.Network)
+	}
+	if applied.Bastion != nil && cl.Spec.Bastion != nil {
+		if reflect.DeepEqual(cl.Spec.Bastion, applied.Bastion) {
+			cl.Spec.Bastion = nil
+		} else {
+			unmergeBastion(cl.Spec.Bastion, applied.Bastion)
+		}
+	}
+	if applied.ControlPlane != nil && cl.Spec.ControlPlane != nil {
+		if reflect.DeepEqual(cl.Spec.ControlPlane, applied.ControlPlane) {
+			cl.Spec.ControlPlane = nil
+		} else {
+			unmergeNode(&cl.Spec.ControlPlane.Node, &applied.ControlPlane.Node)
+			if cl.Spec.ControlPlane.Endpoint == applied.ControlPlane.Endpoint {
+				cl.Spec.ControlPlane.Endpoint = capi.APIEndpoint{}
+			}
+			if applied.ControlPlane.InternalLB {
+				cl.Spec.ControlPlane.InternalLB = false
+			}
+			if reflect.DeepEqual(cl.Spec.ControlPlane.HealthCheck, applied.ControlPlane.HealthCheck) {
+				cl.Spec.ControlPlane.HealthCheck = nil
+			}
+		}
+	}
+	for _, aw := range applied.Workers {
+		for i := range cl.Spec.Workers {
+			if cl.Spec.Workers[i].Name == aw.Name {
+				unmergeWorker(&cl.Spec.Workers[i], &aw)
+				break
+			}
+		}
+	}
+	addons := cl.Spec.Addons[:0]
+	for _, a := range cl.Spec.Addons {
+		fromProfile := false
+		for _, aa := range applied.Addons {
+			if reflect.DeepEqual(a, aa) {
+				fromProfile = true
+				break
+			}
+		}
+		if !fromProfile {
+			addons = append(addons, a)
+		}
+	}
+	cl.Spec.Addons = addons
+}
+
+func unmergeNetwork(dst, src *Network) {
+	if dst.VPC == src.VPC {
+		dst.VPC = NetworkSpec{}
+	}
+	if reflect.DeepEqual(dst.Subnets, src.Subnets) {
+		dst.Subnets = nil
+	}
+	if src.MultiZone {
+		dst.MultiZone = false
+	}
+	if reflect.DeepEqual(dst.CNI, src.CNI) {
+		dst.CNI = nil
+	}
+}
+
+func unmergeBastion(dst, src *Bastion) {
+	if reflect.DeepEqual(dst.Enabled, src.Enabled) {
+		dst.Enabled = nil
+	}
+	if src.DisableIngressRules {
+		dst.DisableIngressRules = false
+	}
+	if reflect.DeepEqual(dst.AllowedCIDRBlocks, src.AllowedCIDRBlocks) {
+		dst.AllowedCIDRBlocks = nil
+	}
+	if dst.InstanceType == src.InstanceType {
+		dst.InstanceType = ""
+	}
+}
+
+func unmergeNode(dst, src *Node) {
+	if reflect.DeepEqual(dst.Replicas, src.Replicas) {
+		dst.Replicas = nil
+	}
+	if dst.MachineType == src.MachineType {
+		dst.MachineType = ""
+	}
+	if dst.Subnet == src.Subnet {
+		dst.Subnet = ""
+	}
+	if reflect.DeepEqual(dst.Taints, src.Taints) {
+		dst.Taints = nil
+	}
+	dst.Labels = unmergeStringMaps(dst.Labels, src.Labels)
+	dst.ProviderTags = unmergeStringMaps(dst.ProviderTags, src.ProviderTags)
+}
+
+func unmergeWorker(dst, src *WorkerNode) {
+	unmergeNode(&dst.Node, &src.Node)
+	if dst.Autoscale == src.Autoscale {
+		dst.Autoscale = Autoscaling{}
+	}
+	if src.InfraNode {
+		dst.InfraNode = false
+	}
+	if dst.LaunchTemplateReference == src.LaunchTemplateReference {
+		dst.LaunchTemplateReference = LaunchTemplateReference{}
+	}
+	if dst.ImageID == src.ImageID {
+		dst.ImageID = ""
+	}
+	if reflect.DeepEqual(dst.RootVolume, src.RootVolume) {
+		dst.RootVolume = nil
+	}
+	if reflect.DeepEqual(dst.DataVolumes, src.DataVolumes) {
+		dst.DataVolumes = nil
+	}
+	if dst.CapacityType == src.CapacityType {
+		dst.CapacityType = ""
+	}
+	if reflect.DeepEqual(dst.FallbackMachineTypes, src.FallbackMachineTypes) {
+		dst.FallbackMachineTypes = nil
+	}
+	if reflect.DeepEqual(dst.HealthCheck, src.HealthCheck) {
+		dst.HealthCheck = nil
+	}
+}
+
+// unmergeStringMaps returns dst without the keys holding the value of src
+func unmergeStringMaps(dst, src map[string]string) map[string]string {
+	if len(src) == 0 {
+		return dst
+	}
+	for k, v := range src {
+		if dst[k] == v {
+			delete(dst, k)
+		}
+	}
+	if len(dst) == 0 {
+		return nil
+	}
+	return dst
+}
+
+func mergeNetwork(dst, src *Network) {
+	if dst.VPC == (NetworkSpec{}) {
+		dst.VPC = src.VPC
+	}
+	if len(dst.Subnets) == 0 {
+		dst.Subnets = src.Subnets
+	}
+	dst.MultiZone = dst.MultiZone || src.MultiZone
+	if dst.CNI == nil {
+		dst.CNI = src.CNI
+	}
+}
+
+func mergeBastion(dst, src *Bastion) {
+	if dst.Enabled == nil {
+		dst.Enabled = src.Enabled
+	}
+	dst.DisableIngressRules = dst.DisableIngressRules || src.DisableIngressRules
+	if len(dst.AllowedCIDRBlocks) == 0 {
+		dst.AllowedCIDRBlocks = src.AllowedCIDRBlocks
+	}
+	if dst.InstanceType == "" {
+		dst.InstanceType = src.InstanceType
+	}
+}
+
+func mergeNode(dst, src *Node) {
+	if dst.Replicas == nil {
+		dst.Replicas = src.Replicas
+	}
+	if dst.MachineType == "" {
+		dst.MachineType = src.MachineType
+	}
+	if dst.Subnet == "" {
+		dst.Subnet = src.Subnet
+	}
+	if len(dst.Taints) == 0 {
+		dst.Taints = src.Taints
+	}
+	dst.Labels = mergeStringMaps(dst.Labels, src.Labels)
+	dst.ProviderTags = mergeStringMaps(dst.ProviderTags, src.ProviderTags)
+}
+
+func mergeWorker(dst, src *WorkerNode) {
+	mergeNode(&dst.Node, &src.Node)
+	if dst.Autoscale == (Autoscaling{}) {
+		dst.Autoscale = src.Autoscale
+	}
+	dst.InfraNode = dst.InfraNode || src.InfraNode
+	if dst.LaunchTemplateReference == (LaunchTemplateReference{}) {
+		dst.LaunchTemplateReference = src.LaunchTemplateReference
+	}
+	if dst.ImageID == "" {
+		dst.ImageID = src.ImageID
+	}
+	if dst.RootVolume == nil {
+		dst.RootVolume = src.RootVolume
+	}
+	if len(dst.DataVolumes) == 0 {
+		dst.DataVolumes = src.DataVolumes
+	}
+	if dst.CapacityType == "" {
+		dst.CapacityType = src.CapacityType
+	}
+	if len(dst.FallbackMachineTypes) == 0 {
+		dst.FallbackMachineTypes = src.FallbackMachineTypes
+	}
+	if dst.HealthCheck == nil {
+		dst.HealthCheck = src.HealthCheck
+	}
+}
+
+// mergeStringMaps returns dst with the keys of src it doesn't have
+func mergeStringMaps(dst, src map[string]string) map[string]string {
+	if len(src) == 0 {
+		return dst
+	}
+	if dst == nil {
+		dst = make(map[string]string, len(src))
+	}
+	for k, v := range src {
+		if _, ok := dst[k]; !ok {
+			dst[k] = v
+		}
+	}
+	return dst
+}
@@ -0,0 +1,150 @@
+/*
+Copyright 2020-2021 The UnDistro authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/utils/pointer"
+)
+
+func TestClusterProfile_Merge(t *testing.T) {
+	p := &ClusterProfile{
+		Spec: ClusterProfileSpec{
+			Network: &Network{
+				VPC: NetworkSpec{CIDRBlock: "10.0.0.0/16"},
+				CNI: &CNI{Provider: CiliumCNI},
+			},
+			ControlPlane: &ControlPlaneNode{
+				Node: Node{
+					Replicas:    pointer.Int32Ptr(3),
+					MachineType: "t3.large",
+					Labels:      map[string]string{"tier": "cp", "team": "infra"},
+				},
+			},
+			Workers: []WorkerNode{
+				{Name: "general", Node: Node{Replicas: pointer.Int32Ptr(3), MachineType: "t3.large"}},
+				{Name: "infra", Node: Node{Replicas: pointer.Int32Ptr(2), MachineType: "t3.xlarge"}, InfraNode: true},
+			},
+			Addons: []Addon{
+				{Name: "metrics-server", TargetNamespace: "kube-system"},
+				{Name: "cert-manager"},
+			},
+		},
+	}
+	cl := &Cluster{}
+	cl.Spec.ControlPlane = &ControlPlaneNode{
+		Node: Node{
+			MachineType: "t3.medium",
+			Labels:      map[string]string{"tier": "control-plane"},
+		},
+	}
+	cl.Spec.Workers = []WorkerNode{
+		{Name: "general", Node: Node{Replicas: pointer.Int32Ptr(5)}},
+	}
+	cl.Spec.Addons = []Addon{
+		{Name: "cert-manager", TargetNamespace: "certs"},
+	}
+	p.Merge(cl)
+
+	if cl.Spec.Network.VPC.CIDRBlock != "10.0.0.0/16" || cl.Spec.Network.CNI == nil || cl.Spec.Network.CNI.Provider != CiliumCNI {
+		t.Errorf("network = %+v, want the profile one", cl.Spec.Network)
+	}
+	cp := cl.Spec.ControlPlane
+	if *cp.Replicas != 3 || cp.MachineType != "t3.medium" {
+		t.Errorf("control plane = %d %s, want 3 t3.medium", *cp.Replicas, cp.MachineType)
+	}
+	wantLabels := map[string]string{"tier": "control-plane", "team": "infra"}
+	if !reflect.DeepEqual(cp.Labels, wantLabels) {
+		t.Errorf("control plane labels = %v, want %v", cp.Labels, wantLabels)
+	}
+	if len(cl.Spec.Workers) != 2 {
+		t.Fatalf("got %d workers, want 2", len(cl.Spec.Workers))
+	}
+	if w := cl.Spec.Workers[0]; *w.Replicas != 5 || w.MachineType != "t3.large" {
+		t.Errorf("worker general = %d %s, want 5 t3.large", *w.Replicas, w.MachineType)
+	}
+	if w := cl.Spec.Workers[1]; w.Name != "infra" || !w.InfraNode {
+		t.Errorf("worker = %+v, want the infra pool of the profile", w)
+	}
+	if len(cl.Spec.Addons) != 2 || cl.Spec.Addons[0].TargetNamespace != "certs" || cl.Spec.Addons[1].Name != "metrics-server" {
+		t.Errorf("addons = %+v, want cert-manager of the cluster and metrics-server", cl.Spec.Addons)
+	}
+	// the profile is left untouched
+	*cl.Spec.Workers[1].Replicas = 10
+	if *p.Spec.Workers[1].Replicas != 2 {
+		t.Errorf("profile worker replicas = %d, want 2", *p.Spec.Workers[1].Replicas)
+	}
+}
+
+func TestClusterProfile_MergeGeneration(t *testing.T) {
+	p := &ClusterProfile{
+		Spec: ClusterProfileSpec{
+			ControlPlane: &ControlPlaneNode{
+				Node: Node{
+					Replicas:    pointer.Int32Ptr(3),
+					MachineType: "t3.large",
+					Labels:      map[string]string{"team": "infra"},
+				},
+			},
+			Workers: []WorkerNode{
+				{Name: "general", Node: Node{Replicas: pointer.Int32Ptr(3), MachineType: "t3.large"}},
+				{Name: "batch", Node: Node{Replicas: pointer.Int32Ptr(1), MachineType: "c5.large"}},
+			},
+			Addons: []Addon{
+				{Name: "metrics-server", TargetNamespace: "kube-system"},
+			},
+		},
+	}
+	cl := &Cluster{}
+	cl.Spec.ControlPlane = &ControlPlaneNode{
+		Node: Node{Labels: map[string]string{"tier": "control-plane"}},
+	}
+	cl.Spec.Workers = []WorkerNode{
+		{Name: "general", Node: Node{Replicas: pointer.Int32Ptr(5)}},
+	}
+	p.Merge(cl)
+
+	// the next generation changes values, drops the batch pool and moves the addon
+	p = p.DeepCopy()
+	p.Spec.ControlPlane.MachineType = "t3.xlarge"
+	p.Spec.ControlPlane.Labels["team"] = "platform"
+	p.Spec.Workers = []WorkerNode{
+		{Name: "general", Node: Node{Replicas: pointer.Int32Ptr(4), MachineType: "t3.xlarge"}},
+	}
+	p.Spec.Addons[0].TargetNamespace = "monitoring"
+	p.Merge(cl)
+
+	cp := cl.Spec.ControlPlane
+	if *cp.Replicas != 3 || cp.MachineType != "t3.xlarge" {
+		t.Errorf("control plane = %d %s, want 3 t3.xlarge", *cp.Replicas, cp.MachineType)
+	}
+	wantLabels := map[string]string{"tier": "control-plane", "team": "platform"}
+	if !reflect.DeepEqual(cp.Labels, wantLabels) {
+		t.Errorf("control plane labels = %v, want %v", cp.Labels, wantLabels)
+	}
+	if len(cl.Spec.Workers) != 1 {
+		t.Fatalf("workers = %+v, want only general", cl.Spec.Workers)
+	}
+	if w := cl.Spec.Workers[0]; *w.Replicas != 5 || w.MachineType != "t3.xlarge" {
+		t.Errorf("worker general = %d %s, want 5 t3.xlarge", *w.Replicas, w.MachineType)
+	}
+	if len(cl.Spec.Addons) != 1 || cl.Spec.Addons[0].TargetNamespace != "monitoring" {
+		t.Errorf("addons = %+v, want metrics-server in monitoring", cl.Spec.Addons)
+	}
+}
@@ -0,0 +1,116 @@
+/*
+Copyright 2020-2021 The UnDistro authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"context"
+	"fmt"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+)
+
+// log is for logging in this package.
+var clusterprofilelog = logf.Log.WithName("clusterprofile-resource")
+
+func (r *ClusterProfile) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	if k8sClient == nil {
+		k8sClient = mgr.GetClient()
+	}
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(r).
+		Complete()
+}
+
+//+kubebuilder:webhook:path=/validate-app-undistro-io-v1alpha1-clusterprofile,mutating=false,failurePolicy=fail,sideEffects=None,groups=app.undistro.io,resources=clusterprofiles,verbs=create;update;delete,versions=v1alpha1,name=vclusterprofile.undistro.io,admissionReviewVersions={v1,v1beta1}
+
+var _ webhook.Validator = &ClusterProfile{}
+
+// validate checks the worker pools and addons can be identified by their names.
+// The merged clusters are validated as usual when they're created or updated.
+func (r *ClusterProfile) validate() error {
+	var allErrs field.ErrorList
+	workers := make(map[string]bool)
+	for i, w := range r.Spec.Workers {
+		namePath := field.NewPath("spec", "workers").Index(i).Child("name")
+		if w.Name == "" {
+			allErrs = append(allErrs, field.Required(namePath, "worker pools must be named"))
+			continue
+		}
+		for _, msg := range validation.IsDNS1123Label(w.Name) {
+			allErrs = append(allErrs, field.Invalid(namePath, w.Name, msg))
+		}
+		if workers[w.Name] {
+			allErrs = append(allErrs, field.Duplicate(namePath, w.Name))
+		}
+		workers[w.Name] = true
+	}
+	addons := make(map[string]bool)
+	for i, a := range r.Spec.Addons {
+		namePath := field.NewPath("spec", "addons").Index(i).Child("name")
+		if a.Name == "" {
+			allErrs = append(allErrs, field.Required(namePath, "addons must be named"))
+			continue
+		}
+		if addons[a.Name] {
+			allErrs = append(allErrs, field.Duplicate(namePath, a.Name))
+		}
+		addons[a.Name] = true
+	}
+	if len(allErrs) == 0 {
+		return nil
+	}
+	return apierrors.NewInvalid(GroupVersion.WithKind("ClusterProfile").GroupKind(), r.Name, allErrs)
+}
+
+// ValidateCreate implements webhook.Validator so a webhook will be registered for the type
+func (r *ClusterProfile) ValidateCreate() error {
+	clusterprofilelog.Info("validate create", "name", r.Name)
+	return r.validate()
+}
+
+// ValidateUpdate implements webhook.Validator so a webhook will be registered for the type
+func (r *ClusterProfile) ValidateUpdate(old runtime.Object) error {
+	clusterprofilelog.Info("validate update", "name", r.Name)
+	if _, ok := old.(*ClusterProfile); !ok {
+		return apierrors.NewBadRequest(fmt.Sprintf("expected a ClusterProfile but got a %T", old))
+	}
+	return r.validate()
+}
+
+// ValidateDelete implements webhook.Validator so a webhook will be registered for the type.
+// Profiles referenced by clusters can't be deleted.
+func (r *ClusterProfile) ValidateDelete() error {
+	clusterprofilelog.Info("validate delete", "name", r.Name)
+	clList := ClusterList{}
+	err := k8sClient.List(context.TODO(), &clList, client.InNamespace(r.GetNamespace()))
+	if err != nil {
+		return err
+	}
+	for _, cl := range clList.Items {
+		if cl.Spec.ProfileRef != nil && cl.Spec.ProfileRef.Name == r.Name {
+			return apierrors.NewForbidden(GroupVersion.WithResource("clusterprofiles").GroupResource(), r.Name, fmt.Errorf("profile is used by cluster %s", cl.Name))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+/*
+Copyright 2020-2021 The UnDistro authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"testing"
+
+	"github.com/getupio-undistro/undistro/pkg/meta"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func TestClusterProfile_validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    ClusterProfileSpec
+		wantErr bool
+	}{
+		{
+			name: "valid",
+			spec: ClusterProfileSpec{
+				Workers: []WorkerNode{{Name: "general"}, {Name: "infra"}},
+				Addons:  []Addon{{Name: "metrics-server"}},
+			},
+		},
+		{
+			name:    "unnamed worker",
+			spec:    ClusterProfileSpec{Workers: []WorkerNode{{}}},
+			wantErr: true,
+		},
+		{
+			name:    "duplicated worker",
+			spec:    ClusterProfileSpec{Workers: []WorkerNode{{Name: "general"}, {Name: "general"}}},
+			wantErr: true,
+		},
+		{
+			name:    "duplicated addon",
+			spec:    ClusterProfileSpec{Addons: []Addon{{Name: "metrics-server"}, {Name: "metrics-server"}}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &ClusterProfile{Spec: tt.spec}
+			if err := p.validate(); (err != nil) != tt.wantErr {
+				t.Errorf("validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+var _ = Describe("ClusterProfile webhook", func() {
+	It("merges the profile into the clusters referencing it", func() {
+		replicas := int32(2)
+		p := &ClusterProfile{
+			ObjectMeta: metav1.ObjectMeta{Name: "general", Namespace: "default"},
+			Spec: ClusterProfileSpec{
+				Workers: []WorkerNode{{Name: "infra", Node: Node{Replicas: &replicas}, InfraNode: true}},
+			},
+		}
+		Expect(k8sClientMock.Create(ctx, p)).To(Succeed())
+		cl := &Cluster{
+			ObjectMeta: metav1.ObjectMeta{Name: "profiled", Namespace: "default"},
+			Spec: ClusterSpec{
+				KubernetesVersion:      "v1.20.6",
+				InfrastructureProvider: InfrastructureProvider{Name: Docker.String(), Flavor: Kubeadm.String()},
+				ProfileRef:             &ProfileReference{Name: p.Name},
+			},
+		}
+		Expect(k8sClientMock.Create(ctx, cl)).To(Succeed())
+
+		got := &Cluster{}
+		Expect(k8sClientMock.Get(ctx, client.ObjectKeyFromObject(cl), got)).To(Succeed())
+		Expect(got.Spec.ProfileRef.Generation).To(Equal(p.Generation))
+		Expect(got.Spec.Workers).To(HaveLen(1))
+		Expect(got.Spec.Workers[0].Name).To(Equal("infra"))
+		Expect(*got.Spec.Workers[0].Replicas).To(Equal(replicas))
+		Expect(got.Spec.Workers[0].Labels).To(HaveKey(meta.LabelUndistroInfra))
+
+		Expect(k8sClientMock.Delete(ctx, p)).NotTo(Succeed())
+		Expect(k8sClientMock.Delete(ctx, cl)).To(Succeed())
+	})
+})
@@ -0,0 +1,98 @@
+/*
+Copyright 2020-2021 The UnDistro authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/getupio-undistro/undistro/pkg/template"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+)
+
+// log is for logging in this package.
+var clustertemplatelog = logf.Log.WithName("clustertemplate-resource")
+
+func (r *ClusterTemplate) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	if k8sClient == nil {
+		k8sClient = mgr.GetClient()
+	}
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(r).
+		Complete()
+}
+
+//+kubebuilder:webhook:path=/validate-app-undistro-io-v1alpha1-clustertemplate,mutating=false,failurePolicy=fail,sideEffects=None,groups=app.undistro.io,resources=clustertemplates,verbs=create;update;delete,versions=v1alpha1,name=vclustertemplate.undistro.io,admissionReviewVersions={v1,v1beta1}
+
+var _ webhook.Validator = &ClusterTemplate{}
+
+// validate checks the template compiles. It's rendered only when a cluster is reconciled,
+// so errors depending on the cluster are reported in the cluster conditions.
+func (r *ClusterTemplate) validate() error {
+	var allErrs field.ErrorList
+	if strings.TrimSpace(r.Spec.Template) == "" {
+		allErrs = append(allErrs, field.Required(field.NewPath("spec", "template"), "template is required"))
+	} else {
+		_, err := template.NewFromText(r.Name, r.Spec.Template)
+		if err != nil {
+			allErrs = append(allErrs, field.Invalid(field.NewPath("spec", "template"), r.Name, err.Error()))
+		}
+	}
+	if len(allErrs) == 0 {
+		return nil
+	}
+	return apierrors.NewInvalid(GroupVersion.WithKind("ClusterTemplate").GroupKind(), r.Name, allErrs)
+}
+
+// ValidateCreate implements webhook.Validator so a webhook will be registered for the type
+func (r *ClusterTemplate) ValidateCreate() error {
+	clustertemplatelog.Info("validate create", "name", r.Name)
+	return r.validate()
+}
+
+// ValidateUpdate implements webhook.Validator so a webhook will be registered for the type
+func (r *ClusterTemplate) ValidateUpdate(old runtime.Object) error {
+	clustertemplatelog.Info("validate update", "name", r.Name)
+	if _, ok := old.(*ClusterTemplate); !ok {
+		return apierrors.NewBadRequest(fmt.Sprintf("expected a ClusterTemplate but got a %T", old))
+	}
+	return r.validate()
+}
+
+// ValidateDelete implements webhook.Validator so a webhook will be registered for the type.
+// Templates referenced by clusters can't be deleted.
+func (r *ClusterTemplate) ValidateDelete() error {
+	clustertemplatelog.Info("validate delete", "name", r.Name)
+	clList := ClusterList{}
+	err := k8sClient.List(context.TODO(), &clList, client.InNamespace(r.GetNamespace()))
+	if err != nil {
+		return err
+	}
+	for _, cl := range clList.Items {
+		if cl.Spec.TemplateRef != nil && cl.Spec.TemplateRef.Name == r.Name {
+			return apierrors.NewForbidden(GroupVersion.WithResource("clustertemplates").GroupResource(), r.Name, fmt.Errorf("template is used by cluster %s", cl.Name))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+/*
+Copyright 2020-2021 The UnDistro authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestClusterTemplate_validate(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		wantErr  bool
+	}{
+		{
+			name: "valid",
+			template: `apiVersion: cluster.x-k8s.io/v1alpha3
+kind: Cluster
+metadata:
+  name: {{.Cluster.Name}}
+  namespace: {{.Cluster.Namespace}}
+`,
+		},
+		{
+			name:     "empty",
+			template: "  \n",
+			wantErr:  true,
+		},
+		{
+			name:     "unclosed action",
+			template: "name: {{.Cluster.Name",
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ct := &ClusterTemplate{}
+			ct.Name = "cool-template"
+			ct.Spec.Template = tt.template
+			if err := ct.validate(); (err != nil) != tt.wantErr {
+				t.Errorf("validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+var _ = Describe("ClusterTemplate webhook", func() {
+	It("rejects templates that don't parse and deletes unused ones", func() {
+		ct := &ClusterTemplate{
+			ObjectMeta: metav1.ObjectMeta{Name: "env", Namespace: "default"},
+			Spec:       ClusterTemplateSpec{Template: `{{ env "HOME" }}`},
+		}
+		err := k8sClientMock.Create(ctx, ct)
+		Expect(apierrors.IsInvalid(err)).To(BeTrue(), "create error = %v", err)
+
+		ct.Spec.Template = "kind: Namespace\n"
+		Expect(k8sClientMock.Create(ctx, ct)).To(Succeed())
+		Expect(k8sClientMock.Delete(ctx, ct)).To(Succeed())
+	})
+})
@@ -60,7 +60,29 @@ type ValuesReference struct {
 
 type ChartSource struct {
 	RepoChartSource `json:",inline,omitempty"`
-	SecretRef       *corev1.LocalObjectReference `json:"secretRef,omitempty"`
+	// SecretRef holds the credentials of the repository or registry in the username and password keys
+	// and its TLS certificates in the certFile, keyFile and caFile keys.
+	SecretRef *corev1.LocalObjectReference `json:"secretRef,omitempty"`
+	// Digest pins the chart pulled from an OCI registry to the manifest digest, e.g.
+	// sha256:4f53cda18c2baa0c0354bb5f9a3ecbe5ed12ab4d8e11ba873c2f11161202b945
+	Digest string `json:"digest,omitempty"`
+	// Git is a chart in a Git repository, used instead of the chart repository.
+	// Its SecretRef holds the identity and known_hosts keys for SSH or the username
+	// and password or token keys for HTTPS.
+	Git *GitChartSource `json:"git,omitempty"`
+}
+
+// GitChartSource describes a Helm chart in a Git repository. At most one of the
+// branch, tag and commit is set, the default branch is checked out when none is.
+type GitChartSource struct {
+	// URL of the repository, e.g. `https://github.com/example/charts.git` or
+	// `ssh://git@github.com/example/charts.git`.
+	URL    string `json:"url"`
+	Branch string `json:"branch,omitempty"`
+	Tag    string `json:"tag,omitempty"`
+	Commit string `json:"commit,omitempty"`
+	// Path of the chart directory in the repository, default the root.
+	Path string `json:"path,omitempty"`
 }
 
 // RepoChartSources describes a Helm chart sourced from a Helm
@@ -68,7 +90,8 @@ type ChartSource struct {
 type RepoChartSource struct {
 	// RepoURL is the URL of the Helm repository, e.g.
 	// `https://kubernetes-charts.storage.googleapis.com` or
-	// `https://charts.example.com`.
+	// `https://charts.example.com`, or of the charts in an OCI registry, e.g.
+	// `oci://ghcr.io/example/charts`.
 	RepoURL string `json:"repository,omitempty"`
 	// Name is the name of the Helm chart _without_ an alias, e.g.
 	// redis (for `helm upgrade [flags] stable/redis`).
@@ -169,6 +192,47 @@ type HelmReleaseSpec struct {
 	Dependencies []corev1.ObjectReference `json:"dependencies,omitempty"`
 	Paused       bool                     `json:"paused,omitempty"`
 	AutoUpgrade  bool                     `json:"autoUpgrade,omitempty"`
+	// DriftDetection compares the objects of the release with the live
+	// objects in the target cluster while the release is ready.
+	DriftDetection *DriftDetection `json:"driftDetection,omitempty"`
+}
+
+// DriftDetectionMode is what is done with the objects that drifted from the release.
+type DriftDetectionMode string
+
+const (
+	// DriftDetectionDetect reports the drifted objects in the status.
+	DriftDetectionDetect DriftDetectionMode = "detect"
+	// DriftDetectionCorrect reports the drifted objects and applies them again.
+	DriftDetectionCorrect DriftDetectionMode = "correct"
+)
+
+type DriftDetection struct {
+	// Mode is detect to report the drifted objects or correct to also apply
+	// them again, default detect.
+	// +kubebuilder:validation:Enum=detect;correct
+	Mode DriftDetectionMode `json:"mode,omitempty"`
+	// Interval is the time between the comparisons, default 10m.
+	Interval *metav1.Duration `json:"interval,omitempty"`
+}
+
+const (
+	// DriftMissingReason is the reason of objects deleted from the cluster.
+	DriftMissingReason = "Missing"
+	// DriftModifiedReason is the reason of objects with fields changed in the cluster.
+	DriftModifiedReason = "Modified"
+)
+
+// DriftedObject is an object of the release that differs from the release manifest.
+type DriftedObject struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Namespace  string `json:"namespace,omitempty"`
+	Name       string `json:"name"`
+	// Reason is Missing or Modified.
+	Reason string `json:"reason"`
+	// Fields are the paths of the modified fields, e.g. spec.replicas.
+	Fields []string `json:"fields,omitempty"`
 }
 
 // HelmReleaseStatus defines the observed state of HelmRelease// HelmReleaseStatus defines the observed state of a HelmRelease.
@@ -206,6 +270,10 @@ type HelmReleaseStatus struct {
 	// UpgradeFailures is the upgrade failure count against the latest desired
 	// state. It is reset after a successful reconciliation.
 	UpgradeFailures int64 `json:"upgradeFailures,omitempty"`
+
+	// DriftedObjects are the objects of the last release that drifted
+	// from its manifest in the last drift detection.
+	DriftedObjects []DriftedObject `json:"driftedObjects,omitempty"`
 }
 
 // HelmReleaseProgressing resets any failures and registers progress toward
@@ -213,6 +281,7 @@ type HelmReleaseStatus struct {
 // 'Unknown' for meta.ProgressingReason.
 func HelmReleaseProgressing(hr HelmRelease) HelmRelease {
 	hr.Status.Conditions = []metav1.Condition{}
+	hr.Status.DriftedObjects = nil
 	msg := "Reconciliation in progress"
 	meta.SetResourceCondition(&hr, meta.ReadyCondition, metav1.ConditionUnknown, meta.ProgressingReason, msg)
 	resetFailureCounts(&hr)
@@ -19,6 +19,9 @@ package v1alpha1
 import (
 	"context"
 	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
 	"time"
 
 	"github.com/getupio-undistro/undistro/pkg/meta"
@@ -104,6 +107,16 @@ func (r *HelmRelease) Default() {
 			r.Spec.ValuesFrom[i].ValuesKey = "values.yaml"
 		}
 	}
+	if r.Spec.DriftDetection != nil {
+		if r.Spec.DriftDetection.Mode == "" {
+			r.Spec.DriftDetection.Mode = DriftDetectionDetect
+		}
+		if r.Spec.DriftDetection.Interval == nil {
+			r.Spec.DriftDetection.Interval = &metav1.Duration{
+				Duration: 10 * time.Minute,
+			}
+		}
+	}
 }
 
 //+kubebuilder:webhook:path=/validate-app-undistro-io-v1alpha1-helmrelease,mutating=false,failurePolicy=fail,sideEffects=None,groups=app.undistro.io,resources=helmreleases,verbs=create;update,versions=v1alpha1,name=vhelmrelease.undistro.io,admissionReviewVersions={v1,v1beta1}
@@ -112,7 +125,7 @@ var _ webhook.Validator = &HelmRelease{}
 
 func (r *HelmRelease) validate(old *HelmRelease) error {
 	var allErrs field.ErrorList
-	if r.Spec.Chart.Name == "" {
+	if r.Spec.Chart.Git == nil && r.Spec.Chart.Name == "" {
 		allErrs = append(allErrs, field.Required(
 			field.NewPath("spec", "chart", "name"),
 			"spec.chart.name to be populated",
@@ -126,12 +139,13 @@ func (r *HelmRelease) validate(old *HelmRelease) error {
 			))
 		}
 	}
-	if r.Spec.Chart.RepoURL == "" {
+	if r.Spec.Chart.Git == nil && r.Spec.Chart.RepoURL == "" {
 		allErrs = append(allErrs, field.Required(
 			field.NewPath("spec", "chart", "repository"),
 			"spec.chart.repository to be populated",
 		))
 	}
+	allErrs = validateChartSource(field.NewPath("spec", "chart"), r.Spec.Chart, allErrs)
 	if old != nil && old.Spec.Chart.Name != r.Spec.Chart.Name {
 		allErrs = append(allErrs, field.Invalid(
 			field.NewPath("spec", "chart", "name"),
@@ -146,6 +160,13 @@ func (r *HelmRelease) validate(old *HelmRelease) error {
 			"field is immutable",
 		))
 	}
+	if old != nil && old.Spec.Chart.Git != nil && r.Spec.Chart.Git != nil && old.Spec.Chart.Git.URL != r.Spec.Chart.Git.URL {
+		allErrs = append(allErrs, field.Invalid(
+			field.NewPath("spec", "chart", "git", "url"),
+			r.Spec.Chart.Git.URL,
+			"field is immutable",
+		))
+	}
 	if old != nil && old.Spec.ClusterName != r.Spec.ClusterName {
 		allErrs = append(allErrs, field.Invalid(
 			field.NewPath("spec", "clusterName"),
@@ -153,12 +174,21 @@ func (r *HelmRelease) validate(old *HelmRelease) error {
 			"field is immutable",
 		))
 	}
-	_, err := version.ParseVersion(r.Spec.Chart.Version)
-	if err != nil {
+	if r.Spec.Chart.Git == nil {
+		_, err := version.ParseVersion(r.Spec.Chart.Version)
+		if err != nil {
+			allErrs = append(allErrs, field.Invalid(
+				field.NewPath("spec", "chart", "version"),
+				r.Spec.Chart.Version,
+				err.Error(),
+			))
+		}
+	}
+	if d := r.Spec.DriftDetection; d != nil && d.Interval != nil && d.Interval.Duration < time.Minute {
 		allErrs = append(allErrs, field.Invalid(
-			field.NewPath("spec", "chart", "version"),
-			r.Spec.Chart.Version,
-			err.Error(),
+			field.NewPath("spec", "driftDetection", "interval"),
+			d.Interval.Duration.String(),
+			"interval must be at least 1m",
 		))
 	}
 	if r.Spec.ClusterName != "" {
@@ -178,6 +208,93 @@ func (r *HelmRelease) validate(old *HelmRelease) error {
 	return apierrors.NewInvalid(GroupVersion.WithKind("HelmRelease").GroupKind(), r.Name, allErrs)
 }
 
+var (
+	chartDigestRegexp = regexp.MustCompile(`^sha256:[a-f0-9]{64}$`)
+	gitCommitRegexp   = regexp.MustCompile(`^[a-f0-9]{40}$`)
+	// scpLikeURLRegexp matches the user@host:path syntax of SSH repositories
+	scpLikeURLRegexp = regexp.MustCompile(`^(?:[^@/]+@)?[^@/:]+:[^/].*$`)
+)
+
+// validateChartSource checks the repository is an HTTP chart repository or an OCI registry.
+// Only charts in OCI registries can be pinned to a digest.
+// Charts in Git repositories are validated by validateGitChartSource.
+func validateChartSource(path *field.Path, c ChartSource, allErrs field.ErrorList) field.ErrorList {
+	if c.Git != nil {
+		return validateGitChartSource(path, c, allErrs)
+	}
+	if c.RepoURL != "" {
+		u, err := url.Parse(c.RepoURL)
+		switch {
+		case err != nil:
+			allErrs = append(allErrs, field.Invalid(path.Child("repository"), c.RepoURL, err.Error()))
+		case u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "oci":
+			allErrs = append(allErrs, field.Invalid(path.Child("repository"), c.RepoURL, "scheme must be http, https or oci"))
+		case u.Host == "":
+			allErrs = append(allErrs, field.Invalid(path.Child("repository"), c.RepoURL, "host is required"))
+		case u.Scheme == "oci" && (u.RawQuery != "" || u.Fragment != ""):
+			allErrs = append(allErrs, field.Invalid(path.Child("repository"), c.RepoURL, "OCI repositories can't have a query or fragment"))
+		}
+		if c.Digest != "" && u != nil && u.Scheme != "oci" {
+			allErrs = append(allErrs, field.Forbidden(path.Child("digest"), "digest is only supported by OCI repositories"))
+		}
+	}
+	if c.Digest != "" && !chartDigestRegexp.MatchString(c.Digest) {
+		allErrs = append(allErrs, field.Invalid(path.Child("digest"), c.Digest, "digest must be sha256:<64 hex characters>"))
+	}
+	return allErrs
+}
+
+// validateGitChartSource checks the Git repository URL and that
+// the chart is selected by at most one of branch, tag or commit.
+func validateGitChartSource(path *field.Path, c ChartSource, allErrs field.ErrorList) field.ErrorList {
+	if c.RepoURL != "" {
+		allErrs = append(allErrs, field.Forbidden(path.Child("repository"), "repository can't be used with git"))
+	}
+	if c.Version != "" {
+		allErrs = append(allErrs, field.Forbidden(path.Child("version"), "version can't be used with git"))
+	}
+	if c.Digest != "" {
+		allErrs = append(allErrs, field.Forbidden(path.Child("digest"), "digest can't be used with git"))
+	}
+	gitPath := path.Child("git")
+	g := c.Git
+	switch {
+	case g.URL == "":
+		allErrs = append(allErrs, field.Required(gitPath.Child("url"), "spec.chart.git.url to be populated"))
+	case strings.Contains(g.URL, "://"):
+		u, err := url.Parse(g.URL)
+		switch {
+		case err != nil:
+			allErrs = append(allErrs, field.Invalid(gitPath.Child("url"), g.URL, err.Error()))
+		case u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "ssh":
+			allErrs = append(allErrs, field.Invalid(gitPath.Child("url"), g.URL, "scheme must be http, https or ssh"))
+		case u.Host == "":
+			allErrs = append(allErrs, field.Invalid(gitPath.Child("url"), g.URL, "host is required"))
+		}
+	case !scpLikeURLRegexp.MatchString(g.URL):
+		allErrs = append(allErrs, field.Invalid(gitPath.Child("url"), g.URL, "url must be http, https, ssh or user@host:path"))
+	}
+	refs := 0
+	for _, ref := range []string{g.Branch, g.Tag, g.Commit} {
+		if ref != "" {
+			refs++
+		}
+	}
+	if refs > 1 {
+		allErrs = append(allErrs, field.Forbidden(gitPath, "only one of branch, tag or commit can be set"))
+	}
+	if g.Commit != "" && !gitCommitRegexp.MatchString(g.Commit) {
+		allErrs = append(allErrs, field.Invalid(gitPath.Child("commit"), g.Commit, "commit must be the full SHA-1 hash"))
+	}
+	for _, p := range strings.Split(g.Path, "/") {
+		if p == ".." {
+			allErrs = append(allErrs, field.Invalid(gitPath.Child("path"), g.Path, "path must be inside the repository"))
+			break
+		}
+	}
+	return allErrs
+}
+
 // ValidateCreate implements webhook.Validator so a webhook will be registered for the type
 func (r *HelmRelease) ValidateCreate() error {
 	helmreleaselog.Info("validate create", "name", r.Name)
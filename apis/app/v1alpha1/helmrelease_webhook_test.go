@@ -0,0 +1,122 @@
+/*
+Copyright 2020-2021 The UnDistro authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+func Test_validateChartSource(t *testing.T) {
+	digest := "sha256:4f53cda18c2baa0c0354bb5f9a3ecbe5ed12ab4d8e11ba873c2f11161202b945"
+	source := func(repoURL, digest string) ChartSource {
+		return ChartSource{
+			RepoChartSource: RepoChartSource{RepoURL: repoURL, Name: "redis", Version: "14.6.1"},
+			Digest:          digest,
+		}
+	}
+	gitSource := func(g GitChartSource) ChartSource {
+		return ChartSource{Git: &g}
+	}
+	tests := []struct {
+		name    string
+		source  ChartSource
+		wantErr int
+	}{
+		{
+			name:   "http repository",
+			source: source("https://charts.bitnami.com/bitnami", ""),
+		},
+		{
+			name:   "oci registry",
+			source: source("oci://ghcr.io/getupio-undistro/charts", ""),
+		},
+		{
+			name:   "oci registry pinned",
+			source: source("oci://localhost:5000/charts", digest),
+		},
+		{
+			name:    "unknown scheme",
+			source:  source("git://github.com/getupio-undistro/charts", ""),
+			wantErr: 1,
+		},
+		{
+			name:    "oci without host",
+			source:  source("oci:///charts", ""),
+			wantErr: 1,
+		},
+		{
+			name:    "digest in http repository",
+			source:  source("https://charts.bitnami.com/bitnami", digest),
+			wantErr: 1,
+		},
+		{
+			name:    "invalid digest",
+			source:  source("oci://ghcr.io/getupio-undistro/charts", "sha256:latest"),
+			wantErr: 1,
+		},
+		{
+			name:   "git https",
+			source: gitSource(GitChartSource{URL: "https://github.com/getupio-undistro/charts.git", Branch: "main", Path: "charts/redis"}),
+		},
+		{
+			name:   "git scp-like",
+			source: gitSource(GitChartSource{URL: "git@github.com:getupio-undistro/charts.git", Commit: "2d0f7d0b4c5e1a6f3b9c8e7d6a5b4c3d2e1f0a9b"}),
+		},
+		{
+			name:    "git without url",
+			source:  gitSource(GitChartSource{Tag: "v1.0.0"}),
+			wantErr: 1,
+		},
+		{
+			name:    "git unknown scheme",
+			source:  gitSource(GitChartSource{URL: "ftp://github.com/getupio-undistro/charts.git"}),
+			wantErr: 1,
+		},
+		{
+			name:    "git branch and tag",
+			source:  gitSource(GitChartSource{URL: "https://github.com/getupio-undistro/charts.git", Branch: "main", Tag: "v1.0.0"}),
+			wantErr: 1,
+		},
+		{
+			name:    "git short commit",
+			source:  gitSource(GitChartSource{URL: "https://github.com/getupio-undistro/charts.git", Commit: "2d0f7d0"}),
+			wantErr: 1,
+		},
+		{
+			name:    "git path outside repository",
+			source:  gitSource(GitChartSource{URL: "https://github.com/getupio-undistro/charts.git", Path: "../redis"}),
+			wantErr: 1,
+		},
+		{
+			name: "git with repository",
+			source: ChartSource{
+				RepoChartSource: RepoChartSource{RepoURL: "https://charts.bitnami.com/bitnami", Version: "14.6.1"},
+				Git:             &GitChartSource{URL: "https://github.com/getupio-undistro/charts.git"},
+			},
+			wantErr: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := validateChartSource(field.NewPath("spec", "chart"), tt.source, nil); len(got) != tt.wantErr {
+				t.Errorf("validateChartSource() = %v, want %d errors", got, tt.wantErr)
+			}
+		})
+	}
+}
@@ -20,6 +20,7 @@ import (
 	"os"
 
 	"github.com/getupio-undistro/undistro/pkg/cli"
+	_ "github.com/getupio-undistro/undistro/pkg/cloud/providers"
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 )
 
@@ -0,0 +1,123 @@
+/*
+Copyright 2020-2021 The UnDistro authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"context"
+	"fmt"
+
+	appv1alpha1 "github.com/getupio-undistro/undistro/apis/app/v1alpha1"
+	"github.com/getupio-undistro/undistro/pkg/meta"
+	"github.com/getupio-undistro/undistro/pkg/util"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// reconcileAddons keeps a HelmRelease for each cluster addon and deletes the ones removed from the spec.
+// The addons wait for their dependencies and for the CNI to be ready.
+func (r *ClusterReconciler) reconcileAddons(ctx context.Context, cl *appv1alpha1.Cluster) error {
+	desired := make(map[string]bool, len(cl.Spec.Addons))
+	for _, a := range cl.Spec.Addons {
+		err := r.applyAddon(ctx, cl, a)
+		if err != nil {
+			return err
+		}
+		desired[a.Name] = true
+	}
+	hrList := appv1alpha1.HelmReleaseList{}
+	err := r.List(ctx, &hrList,
+		client.InNamespace(cl.GetNamespace()),
+		client.MatchingLabels{meta.LabelUndistroClusterName: cl.Name},
+		client.HasLabels{meta.LabelUndistroAddon},
+	)
+	if err != nil {
+		return err
+	}
+	for i := range hrList.Items {
+		hr := &hrList.Items[i]
+		if desired[hr.Labels[meta.LabelUndistroAddon]] || !metav1.IsControlledBy(hr, cl) {
+			continue
+		}
+		err = r.Delete(ctx, hr)
+		if client.IgnoreNotFound(err) != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *ClusterReconciler) applyAddon(ctx context.Context, cl *appv1alpha1.Cluster, a appv1alpha1.Addon) error {
+	key := client.ObjectKey{
+		Name:      cl.AddonReleaseName(a.Name),
+		Namespace: cl.GetNamespace(),
+	}
+	hr := appv1alpha1.HelmRelease{}
+	err := r.Get(ctx, key, &hr)
+	if err != nil {
+		if client.IgnoreNotFound(err) != nil {
+			return err
+		}
+		hr = appv1alpha1.HelmRelease{
+			TypeMeta: metav1.TypeMeta{
+				APIVersion: appv1alpha1.GroupVersion.String(),
+				Kind:       "HelmRelease",
+			},
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      key.Name,
+				Namespace: key.Namespace,
+			},
+			Spec: appv1alpha1.HelmReleaseSpec{
+				ReleaseName: a.Name,
+				ClusterName: fmt.Sprintf("%s/%s", cl.GetNamespace(), cl.Name),
+			},
+		}
+		err = ctrl.SetControllerReference(cl, &hr, r.Scheme)
+		if err != nil {
+			return err
+		}
+	}
+	if hr.Labels == nil {
+		hr.Labels = make(map[string]string)
+	}
+	hr.Labels[meta.LabelUndistroClusterName] = cl.Name
+	hr.Labels[meta.LabelUndistroAddon] = a.Name
+	hr.Spec.TargetNamespace = a.GetTargetNamespace()
+	hr.Spec.Chart = a.Chart
+	hr.Spec.Values = a.Values
+	deps := make([]corev1.ObjectReference, 0, len(a.DependsOn)+1)
+	cni := cl.Spec.Network.GetCNI()
+	if cni.Provider != appv1alpha1.NoCNI {
+		deps = append(deps, helmReleaseReference(cniReleaseName(cl, cni.Provider), cl.GetNamespace()))
+	}
+	for _, d := range a.DependsOn {
+		deps = append(deps, helmReleaseReference(cl.AddonReleaseName(d), cl.GetNamespace()))
+	}
+	hr.Spec.Dependencies = deps
+	_, err = util.CreateOrUpdate(ctx, r.Client, &hr)
+	return err
+}
+
+func helmReleaseReference(name, namespace string) corev1.ObjectReference {
+	return corev1.ObjectReference{
+		APIVersion: appv1alpha1.GroupVersion.String(),
+		Kind:       "HelmRelease",
+		Name:       name,
+		Namespace:  namespace,
+	}
+}
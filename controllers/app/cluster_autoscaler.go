@@ -0,0 +1,247 @@
+/*
+Copyright 2020-2021 The UnDistro authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	appv1alpha1 "github.com/getupio-undistro/undistro/apis/app/v1alpha1"
+	"github.com/getupio-undistro/undistro/pkg/cloud"
+	"github.com/getupio-undistro/undistro/pkg/meta"
+	"github.com/getupio-undistro/undistro/pkg/util"
+	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	capiexp "sigs.k8s.io/cluster-api/exp/api/v1alpha3"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	autoscalerChartName    = appv1alpha1.AutoscalerReleaseName
+	autoscalerChartRepo    = "https://kubernetes.github.io/autoscaler"
+	autoscalerChartVersion = "9.10.7"
+
+	// annotations read by the clusterapi provider of cluster-autoscaler
+	autoscalerMinSizeAnnotation = "cluster.x-k8s.io/cluster-api-autoscaler-node-group-min-size"
+	autoscalerMaxSizeAnnotation = "cluster.x-k8s.io/cluster-api-autoscaler-node-group-max-size"
+)
+
+func hasAutoscaling(cl *appv1alpha1.Cluster) bool {
+	for _, w := range cl.Spec.Workers {
+		if w.Autoscale.Enabled {
+			return true
+		}
+	}
+	return false
+}
+
+// reconcileAutoscaler runs cluster-autoscaler while any worker pool has autoscaling enabled.
+// Machine deployments are scaled through the CAPI objects by an autoscaler running in the management cluster,
+// which watches the workload cluster using its kubeconfig. Machine pools are scaled through the cloud provider
+// by an autoscaler running in the workload cluster, so it uses the cloud identity of its nodes.
+// One autoscaler runs per cluster, so both kinds of pools can't be autoscaled together.
+func (r *ClusterReconciler) reconcileAutoscaler(ctx context.Context, cl *appv1alpha1.Cluster) error {
+	machinePools, machineDeployments, err := r.annotateWorkerPools(ctx, cl)
+	if err != nil {
+		return err
+	}
+	key := client.ObjectKey{
+		Name:      fmt.Sprintf("%s-%s", autoscalerChartName, cl.Name),
+		Namespace: cl.GetNamespace(),
+	}
+	cloudKey := client.ObjectKey{
+		Name:      fmt.Sprintf("%s-%s", key.Name, cl.Spec.InfrastructureProvider.Name),
+		Namespace: cl.GetNamespace(),
+	}
+	if !hasAutoscaling(cl) {
+		apimeta.RemoveStatusCondition(&cl.Status.Conditions, meta.AutoscalingCondition)
+		err = r.deleteAutoscaler(ctx, key)
+		if err != nil {
+			return err
+		}
+		return r.deleteAutoscaler(ctx, cloudKey)
+	}
+	if machinePools && machineDeployments {
+		msg := "machine pools and machine deployments can't be autoscaled together"
+		meta.SetResourceCondition(cl, meta.AutoscalingCondition, metav1.ConditionFalse, meta.MixedWorkerPoolsReason, msg)
+		return nil
+	}
+	hr := appv1alpha1.HelmRelease{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: appv1alpha1.GroupVersion.String(),
+			Kind:       "HelmRelease",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      key.Name,
+			Namespace: key.Namespace,
+		},
+		Spec: appv1alpha1.HelmReleaseSpec{
+			// empty cluster name installs the chart in the management cluster
+			TargetNamespace: cl.GetNamespace(),
+			ReleaseName:     key.Name,
+			Chart: appv1alpha1.ChartSource{
+				RepoChartSource: appv1alpha1.RepoChartSource{
+					RepoURL: autoscalerChartRepo,
+					Name:    autoscalerChartName,
+					Version: autoscalerChartVersion,
+				},
+			},
+		},
+	}
+	values := map[string]interface{}{
+		"fullnameOverride": key.Name,
+		"extraArgs": map[string]interface{}{
+			"balance-similar-node-groups":   true,
+			"skip-nodes-with-local-storage": false,
+		},
+	}
+	unused := cloudKey
+	if machinePools {
+		cloudValues, ok, err := cloud.AutoscalerValues(ctx, r.Client, cl)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			msg := fmt.Sprintf("machine pools of %s clusters can't be autoscaled", cl.Spec.InfrastructureProvider.Name)
+			meta.SetResourceCondition(cl, meta.AutoscalingCondition, metav1.ConditionFalse, meta.AutoscalingNotSupportedReason, msg)
+			return nil
+		}
+		values = util.MergeMaps(values, cloudValues)
+		hr.Name = cloudKey.Name
+		hr.Spec.ReleaseName = autoscalerChartName
+		hr.Spec.ClusterName = fmt.Sprintf("%s/%s", cl.GetNamespace(), cl.Name)
+		hr.Spec.TargetNamespace = metav1.NamespaceSystem
+		values["fullnameOverride"] = autoscalerChartName
+		if cni := cl.Spec.Network.GetCNI(); cni.Provider != appv1alpha1.NoCNI {
+			hr.Spec.Dependencies = []corev1.ObjectReference{helmReleaseReference(cniReleaseName(cl, cni.Provider), cl.GetNamespace())}
+		}
+		unused = key
+	} else {
+		values = util.MergeMaps(values, map[string]interface{}{
+			"cloudProvider": "clusterapi",
+			"autoDiscovery": map[string]interface{}{
+				"clusterName": cl.Name,
+			},
+			// the workload cluster is reached by the kubeconfig created by CAPI
+			"clusterAPIMode":                   "kubeconfig-incluster",
+			"clusterAPIKubeconfigSecret":       fmt.Sprintf("%s-kubeconfig", cl.Name),
+			"clusterAPIWorkloadKubeconfigPath": "/etc/kubernetes/value",
+		})
+	}
+	// a pool switching between machine pool and machine deployment moves the autoscaler
+	err = r.deleteAutoscaler(ctx, unused)
+	if err != nil {
+		return err
+	}
+	v, err := json.Marshal(values)
+	if err != nil {
+		return err
+	}
+	hr.Spec.Values = &apiextensionsv1.JSON{Raw: v}
+	err = ctrl.SetControllerReference(cl, &hr, r.Scheme)
+	if err != nil {
+		return err
+	}
+	_, err = util.CreateOrUpdate(ctx, r.Client, &hr)
+	if err != nil {
+		return err
+	}
+	meta.SetResourceCondition(cl, meta.AutoscalingCondition, metav1.ConditionTrue, meta.AutoscalerReleasedReason, fmt.Sprintf("cluster-autoscaler released by %s", hr.Name))
+	return nil
+}
+
+func (r *ClusterReconciler) deleteAutoscaler(ctx context.Context, key client.ObjectKey) error {
+	hr := appv1alpha1.HelmRelease{}
+	err := r.Get(ctx, key, &hr)
+	if err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	return client.IgnoreNotFound(r.Delete(ctx, &hr))
+}
+
+// keepAutoscaledReplicas keeps the replicas set by cluster-autoscaler when the templates are applied again.
+// Machine pools are scaled in the cloud provider, so their replicas are read from it.
+func (r *ClusterReconciler) keepAutoscaledReplicas(ctx context.Context, cl *appv1alpha1.Cluster, o *unstructured.Unstructured) error {
+	i := workerPoolIndex(cl, *o)
+	if i < 0 || !cl.Spec.Workers[i].Autoscale.Enabled {
+		return nil
+	}
+	cur := unstructured.Unstructured{}
+	cur.SetGroupVersionKind(o.GroupVersionKind())
+	err := r.Get(ctx, client.ObjectKeyFromObject(o), &cur)
+	if err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	if o.GroupVersionKind().GroupKind() == capiexp.GroupVersion.WithKind("MachinePool").GroupKind() {
+		replicas, ok, err := cloud.AutoscaledReplicas(ctx, r.Client, cl, o.GetName())
+		if err != nil {
+			return err
+		}
+		if ok {
+			return unstructured.SetNestedField(o.Object, int64(replicas), "spec", "replicas")
+		}
+	}
+	replicas, ok, err := unstructured.NestedInt64(cur.Object, "spec", "replicas")
+	if err != nil || !ok {
+		return err
+	}
+	return unstructured.SetNestedField(o.Object, replicas, "spec", "replicas")
+}
+
+// annotateWorkerPools sets the size bounds of pools with autoscaling enabled and removes them from the others.
+// It returns whether any machine pool and any machine deployment have autoscaling enabled.
+func (r *ClusterReconciler) annotateWorkerPools(ctx context.Context, cl *appv1alpha1.Cluster) (bool, bool, error) {
+	machinePools, machineDeployments := false, false
+	for i, w := range cl.Spec.Workers {
+		pool, err := r.workerPool(ctx, cl, i)
+		if err != nil {
+			return false, false, err
+		}
+		if pool == nil {
+			continue
+		}
+		if _, ok := pool.(*capiexp.MachinePool); ok && w.Autoscale.Enabled {
+			machinePools = true
+		} else if w.Autoscale.Enabled {
+			machineDeployments = true
+		}
+		base := pool.DeepCopyObject().(client.Object)
+		annotations := pool.GetAnnotations()
+		if annotations == nil {
+			annotations = make(map[string]string)
+		}
+		if w.Autoscale.Enabled {
+			annotations[autoscalerMinSizeAnnotation] = strconv.Itoa(int(w.Autoscale.MinSize))
+			annotations[autoscalerMaxSizeAnnotation] = strconv.Itoa(int(w.Autoscale.MaxSize))
+		} else {
+			delete(annotations, autoscalerMinSizeAnnotation)
+			delete(annotations, autoscalerMaxSizeAnnotation)
+		}
+		pool.SetAnnotations(annotations)
+		err = r.Patch(ctx, pool, client.MergeFrom(base))
+		if err != nil {
+			return false, false, err
+		}
+	}
+	return machinePools, machineDeployments, nil
+}
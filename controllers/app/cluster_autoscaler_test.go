@@ -0,0 +1,93 @@
+/*
+Copyright 2020-2021 The UnDistro authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package app
+
+import (
+	"context"
+	"testing"
+
+	appv1alpha1 "github.com/getupio-undistro/undistro/apis/app/v1alpha1"
+	"github.com/getupio-undistro/undistro/pkg/meta"
+	"github.com/getupio-undistro/undistro/pkg/scheme"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	capi "sigs.k8s.io/cluster-api/api/v1alpha3"
+	capiexp "sigs.k8s.io/cluster-api/exp/api/v1alpha3"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestReconcileAutoscaler(t *testing.T) {
+	tests := []struct {
+		name        string
+		mpAutoscale bool
+		wantStatus  metav1.ConditionStatus
+		wantReason  string
+		wantRelease bool
+	}{
+		{
+			name:        "machine deployments",
+			wantStatus:  metav1.ConditionTrue,
+			wantReason:  meta.AutoscalerReleasedReason,
+			wantRelease: true,
+		},
+		{
+			name:        "machine pools and machine deployments",
+			mpAutoscale: true,
+			wantStatus:  metav1.ConditionFalse,
+			wantReason:  meta.MixedWorkerPoolsReason,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cl := &appv1alpha1.Cluster{
+				TypeMeta:   metav1.TypeMeta{APIVersion: appv1alpha1.GroupVersion.String(), Kind: "Cluster"},
+				ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "default"},
+			}
+			cl.Spec.InfrastructureProvider = appv1alpha1.InfrastructureProvider{Name: appv1alpha1.Amazon.String(), Flavor: appv1alpha1.EC2.String()}
+			cl.Spec.Workers = []appv1alpha1.WorkerNode{
+				{Name: "md", Autoscale: appv1alpha1.Autoscaling{Enabled: true, MinSize: 1, MaxSize: 3}},
+				{Name: "mp", Autoscale: appv1alpha1.Autoscaling{Enabled: tt.mpAutoscale, MinSize: 1, MaxSize: 3}},
+			}
+			md := &capi.MachineDeployment{
+				ObjectMeta: metav1.ObjectMeta{Name: cl.MachineDeploymentName(0), Namespace: cl.Namespace},
+			}
+			mp := &capiexp.MachinePool{
+				ObjectMeta: metav1.ObjectMeta{Name: cl.MachinePoolName(1), Namespace: cl.Namespace},
+			}
+			r := &ClusterReconciler{
+				Client: typedClient{fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(md, mp).Build()},
+				Scheme: scheme.Scheme,
+			}
+			err := r.reconcileAutoscaler(context.Background(), cl)
+			if err != nil {
+				t.Fatalf("reconcileAutoscaler() error = %v", err)
+			}
+			c := apimeta.FindStatusCondition(cl.Status.Conditions, meta.AutoscalingCondition)
+			if c == nil || c.Status != tt.wantStatus || c.Reason != tt.wantReason {
+				t.Errorf("condition = %v, want status %s and reason %s", c, tt.wantStatus, tt.wantReason)
+			}
+			hrList := appv1alpha1.HelmReleaseList{}
+			err = r.List(context.Background(), &hrList, client.InNamespace(cl.Namespace))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := len(hrList.Items) == 1; got != tt.wantRelease {
+				t.Errorf("released = %v, want %v", got, tt.wantRelease)
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+/*
+Copyright 2020-2021 The UnDistro authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"context"
+
+	appv1alpha1 "github.com/getupio-undistro/undistro/apis/app/v1alpha1"
+	"github.com/getupio-undistro/undistro/pkg/backup"
+	"github.com/getupio-undistro/undistro/pkg/kube"
+	"github.com/getupio-undistro/undistro/pkg/meta"
+	"github.com/getupio-undistro/undistro/pkg/record"
+	"github.com/getupio-undistro/undistro/pkg/util"
+	batchv1 "k8s.io/api/batch/v1"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// reconcileBackup keeps the etcd snapshot CronJob in the workload cluster and
+// records the last successful snapshot. It's removed when the backup is disabled.
+func (r *ClusterReconciler) reconcileBackup(ctx context.Context, cl *appv1alpha1.Cluster) error {
+	if cl.Spec.InfrastructureProvider.IsManaged() {
+		return nil
+	}
+	wc, err := kube.NewClusterClient(ctx, r.Client, cl.Name, cl.GetNamespace())
+	if err != nil {
+		return err
+	}
+	if cl.Spec.Backup == nil {
+		objs := []client.Object{
+			&batchv1beta1.CronJob{},
+			&corev1.Secret{},
+		}
+		for _, o := range objs {
+			o.SetName(backup.Name)
+			o.SetNamespace(backup.Namespace)
+			err = wc.Delete(ctx, o, client.PropagationPolicy("Background"))
+			if client.IgnoreNotFound(err) != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if ref := cl.Spec.Backup.Destination.SecretRef; ref != nil {
+		creds := corev1.Secret{}
+		err = r.Get(ctx, client.ObjectKey{Name: ref.Name, Namespace: cl.GetNamespace()}, &creds)
+		if err != nil {
+			return err
+		}
+		s, err := backup.Secret(&creds)
+		if err != nil {
+			return err
+		}
+		_, err = util.CreateOrUpdate(ctx, wc, s)
+		if err != nil {
+			return err
+		}
+	}
+	image, err := backup.EtcdImage(ctx, wc)
+	if err != nil {
+		return err
+	}
+	_, err = util.CreateOrUpdate(ctx, wc, backup.CronJob(cl, image))
+	if err != nil {
+		return err
+	}
+	jobs := batchv1.JobList{}
+	err = wc.List(ctx, &jobs, client.InNamespace(backup.Namespace), backup.Selector())
+	if err != nil {
+		return err
+	}
+	last := backup.LastSnapshot(cl, jobs.Items)
+	if last == nil {
+		return nil
+	}
+	if cl.Status.LastBackup == nil || cl.Status.LastBackup.Time.Before(&last.Time) {
+		cl.Status.LastBackup = last
+		record.Eventf(cl, meta.BackupSucceededReason, "etcd snapshot %s taken", last.Snapshot)
+	}
+	return nil
+}
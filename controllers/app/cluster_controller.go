@@ -18,13 +18,14 @@ package app
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"reflect"
 	"strings"
 	"time"
 
 	appv1alpha1 "github.com/getupio-undistro/undistro/apis/app/v1alpha1"
 	"github.com/getupio-undistro/undistro/pkg/cloud"
-	"github.com/getupio-undistro/undistro/pkg/fs"
 	"github.com/getupio-undistro/undistro/pkg/kube"
 	"github.com/getupio-undistro/undistro/pkg/meta"
 	"github.com/getupio-undistro/undistro/pkg/retry"
@@ -34,12 +35,14 @@ import (
 	"github.com/go-logr/logr"
 	corev1 "k8s.io/api/core/v1"
 	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	kerrors "k8s.io/apimachinery/pkg/util/errors"
 	"k8s.io/apimachinery/pkg/util/uuid"
+	"k8s.io/client-go/kubernetes"
 	capi "sigs.k8s.io/cluster-api/api/v1alpha3"
 	capicp "sigs.k8s.io/cluster-api/controlplane/kubeadm/api/v1alpha3"
 	capiexp "sigs.k8s.io/cluster-api/exp/api/v1alpha3"
@@ -106,7 +109,7 @@ func (r *ClusterReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ct
 	return result, err
 }
 
-func (r *ClusterReconciler) templateVariables(ctx context.Context, c client.Client, cl *appv1alpha1.Cluster) (map[string]interface{}, error) {
+func (r *ClusterReconciler) templateVariables(ctx context.Context, c client.Client, cl *appv1alpha1.Cluster, tpl *appv1alpha1.ClusterTemplate) (map[string]interface{}, error) {
 	vars := make(map[string]interface{})
 	v := make(map[string]interface{})
 	err := template.SetVariablesFromEnvVar(ctx, template.VariablesInput{
@@ -140,7 +143,7 @@ func (r *ClusterReconciler) templateVariables(ctx context.Context, c client.Clie
 			cl.Status.LastUsedUID = split[len(split)-1]
 		}
 	}
-	if r.hasDiff(cl) && validDiff {
+	if (r.hasDiff(cl) || hasTemplateDiff(cl, tpl)) && validDiff {
 		cl.Status.LastUsedUID = string(uuid.NewUUID())
 	}
 	return vars, nil
@@ -166,6 +169,13 @@ func (r *ClusterReconciler) getBastionIP(ctx context.Context, cl appv1alpha1.Clu
 		if err != nil {
 			return "", err
 		}
+		if ip == "" {
+			// OpenStack exposes the bastion through a floating IP
+			ip, _, err = unstructured.NestedString(o.Object, "status", "bastion", "floatingIP")
+			if err != nil {
+				return "", err
+			}
+		}
 		return ip, nil
 	}
 	return "", nil
@@ -177,12 +187,16 @@ func (r *ClusterReconciler) reconcile(ctx context.Context, log logr.Logger, cl a
 	for _, w := range cl.Spec.Workers {
 		cl.Status.TotalWorkerReplicas += *w.Replicas
 	}
-	// we need to install calico in managed flavors too for network policy support
+	// the CNI is installed in managed flavors too for network policy support
 	err := r.reconcileCNI(ctx, &cl)
 	if err != nil {
 		meta.SetResourceCondition(&cl, meta.CNIInstalledCondition, metav1.ConditionFalse, meta.CNIInstalledFailedReason, err.Error())
 		return cl, ctrl.Result{}, err
 	}
+	err = r.reconcileAddons(ctx, &cl)
+	if err != nil {
+		return appv1alpha1.ClusterNotReady(cl, meta.ReconcileAddonsFailed, err.Error()), ctrl.Result{}, err
+	}
 
 	if cl.Spec.Bastion != nil {
 		if *cl.Spec.Bastion.Enabled && cl.Status.BastionPublicIP == "" {
@@ -200,17 +214,73 @@ func (r *ClusterReconciler) reconcile(ctx context.Context, log logr.Logger, cl a
 	if err != nil {
 		return appv1alpha1.ClusterNotReady(cl, meta.ReconcileNetworkFailed, err.Error()), ctrl.Result{}, err
 	}
-	if r.hasDiff(&cl) {
-		vars, err := r.templateVariables(ctx, r.Client, &cl)
+	// clusters created before the applied version was tracked have it copied in the status
+	if cl.Status.TargetKubernetesVersion == "" {
+		cl.Status.TargetKubernetesVersion = cl.Status.KubernetesVersion
+	}
+	if capiCluster.Status.ControlPlaneReady {
+		err = r.reconcileVersions(ctx, &cl, capiCluster)
+		if err != nil {
+			return appv1alpha1.ClusterNotReady(cl, meta.ReconcileVersionsFailed, err.Error()), ctrl.Result{}, err
+		}
+	}
+	tpl, err := r.clusterTemplate(ctx, &cl)
+	if err != nil {
+		return appv1alpha1.ClusterNotReady(cl, meta.TemplateAppliedFailed, err.Error()), ctrl.Result{}, err
+	}
+	// nodes drained before their worker pools are shrunk or deleted
+	draining := make([]string, 0)
+	if r.hasDiff(&cl) || hasTemplateDiff(&cl, tpl) || hasWorkersDiff(&cl) || isUpgrading(&cl) {
+		startUpgrade(&cl)
+		vars, err := r.templateVariables(ctx, r.Client, &cl, tpl)
 		if err != nil {
 			return appv1alpha1.ClusterNotReady(cl, meta.TemplateAppliedFailed, err.Error()), ctrl.Result{}, err
 		}
+		var cs kubernetes.Interface
+		canDrain := capiCluster.Status.ControlPlaneReady && capiCluster.Status.InfrastructureReady && nodeDrainTimeout(&cl) > 0
+		if canDrain {
+			cs, err = r.workloadClientset(ctx, &cl)
+			if err != nil {
+				return appv1alpha1.ClusterNotReady(cl, meta.DrainNodesFailed, err.Error()), ctrl.Result{}, err
+			}
+		}
 
-		objs, err := template.GetObjs(fs.FS, "clustertemplates", cl.GetTemplate(), vars)
+		objs, err := renderTemplate(&cl, tpl, vars)
 		if err != nil {
 			return appv1alpha1.ClusterNotReady(cl, meta.TemplateAppliedFailed, err.Error()), ctrl.Result{}, err
 		}
+		// shrinking pools are held with their infrastructure objects until their nodes are drained,
+		// so the pool sizes aren't applied before the machines are removed
+		drainingPools := make(map[int]bool)
+		for j := range objs {
+			o := &objs[j]
+			i := workerPoolIndex(&cl, *o)
+			if i < 0 || holdWorkerPool(&cl, *o) {
+				continue
+			}
+			err = r.keepAutoscaledReplicas(ctx, &cl, o)
+			if err != nil {
+				return cl, ctrl.Result{}, err
+			}
+			if !canDrain {
+				continue
+			}
+			pending, err := r.drainShrinkingPool(ctx, cs, &cl, o)
+			if err != nil {
+				return appv1alpha1.ClusterNotReady(cl, meta.DrainNodesFailed, err.Error()), ctrl.Result{}, err
+			}
+			if len(pending) > 0 {
+				draining = append(draining, pending...)
+				drainingPools[i] = true
+			}
+		}
 		for _, o := range objs {
+			if holdWorkerPool(&cl, o) {
+				continue
+			}
+			if drainingPools[workerPoolIndex(&cl, o)] || drainingPools[workerPoolInfrastructureIndex(&cl, o)] {
+				continue
+			}
 			if o.GetAPIVersion() == capi.GroupVersion.String() && o.GetKind() == "Cluster" {
 				err = ctrl.SetControllerReference(&cl, &o, scheme.Scheme)
 				if err != nil {
@@ -237,119 +307,262 @@ func (r *ClusterReconciler) reconcile(ctx context.Context, log logr.Logger, cl a
 			}
 		}
 	}
-	cl.Status.KubernetesVersion = cl.Spec.KubernetesVersion
+	cl.Status.TargetKubernetesVersion = cl.Spec.KubernetesVersion
+	setTemplateStatus(&cl, tpl)
 	cl.Status.ControlPlane = *cl.Spec.ControlPlane
-	cl.Status.Workers = cl.Spec.Workers
+	// the worker pools are applied again until their nodes are drained
+	if len(draining) == 0 {
+		cl.Status.Workers = cl.Spec.Workers
+	}
 	cl.Status.BastionConfig = cl.Spec.Bastion
 	if capiCluster.Status.ControlPlaneReady && capiCluster.Status.InfrastructureReady {
-		err = r.reconcileNodes(ctx, cl, capiCluster)
+		reachable, nextCheck, err := r.reconcileHealth(ctx, &cl)
+		if err != nil {
+			return appv1alpha1.ClusterNotReady(cl, meta.HealthCheckFailed, err.Error()), ctrl.Result{}, err
+		}
+		if !reachable {
+			return appv1alpha1.ClusterNotReady(cl, meta.APIServerUnreachableReason, "API server is unreachable"), ctrl.Result{RequeueAfter: nextCheck}, nil
+		}
+		removing, err := r.reconcileNodes(ctx, &cl, capiCluster)
 		if err != nil {
 			return appv1alpha1.ClusterNotReady(cl, meta.ReconcileNodesFailed, err.Error()), ctrl.Result{}, err
 		}
+		draining = append(draining, removing...)
+		setDrainingCondition(&cl, draining)
+		err = r.reconcileHealthChecks(ctx, &cl)
+		if err != nil {
+			return appv1alpha1.ClusterNotReady(cl, meta.ReconcileHealthChecksFailed, err.Error()), ctrl.Result{}, err
+		}
+		err = r.reconcileAutoscaler(ctx, &cl)
+		if err != nil {
+			return appv1alpha1.ClusterNotReady(cl, meta.ReconcileAutoscalerFailed, err.Error()), ctrl.Result{}, err
+		}
+		nextRotation, err := r.reconcileKubeconfig(ctx, &cl)
+		if err != nil {
+			return appv1alpha1.ClusterNotReady(cl, meta.ReconcileKubeconfigFailed, err.Error()), ctrl.Result{}, err
+		}
+		err = r.reconcileBackup(ctx, &cl)
+		if err != nil {
+			return appv1alpha1.ClusterNotReady(cl, meta.ReconcileBackupFailed, err.Error()), ctrl.Result{}, err
+		}
 		cl = appv1alpha1.ClusterReady(cl)
-		return cl, ctrl.Result{}, nil
+		if isUpgrading(&cl) || len(draining) > 0 {
+			return cl, ctrl.Result{RequeueAfter: 30 * time.Second}, nil
+		}
+		// requeued to check the cluster health or rotate the kubeconfig again
+		if nextRotation > 0 && (nextCheck == 0 || nextRotation < nextCheck) {
+			nextCheck = nextRotation
+		}
+		return cl, ctrl.Result{RequeueAfter: nextCheck}, nil
 	}
 	return appv1alpha1.ClusterNotReady(cl, meta.WaitProvisionReason, "wait cluster to be provisioned"), ctrl.Result{RequeueAfter: 30 * time.Second}, nil
 }
 
-func (r *ClusterReconciler) reconcileNodes(ctx context.Context, cl appv1alpha1.Cluster, capiCluster capi.Cluster) error {
+// reconcileNodes updates the nodes of the cluster and returns the nodes of removed worker pools being drained
+func (r *ClusterReconciler) reconcileNodes(ctx context.Context, cl *appv1alpha1.Cluster, capiCluster capi.Cluster) ([]string, error) {
 	wc, err := kube.NewClusterClient(ctx, r.Client, cl.Name, cl.GetNamespace())
 	if err != nil {
-		return err
+		return nil, err
+	}
+	cs, err := r.workloadClientset(ctx, cl)
+	if err != nil {
+		return nil, err
 	}
 	if !cl.Spec.InfrastructureProvider.IsManaged() {
-		if len(cl.Spec.ControlPlane.Labels) > 0 || len(cl.Spec.ControlPlane.Taints) > 0 {
-			cp, _, err := util.GetMachinesForCluster(ctx, r.Client, &capiCluster)
-			if err != nil {
-				return err
+		// nodes are updated even without labels and taints to remove the ones dropped from the spec
+		cp, _, err := util.GetMachinesForCluster(ctx, r.Client, &capiCluster)
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range cp.Items {
+			if m.Status.NodeRef == nil {
+				continue
 			}
-			for _, m := range cp.Items {
-				key := client.ObjectKey{
-					Name: m.Status.NodeRef.Name,
-				}
-				node := corev1.Node{}
-				err = wc.Get(ctx, key, &node)
-				if err != nil {
-					return err
-				}
-				if node.Labels == nil {
-					node.Labels = make(map[string]string)
-				}
-				for k, v := range cl.Spec.ControlPlane.Labels {
+			err = r.updateNode(ctx, wc, m.Status.NodeRef.Name, cl.Spec.ControlPlane.Node)
+			if client.IgnoreNotFound(err) != nil {
+				return nil, err
+			}
+		}
+	}
+	// workers
+	pools, removing, err := r.workerNodes(ctx, wc, cs, cl)
+	if err != nil {
+		return nil, err
+	}
+	providerIDs := make([]string, 0)
+	for _, nodes := range pools {
+		for _, n := range nodes {
+			if n.Spec.ProviderID != "" {
+				providerIDs = append(providerIDs, n.Spec.ProviderID)
+			}
+		}
+	}
+	capacity, err := cloud.CapacityTypes(ctx, r.Client, cl, providerIDs)
+	if err != nil {
+		return nil, err
+	}
+	for i, nodes := range pools {
+		w := cl.Spec.Workers[i]
+		var spot, onDemand int32
+		for _, n := range nodes {
+			node := w.Node
+			if ct, ok := capacity[n.Spec.ProviderID]; ok {
+				node.Labels = make(map[string]string, len(w.Labels)+1)
+				for k, v := range w.Labels {
 					node.Labels[k] = v
 				}
-				node.Spec.Taints = append(node.Spec.Taints, cl.Spec.ControlPlane.Taints...)
-				node.Spec.Taints = util.RemoveDuplicateTaints(node.Spec.Taints)
-				node.TypeMeta = metav1.TypeMeta{
-					APIVersion: "v1",
-					Kind:       "Node",
-				}
-				_, err = util.CreateOrUpdate(ctx, wc, &node)
-				if err != nil {
-					return err
+				node.Labels[meta.LabelCapacityType] = string(ct)
+				if ct == appv1alpha1.SpotCapacity {
+					spot++
+				} else {
+					onDemand++
 				}
 			}
+			err = r.updateNode(ctx, wc, n.Name, node)
+			if client.IgnoreNotFound(err) != nil {
+				return nil, err
+			}
+		}
+		if i < len(cl.Status.WorkerPools) {
+			cl.Status.WorkerPools[i].SpotReplicas = spot
+			cl.Status.WorkerPools[i].OnDemandReplicas = onDemand
 		}
 	}
-	// workers
+	return removing, nil
+}
+
+// workerNodes returns the nodes of each worker pool by index. The pools removed
+// from the cluster spec are deleted after their nodes are drained.
+func (r *ClusterReconciler) workerNodes(ctx context.Context, wc client.Client, cs kubernetes.Interface, cl *appv1alpha1.Cluster) (map[int][]corev1.Node, []string, error) {
+	pools := make(map[int][]corev1.Node)
+	removing := make([]string, 0)
 	mpList := capiexp.MachinePoolList{}
-	err = r.List(ctx, &mpList, client.HasLabels{capi.ClusterLabelName})
+	err := r.List(ctx, &mpList, client.HasLabels{capi.ClusterLabelName})
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
-	for _, mp := range mpList.Items {
+	for i := range mpList.Items {
+		mp := &mpList.Items[i]
 		if mp.Labels[capi.ClusterLabelName] != cl.Name {
 			continue
 		}
-		w, err := cl.GetWorkerRefByMachinePool(mp.Name)
+		nodes := make([]corev1.Node, 0, len(mp.Status.NodeRefs))
+		for _, ref := range mp.Status.NodeRefs {
+			n := corev1.Node{}
+			err = wc.Get(ctx, client.ObjectKey{Name: ref.Name}, &n)
+			if err != nil {
+				if client.IgnoreNotFound(err) != nil {
+					return nil, nil, err
+				}
+				continue
+			}
+			nodes = append(nodes, n)
+		}
+		index, err := cl.GetWorkerIndexByMachinePool(mp.Name)
 		if err != nil {
 			if err == appv1alpha1.InvalidMP {
-				err = r.Delete(ctx, &mp)
+				pending, err := r.removeWorkerPool(ctx, cs, cl, mp, nodes)
 				if err != nil {
-					return err
+					return nil, nil, err
 				}
+				removing = append(removing, pending...)
 				continue
 			}
-			return err
+			return nil, nil, err
 		}
-		if len(w.Labels) == 0 && len(w.Taints) == 0 {
-			continue
+		pools[index] = append(pools[index], nodes...)
+	}
+	// machine deployments run the workers of providers without machine pools
+	mdList := capi.MachineDeploymentList{}
+	err = r.List(ctx, &mdList, client.InNamespace(cl.GetNamespace()), client.MatchingLabels{capi.ClusterLabelName: cl.Name})
+	if err != nil {
+		return nil, nil, err
+	}
+	for i := range mdList.Items {
+		md := &mdList.Items[i]
+		machines := capi.MachineList{}
+		err = r.List(ctx, &machines, client.InNamespace(md.Namespace), client.MatchingLabels{capi.MachineDeploymentLabelName: md.Name})
+		if err != nil {
+			return nil, nil, err
 		}
-		for _, ref := range mp.Status.NodeRefs {
-			key := client.ObjectKey{
-				Name: ref.Name,
-			}
-			node := corev1.Node{}
-			err = wc.Get(ctx, key, &node)
-			if err != nil {
-				if client.IgnoreNotFound(err) != nil {
-					return err
+		nodes, err := machineNodes(ctx, wc, machines.Items)
+		if err != nil {
+			return nil, nil, err
+		}
+		index, err := cl.GetWorkerIndexByMachinePool(md.Name)
+		if err != nil {
+			if err == appv1alpha1.InvalidMP {
+				pending, err := r.removeWorkerPool(ctx, cs, cl, md, nodes)
+				if err != nil {
+					return nil, nil, err
 				}
+				removing = append(removing, pending...)
 				continue
 			}
-			if node.Labels == nil {
-				node.Labels = make(map[string]string)
-			}
-			for k, v := range w.Labels {
-				node.Labels[k] = v
-			}
-			node.Spec.Taints = append(node.Spec.Taints, w.Taints...)
-			node.Spec.Taints = util.RemoveDuplicateTaints(node.Spec.Taints)
-			node.TypeMeta = metav1.TypeMeta{
-				APIVersion: "v1",
-				Kind:       "Node",
-			}
-			_, err = util.CreateOrUpdate(ctx, wc, &node)
-			if err != nil {
-				return err
-			}
+			return nil, nil, err
 		}
+		pools[index] = append(pools[index], nodes...)
 	}
-	return nil
+	return pools, removing, nil
+}
+
+// updateNode sets the labels and taints of the node. The ones set before
+// and dropped from the spec are removed, the ones set by others are kept.
+func (r *ClusterReconciler) updateNode(ctx context.Context, wc client.Client, name string, n appv1alpha1.Node) error {
+	key := client.ObjectKey{
+		Name: name,
+	}
+	node := corev1.Node{}
+	err := wc.Get(ctx, key, &node)
+	if err != nil {
+		return err
+	}
+	old := node.DeepCopy()
+	if node.Labels == nil {
+		node.Labels = make(map[string]string)
+	}
+	if node.Annotations == nil {
+		node.Annotations = make(map[string]string)
+	}
+	labels := util.UpdateManagedLabels(node.Labels, managedKeys(node.Annotations[meta.ManagedLabelsAnnotation]), n.Labels)
+	var taints []string
+	node.Spec.Taints, taints = util.UpdateManagedTaints(node.Spec.Taints, managedKeys(node.Annotations[meta.ManagedTaintsAnnotation]), n.Taints)
+	setManagedKeys(node.Annotations, meta.ManagedLabelsAnnotation, labels)
+	setManagedKeys(node.Annotations, meta.ManagedTaintsAnnotation, taints)
+	if equality.Semantic.DeepEqual(old, &node) {
+		return nil
+	}
+	node.TypeMeta = metav1.TypeMeta{
+		APIVersion: "v1",
+		Kind:       "Node",
+	}
+	_, err = util.CreateOrUpdate(ctx, wc, &node)
+	return err
+}
+
+func managedKeys(annotation string) []string {
+	if annotation == "" {
+		return nil
+	}
+	return strings.Split(annotation, ",")
+}
+
+func setManagedKeys(annotations map[string]string, annotation string, keys []string) {
+	if len(keys) == 0 {
+		delete(annotations, annotation)
+		return
+	}
+	annotations[annotation] = strings.Join(keys, ",")
+}
+
+// hasWorkersDiff returns if the worker pools changed. They are applied
+// without replacing the control plane machines.
+func hasWorkersDiff(cl *appv1alpha1.Cluster) bool {
+	return !reflect.DeepEqual(cl.Spec.Workers, cl.Status.Workers)
 }
 
 func (r *ClusterReconciler) hasDiff(cl *appv1alpha1.Cluster) bool {
-	if cl.Spec.KubernetesVersion != cl.Status.KubernetesVersion {
+	if cl.Spec.KubernetesVersion != cl.Status.TargetKubernetesVersion {
 		return true
 	}
 	if !cl.Spec.InfrastructureProvider.IsManaged() && cl.Spec.ControlPlane != nil {
@@ -363,19 +576,67 @@ func (r *ClusterReconciler) hasDiff(cl *appv1alpha1.Cluster) bool {
 	return false
 }
 
-func (r *ClusterReconciler) reconcileCNI(ctx context.Context, cl *appv1alpha1.Cluster) error {
-	const (
-		cniCalicoName = "calico"
-		chartRepo     = "https://registry.undistro.io/chartrepo/library"
-		calicoVersion = "3.19.1"
+// cniCharts are the charts installed for each CNI provider
+var cniCharts = map[appv1alpha1.CNIProvider]appv1alpha1.RepoChartSource{
+	appv1alpha1.CalicoCNI: {
+		RepoURL: "https://registry.undistro.io/chartrepo/library",
+		Name:    "calico",
+	},
+	appv1alpha1.CiliumCNI: {
+		RepoURL: "https://helm.cilium.io",
+		Name:    "cilium",
+	},
+}
+
+// cniValues returns the values of the provider with the ones in the spec merged over them
+func cniValues(cl *appv1alpha1.Cluster, cni appv1alpha1.CNI) ([]byte, error) {
+	var (
+		v   []byte
+		err error
 	)
+	switch cni.Provider {
+	case appv1alpha1.CalicoCNI:
+		v, err = cloud.CalicoValues(cl.Spec.InfrastructureProvider)
+	case appv1alpha1.CiliumCNI:
+		v, err = cloud.CiliumValues(cl)
+	}
+	if err != nil || cni.Values == nil {
+		return v, err
+	}
+	base := make(map[string]interface{})
+	err = json.Unmarshal(v, &base)
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[string]interface{})
+	err = json.Unmarshal(cni.Values.Raw, &values)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(util.MergeMaps(base, values))
+}
 
-	v, err := cloud.CalicoValues(cl.Spec.InfrastructureProvider.Flavor)
+func cniReleaseName(cl *appv1alpha1.Cluster, provider appv1alpha1.CNIProvider) string {
+	return fmt.Sprintf("%s-%s", provider, cl.Name)
+}
+
+func (r *ClusterReconciler) reconcileCNI(ctx context.Context, cl *appv1alpha1.Cluster) error {
+	cni := cl.Spec.Network.GetCNI()
+	if cni.Provider == appv1alpha1.NoCNI {
+		meta.SetResourceCondition(cl, meta.CNIInstalledCondition, metav1.ConditionTrue, meta.CNIProvidedByUserReason, "CNI is provided by the user")
+		return nil
+	}
+	chart, ok := cniCharts[cni.Provider]
+	if !ok {
+		return fmt.Errorf("CNI %s is not supported", cni.Provider)
+	}
+	chart.Version = cni.Version
+	v, err := cniValues(cl, cni)
 	if err != nil {
 		return err
 	}
 	key := client.ObjectKey{
-		Name:      cniCalicoName,
+		Name:      cniReleaseName(cl, cni.Provider),
 		Namespace: cl.GetNamespace(),
 	}
 	hr := appv1alpha1.HelmRelease{}
@@ -390,21 +651,13 @@ func (r *ClusterReconciler) reconcileCNI(ctx context.Context, cl *appv1alpha1.Cl
 				Kind:       "HelmRelease",
 			},
 			ObjectMeta: metav1.ObjectMeta{
-				Name:      fmt.Sprintf("%s-%s", cniCalicoName, cl.Name),
-				Namespace: cl.GetNamespace(),
+				Name:      key.Name,
+				Namespace: key.Namespace,
 			},
 			Spec: appv1alpha1.HelmReleaseSpec{
 				TargetNamespace: "kube-system",
-				ReleaseName:     cniCalicoName,
-				Values:          &apiextensionsv1.JSON{Raw: v},
+				ReleaseName:     string(cni.Provider),
 				ClusterName:     fmt.Sprintf("%s/%s", cl.GetNamespace(), cl.Name),
-				Chart: appv1alpha1.ChartSource{
-					RepoChartSource: appv1alpha1.RepoChartSource{
-						RepoURL: chartRepo,
-						Name:    cniCalicoName,
-						Version: calicoVersion,
-					},
-				},
 			},
 		}
 		err = ctrl.SetControllerReference(cl, &hr, r.Scheme)
@@ -412,21 +665,28 @@ func (r *ClusterReconciler) reconcileCNI(ctx context.Context, cl *appv1alpha1.Cl
 			return err
 		}
 	}
+	hr.Spec.Chart = appv1alpha1.ChartSource{
+		RepoChartSource: chart,
+	}
+	hr.Spec.Values = &apiextensionsv1.JSON{Raw: v}
 	if hr.Annotations == nil {
 		hr.Annotations = make(map[string]string)
 	}
-	hr.Annotations[meta.CNIAnnotation] = cniCalicoName
+	hr.Annotations[meta.CNIAnnotation] = string(cni.Provider)
 	_, err = util.CreateOrUpdate(ctx, r.Client, &hr)
 	if err != nil {
 		return err
 	}
 	if meta.InReadyCondition(hr.Status.Conditions) {
-		meta.SetResourceCondition(cl, meta.CNIInstalledCondition, metav1.ConditionTrue, meta.CNIInstalledSuccessReason, "calico installed")
+		meta.SetResourceCondition(cl, meta.CNIInstalledCondition, metav1.ConditionTrue, meta.CNIInstalledSuccessReason, fmt.Sprintf("%s installed", cni.Provider))
 	}
 	return nil
 }
 
 func (r *ClusterReconciler) reconcileDelete(ctx context.Context, cl appv1alpha1.Cluster) (ctrl.Result, error) {
+	if cl.Spec.DeletionPolicy == appv1alpha1.OrphanPolicy {
+		return r.reconcileOrphan(ctx, cl)
+	}
 	capiCluster := capi.Cluster{}
 	err := r.Get(ctx, client.ObjectKeyFromObject(&cl), &capiCluster)
 	if apierrors.IsNotFound(err) {
@@ -443,7 +703,7 @@ func (r *ClusterReconciler) reconcileDelete(ctx context.Context, cl appv1alpha1.
 	}
 	for i := range cl.Spec.Workers {
 		key := client.ObjectKey{
-			Name:      fmt.Sprintf("%s-mp-%d", cl.Name, i),
+			Name:      cl.MachinePoolName(i),
 			Namespace: cl.GetNamespace(),
 		}
 		mp := capiexp.MachinePool{}
@@ -466,6 +726,52 @@ func (r *ClusterReconciler) reconcileDelete(ctx context.Context, cl appv1alpha1.
 	return ctrl.Result{Requeue: true}, nil
 }
 
+// reconcileOrphan detaches the cluster from UnDistro. The CAPI objects are kept, so the
+// cloud resources aren't destroyed, and the releases are deleted without being uninstalled.
+func (r *ClusterReconciler) reconcileOrphan(ctx context.Context, cl appv1alpha1.Cluster) (ctrl.Result, error) {
+	capiCluster := capi.Cluster{}
+	err := r.Get(ctx, client.ObjectKeyFromObject(&cl), &capiCluster)
+	if client.IgnoreNotFound(err) != nil {
+		return ctrl.Result{}, err
+	}
+	if err == nil {
+		base := capiCluster.DeepCopy()
+		refs := make([]metav1.OwnerReference, 0, len(capiCluster.OwnerReferences))
+		for _, ref := range capiCluster.OwnerReferences {
+			if ref.UID != cl.UID {
+				refs = append(refs, ref)
+			}
+		}
+		capiCluster.SetOwnerReferences(refs)
+		err = r.Patch(ctx, &capiCluster, client.MergeFrom(base))
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+	err = r.removeDeps(ctx, cl)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	// releases are uninstalled by their finalizer when the cluster is gone
+	hrList := appv1alpha1.HelmReleaseList{}
+	err = r.List(ctx, &hrList)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	hrClusterName := fmt.Sprintf("%s/%s", cl.GetNamespace(), cl.Name)
+	for _, item := range hrList.Items {
+		if item.Spec.ClusterName == hrClusterName {
+			return ctrl.Result{RequeueAfter: 5 * time.Second}, nil
+		}
+	}
+	controllerutil.RemoveFinalizer(&cl, meta.Finalizer)
+	_, err = util.CreateOrUpdate(ctx, r.Client, &cl)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{}, nil
+}
+
 func (r *ClusterReconciler) removeDeps(ctx context.Context, cl appv1alpha1.Cluster) error {
 	hrClusterName := fmt.Sprintf("%s/%s", cl.GetNamespace(), cl.Name)
 	hrList := appv1alpha1.HelmReleaseList{}
@@ -519,5 +825,11 @@ func (r *ClusterReconciler) SetupWithManager(mgr ctrl.Manager) error {
 			},
 			handler.EnqueueRequestsFromMapFunc(r.capiToUndistro),
 		).
+		Watches(
+			&source.Kind{
+				Type: &appv1alpha1.ClusterTemplate{},
+			},
+			handler.EnqueueRequestsFromMapFunc(r.templateToClusters),
+		).
 		Complete(r)
 }
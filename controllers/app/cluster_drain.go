@@ -0,0 +1,284 @@
+/*
+Copyright 2020-2021 The UnDistro authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	appv1alpha1 "github.com/getupio-undistro/undistro/apis/app/v1alpha1"
+	"github.com/getupio-undistro/undistro/pkg/cloud"
+	"github.com/getupio-undistro/undistro/pkg/kube"
+	"github.com/getupio-undistro/undistro/pkg/meta"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/kubectl/pkg/drain"
+	"k8s.io/utils/pointer"
+	capi "sigs.k8s.io/cluster-api/api/v1alpha3"
+	capiexp "sigs.k8s.io/cluster-api/exp/api/v1alpha3"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// drainStartedAnnotation records when UnDistro cordoned the node to remove it from the pool
+	drainStartedAnnotation = "undistro.io/drain-started-at"
+	// deleteMachineAnnotation makes CAPI remove the machine first when a machine deployment is shrunk
+	deleteMachineAnnotation = "cluster.x-k8s.io/delete-machine"
+	// drainAttemptTimeout bounds each drain attempt, so a pod blocked by
+	// a disruption budget doesn't hold the reconciliation
+	drainAttemptTimeout = 20 * time.Second
+
+	defaultNodeDrainTimeout = 10 * time.Minute
+)
+
+func nodeDrainTimeout(cl *appv1alpha1.Cluster) time.Duration {
+	if cl.Spec.NodeDrainTimeout == nil {
+		return defaultNodeDrainTimeout
+	}
+	return cl.Spec.NodeDrainTimeout.Duration
+}
+
+// poolMember is a node of a worker pool and its machine, machine pools don't have machines
+type poolMember struct {
+	node    corev1.Node
+	machine *capi.Machine
+}
+
+func (r *ClusterReconciler) workloadClientset(ctx context.Context, cl *appv1alpha1.Cluster) (kubernetes.Interface, error) {
+	cfg, err := kube.NewClusterConfig(ctx, r.Client, cl.Name, cl.GetNamespace())
+	if err != nil {
+		return nil, err
+	}
+	return kubernetes.NewForConfig(cfg)
+}
+
+// drainNodes cordons the nodes and evicts their pods respecting PodDisruptionBudgets.
+// It returns the nodes still being drained. Nodes are considered drained when the timeout expires.
+func drainNodes(ctx context.Context, cs kubernetes.Interface, names []string, timeout time.Duration) ([]string, error) {
+	pending := make([]string, 0)
+	for _, name := range names {
+		node, err := cs.CoreV1().Nodes().Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			if apierrors.IsNotFound(err) {
+				continue
+			}
+			return nil, err
+		}
+		started, ok := node.Annotations[drainStartedAnnotation]
+		if !ok {
+			started = time.Now().UTC().Format(time.RFC3339)
+			patch := fmt.Sprintf(`{"metadata":{"annotations":{%q:%q}}}`, drainStartedAnnotation, started)
+			node, err = cs.CoreV1().Nodes().Patch(ctx, name, types.MergePatchType, []byte(patch), metav1.PatchOptions{})
+			if err != nil {
+				return nil, err
+			}
+		}
+		t, err := time.Parse(time.RFC3339, started)
+		if err == nil && time.Since(t) > timeout {
+			continue
+		}
+		helper := &drain.Helper{
+			Ctx:                 ctx,
+			Client:              cs,
+			Force:               true,
+			IgnoreAllDaemonSets: true,
+			DeleteEmptyDirData:  true,
+			GracePeriodSeconds:  -1,
+			Timeout:             drainAttemptTimeout,
+			Out:                 io.Discard,
+			ErrOut:              io.Discard,
+		}
+		err = drain.RunCordonOrUncordon(helper, node, true)
+		if err != nil {
+			return nil, err
+		}
+		err = drain.RunNodeDrain(helper, name)
+		if err != nil {
+			// pods protected by disruption budgets are evicted in the next attempts
+			pending = append(pending, name)
+		}
+	}
+	return pending, nil
+}
+
+// workerPoolInfrastructureIndex returns the index of the worker pool of the AWS machine pool object,
+// which holds the pool sizes, or -1 when the object isn't one
+func workerPoolInfrastructureIndex(cl *appv1alpha1.Cluster, o unstructured.Unstructured) int {
+	switch o.GetKind() {
+	case "AWSMachinePool", "AWSManagedMachinePool":
+	default:
+		return -1
+	}
+	for i := range cl.Spec.Workers {
+		if o.GetName() == cl.MachinePoolName(i) {
+			return i
+		}
+	}
+	return -1
+}
+
+// poolMembers returns the nodes and the replicas of the worker pool object when it exists
+func (r *ClusterReconciler) poolMembers(ctx context.Context, cs kubernetes.Interface, o client.Object) ([]poolMember, int32, error) {
+	members := make([]poolMember, 0)
+	addNode := func(name string, m *capi.Machine) error {
+		n, err := cs.CoreV1().Nodes().Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			if apierrors.IsNotFound(err) {
+				return nil
+			}
+			return err
+		}
+		members = append(members, poolMember{node: *n, machine: m})
+		return nil
+	}
+	key := client.ObjectKeyFromObject(o)
+	if o.GetObjectKind().GroupVersionKind().Kind == "MachinePool" {
+		mp := capiexp.MachinePool{}
+		err := r.Get(ctx, key, &mp)
+		if err != nil {
+			return nil, 0, client.IgnoreNotFound(err)
+		}
+		for _, ref := range mp.Status.NodeRefs {
+			err = addNode(ref.Name, nil)
+			if err != nil {
+				return nil, 0, err
+			}
+		}
+		return members, pointer.Int32Deref(mp.Spec.Replicas, 0), nil
+	}
+	md := capi.MachineDeployment{}
+	err := r.Get(ctx, key, &md)
+	if err != nil {
+		return nil, 0, client.IgnoreNotFound(err)
+	}
+	machines := capi.MachineList{}
+	err = r.List(ctx, &machines, client.InNamespace(md.Namespace), client.MatchingLabels{capi.MachineDeploymentLabelName: md.Name})
+	if err != nil {
+		return nil, 0, err
+	}
+	for i := range machines.Items {
+		m := &machines.Items[i]
+		if m.Status.NodeRef == nil {
+			continue
+		}
+		err = addNode(m.Status.NodeRef.Name, m)
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+	return members, pointer.Int32Deref(md.Spec.Replicas, 0), nil
+}
+
+// drainShrinkingPool drains the nodes removed when the rendered worker pool has fewer replicas
+// than the current one. The pool is shrunk when it returns no pending nodes.
+// Nodes already being drained are chosen first, then the newest ones.
+func (r *ClusterReconciler) drainShrinkingPool(ctx context.Context, cs kubernetes.Interface, cl *appv1alpha1.Cluster, o *unstructured.Unstructured) ([]string, error) {
+	desired, ok, err := unstructured.NestedInt64(o.Object, "spec", "replicas")
+	if err != nil || !ok {
+		return nil, err
+	}
+	members, current, err := r.poolMembers(ctx, cs, o)
+	if err != nil {
+		return nil, err
+	}
+	if int64(current) <= desired {
+		return nil, nil
+	}
+	sort.SliceStable(members, func(i, j int) bool {
+		_, iStarted := members[i].node.Annotations[drainStartedAnnotation]
+		_, jStarted := members[j].node.Annotations[drainStartedAnnotation]
+		if iStarted != jStarted {
+			return iStarted
+		}
+		return members[j].node.CreationTimestamp.Before(&members[i].node.CreationTimestamp)
+	})
+	n := int(int64(current) - desired)
+	if n > len(members) {
+		n = len(members)
+	}
+	victims := members[:n]
+	names := make([]string, 0, len(victims))
+	for _, v := range victims {
+		names = append(names, v.node.Name)
+	}
+	pending, err := drainNodes(ctx, cs, names, nodeDrainTimeout(cl))
+	if err != nil || len(pending) > 0 {
+		return pending, err
+	}
+	return nil, r.removeMembers(ctx, cl, victims)
+}
+
+// removeMembers makes sure the drained nodes are the ones removed when the pool is shrunk
+func (r *ClusterReconciler) removeMembers(ctx context.Context, cl *appv1alpha1.Cluster, members []poolMember) error {
+	providerIDs := make([]string, 0)
+	for _, m := range members {
+		if m.machine == nil {
+			providerIDs = append(providerIDs, m.node.Spec.ProviderID)
+			continue
+		}
+		base := m.machine.DeepCopy()
+		if m.machine.Annotations == nil {
+			m.machine.Annotations = make(map[string]string)
+		}
+		m.machine.Annotations[deleteMachineAnnotation] = "yes"
+		err := r.Patch(ctx, m.machine, client.MergeFrom(base))
+		if err != nil {
+			return err
+		}
+	}
+	if len(providerIDs) == 0 {
+		return nil
+	}
+	_, err := cloud.RemoveMachines(ctx, r.Client, cl, providerIDs)
+	return err
+}
+
+// removeWorkerPool drains the nodes of a pool removed from the cluster spec and deletes it
+func (r *ClusterReconciler) removeWorkerPool(ctx context.Context, cs kubernetes.Interface, cl *appv1alpha1.Cluster, pool client.Object, nodes []corev1.Node) ([]string, error) {
+	if timeout := nodeDrainTimeout(cl); timeout > 0 {
+		names := make([]string, 0, len(nodes))
+		for _, n := range nodes {
+			names = append(names, n.Name)
+		}
+		pending, err := drainNodes(ctx, cs, names, timeout)
+		if err != nil || len(pending) > 0 {
+			return pending, err
+		}
+	}
+	return nil, r.Delete(ctx, pool)
+}
+
+// setDrainingCondition reports the nodes being drained
+func setDrainingCondition(cl *appv1alpha1.Cluster, pending []string) {
+	if len(pending) > 0 {
+		msg := fmt.Sprintf("draining nodes %s", strings.Join(pending, ", "))
+		meta.SetResourceCondition(cl, meta.NodesDrainingCondition, metav1.ConditionTrue, meta.DrainingNodesReason, msg)
+		return
+	}
+	if apimeta.IsStatusConditionTrue(cl.Status.Conditions, meta.NodesDrainingCondition) {
+		meta.SetResourceCondition(cl, meta.NodesDrainingCondition, metav1.ConditionFalse, meta.NodesDrainedReason, "nodes drained")
+	}
+}
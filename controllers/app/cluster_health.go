@@ -0,0 +1,239 @@
+/*
+Copyright 2020-2021 The UnDistro authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	appv1alpha1 "github.com/getupio-undistro/undistro/apis/app/v1alpha1"
+	"github.com/getupio-undistro/undistro/pkg/kube"
+	"github.com/getupio-undistro/undistro/pkg/meta"
+	"github.com/getupio-undistro/undistro/pkg/scheme"
+	corev1 "k8s.io/api/core/v1"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	capi "sigs.k8s.io/cluster-api/api/v1alpha3"
+	capiexp "sigs.k8s.io/cluster-api/exp/api/v1alpha3"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	defaultHealthCheckInterval = 5 * time.Minute
+	// healthCheckTimeout bounds the requests to the workload cluster, so an unreachable
+	// API server doesn't hold the reconciliation
+	healthCheckTimeout = 15 * time.Second
+)
+
+func healthCheckInterval(cl *appv1alpha1.Cluster) time.Duration {
+	if cl.Spec.HealthCheckInterval == nil {
+		return defaultHealthCheckInterval
+	}
+	return cl.Spec.HealthCheckInterval.Duration
+}
+
+// reconcileHealth checks the workload cluster when the health check interval has passed.
+// It returns if the API server is reachable and when the next check is due, 0 when they are disabled.
+func (r *ClusterReconciler) reconcileHealth(ctx context.Context, cl *appv1alpha1.Cluster) (bool, time.Duration, error) {
+	interval := healthCheckInterval(cl)
+	if interval == 0 {
+		return true, 0, nil
+	}
+	if cl.Status.LastHealthCheckTime != nil {
+		next := interval - time.Since(cl.Status.LastHealthCheckTime.Time)
+		if next > 0 {
+			return !apimeta.IsStatusConditionFalse(cl.Status.Conditions, meta.APIServerReachableCondition), next, nil
+		}
+	}
+	now := metav1.Now()
+	cl.Status.LastHealthCheckTime = &now
+	wc, err := r.healthCheckClient(ctx, cl)
+	if err == nil {
+		nodes := corev1.NodeList{}
+		err = wc.List(ctx, &nodes)
+		if err == nil {
+			meta.SetResourceCondition(cl, meta.APIServerReachableCondition, metav1.ConditionTrue, meta.HealthCheckSucceededReason, "API server is reachable")
+			err = r.checkNodes(ctx, cl, nodes.Items)
+			if err != nil {
+				return true, 0, err
+			}
+			err = r.checkAddons(ctx, wc, cl)
+			if err != nil {
+				return true, 0, err
+			}
+			return true, interval, nil
+		}
+	}
+	msg := fmt.Sprintf("API server is unreachable: %v", err)
+	meta.SetResourceCondition(cl, meta.APIServerReachableCondition, metav1.ConditionFalse, meta.APIServerUnreachableReason, msg)
+	meta.SetResourceCondition(cl, meta.NodesHealthyCondition, metav1.ConditionUnknown, meta.APIServerUnreachableReason, msg)
+	meta.SetResourceCondition(cl, meta.AddonsHealthyCondition, metav1.ConditionUnknown, meta.APIServerUnreachableReason, msg)
+	return false, interval, nil
+}
+
+func (r *ClusterReconciler) healthCheckClient(ctx context.Context, cl *appv1alpha1.Cluster) (client.Client, error) {
+	cfg, err := kube.NewClusterConfig(ctx, r.Client, cl.Name, cl.GetNamespace())
+	if err != nil {
+		return nil, err
+	}
+	cfg.Timeout = healthCheckTimeout
+	return client.New(cfg, client.Options{
+		Scheme: scheme.Scheme,
+	})
+}
+
+// checkNodes reports the ratio of ready nodes in the control plane and in each worker pool
+func (r *ClusterReconciler) checkNodes(ctx context.Context, cl *appv1alpha1.Cluster, nodes []corev1.Node) error {
+	byName := make(map[string]corev1.Node, len(nodes))
+	cpNames := make([]string, 0)
+	for _, n := range nodes {
+		byName[n.Name] = n
+		_, master := n.Labels[meta.LabelK8sMaster]
+		_, cp := n.Labels[meta.LabelK8sCP]
+		if master || cp {
+			cpNames = append(cpNames, n.Name)
+		}
+	}
+	healthy := true
+	ratios := make([]string, 0, len(cl.Spec.Workers)+1)
+	countReady := func(pool string, names []string) int32 {
+		var ready int32
+		for _, name := range names {
+			if n, ok := byName[name]; ok && isNodeReady(n) {
+				ready++
+			}
+		}
+		if int(ready) < len(names) {
+			healthy = false
+		}
+		ratios = append(ratios, fmt.Sprintf("%s %d/%d", pool, ready, len(names)))
+		return ready
+	}
+	if !cl.Spec.InfrastructureProvider.IsManaged() {
+		countReady("control plane", cpNames)
+	}
+	for i := range cl.Spec.Workers {
+		names, err := r.poolNodeNames(ctx, cl, i)
+		if err != nil {
+			return err
+		}
+		ready := countReady(cl.WorkerPoolName(i), names)
+		if i < len(cl.Status.WorkerPools) {
+			cl.Status.WorkerPools[i].ReadyNodes = ready
+		}
+	}
+	msg := fmt.Sprintf("ready nodes: %s", strings.Join(ratios, ", "))
+	if !healthy {
+		meta.SetResourceCondition(cl, meta.NodesHealthyCondition, metav1.ConditionFalse, meta.NodesNotReadyReason, msg)
+		return nil
+	}
+	meta.SetResourceCondition(cl, meta.NodesHealthyCondition, metav1.ConditionTrue, meta.HealthCheckSucceededReason, msg)
+	return nil
+}
+
+// poolNodeNames returns the names of the nodes of the worker pool at the index
+func (r *ClusterReconciler) poolNodeNames(ctx context.Context, cl *appv1alpha1.Cluster, i int) ([]string, error) {
+	pool, err := r.workerPool(ctx, cl, i)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0)
+	switch p := pool.(type) {
+	case *capiexp.MachinePool:
+		for _, ref := range p.Status.NodeRefs {
+			names = append(names, ref.Name)
+		}
+	case *capi.MachineDeployment:
+		machines := capi.MachineList{}
+		err = r.List(ctx, &machines, client.InNamespace(p.Namespace), client.MatchingLabels{capi.MachineDeploymentLabelName: p.Name})
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range machines.Items {
+			if m.Status.NodeRef != nil {
+				names = append(names, m.Status.NodeRef.Name)
+			}
+		}
+	}
+	return names, nil
+}
+
+func isNodeReady(n corev1.Node) bool {
+	for _, c := range n.Status.Conditions {
+		if c.Type == corev1.NodeReady {
+			return c.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// checkAddons reports the kube-system pods and the CNI and addon releases that aren't ready
+func (r *ClusterReconciler) checkAddons(ctx context.Context, wc client.Client, cl *appv1alpha1.Cluster) error {
+	unhealthy := make([]string, 0)
+	pods := corev1.PodList{}
+	err := wc.List(ctx, &pods, client.InNamespace(metav1.NamespaceSystem))
+	if err != nil {
+		return err
+	}
+	for _, p := range pods.Items {
+		if p.DeletionTimestamp.IsZero() && !isPodHealthy(p) {
+			unhealthy = append(unhealthy, fmt.Sprintf("pod %s/%s", p.Namespace, p.Name))
+		}
+	}
+	releases := make([]string, 0, len(cl.Spec.Addons)+1)
+	cni := cl.Spec.Network.GetCNI()
+	if cni.Provider != appv1alpha1.NoCNI {
+		releases = append(releases, cniReleaseName(cl, cni.Provider))
+	}
+	for _, a := range cl.Spec.Addons {
+		releases = append(releases, cl.AddonReleaseName(a.Name))
+	}
+	for _, name := range releases {
+		hr := appv1alpha1.HelmRelease{}
+		err = r.Get(ctx, client.ObjectKey{Name: name, Namespace: cl.GetNamespace()}, &hr)
+		if client.IgnoreNotFound(err) != nil {
+			return err
+		}
+		if err != nil || !meta.InReadyCondition(hr.Status.Conditions) {
+			unhealthy = append(unhealthy, fmt.Sprintf("helmrelease %s", name))
+		}
+	}
+	if len(unhealthy) > 0 {
+		msg := fmt.Sprintf("not ready: %s", strings.Join(unhealthy, ", "))
+		meta.SetResourceCondition(cl, meta.AddonsHealthyCondition, metav1.ConditionFalse, meta.AddonsNotReadyReason, msg)
+		return nil
+	}
+	meta.SetResourceCondition(cl, meta.AddonsHealthyCondition, metav1.ConditionTrue, meta.HealthCheckSucceededReason, "addons are ready")
+	return nil
+}
+
+// isPodHealthy returns if the pod completed or is running with its containers ready
+func isPodHealthy(p corev1.Pod) bool {
+	switch p.Status.Phase {
+	case corev1.PodSucceeded:
+		return true
+	case corev1.PodRunning:
+		for _, c := range p.Status.Conditions {
+			if c.Type == corev1.PodReady {
+				return c.Status == corev1.ConditionTrue
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,213 @@
+/*
+Copyright 2020-2021 The UnDistro authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package app
+
+import (
+	"context"
+	"testing"
+
+	appv1alpha1 "github.com/getupio-undistro/undistro/apis/app/v1alpha1"
+	"github.com/getupio-undistro/undistro/pkg/meta"
+	"github.com/getupio-undistro/undistro/pkg/scheme"
+	corev1 "k8s.io/api/core/v1"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	capi "sigs.k8s.io/cluster-api/api/v1alpha3"
+	capiexp "sigs.k8s.io/cluster-api/exp/api/v1alpha3"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func testPod(name string, phase corev1.PodPhase, ready corev1.ConditionStatus) *corev1.Pod {
+	p := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: metav1.NamespaceSystem},
+		Status:     corev1.PodStatus{Phase: phase},
+	}
+	if ready != "" {
+		p.Status.Conditions = []corev1.PodCondition{{Type: corev1.PodReady, Status: ready}}
+	}
+	return p
+}
+
+func testNode(name string, ready corev1.ConditionStatus, labels map[string]string) *corev1.Node {
+	return &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels},
+		Status: corev1.NodeStatus{
+			Conditions: []corev1.NodeCondition{{Type: corev1.NodeReady, Status: ready}},
+		},
+	}
+}
+
+func TestIsPodHealthy(t *testing.T) {
+	tests := []struct {
+		name string
+		pod  *corev1.Pod
+		want bool
+	}{
+		{name: "succeeded", pod: testPod("job", corev1.PodSucceeded, ""), want: true},
+		{name: "running and ready", pod: testPod("app", corev1.PodRunning, corev1.ConditionTrue), want: true},
+		{name: "running not ready", pod: testPod("app", corev1.PodRunning, corev1.ConditionFalse)},
+		{name: "running without conditions", pod: testPod("app", corev1.PodRunning, "")},
+		{name: "pending", pod: testPod("app", corev1.PodPending, corev1.ConditionFalse)},
+		{name: "failed", pod: testPod("job", corev1.PodFailed, "")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isPodHealthy(*tt.pod); got != tt.want {
+				t.Errorf("isPodHealthy() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckNodes(t *testing.T) {
+	cl := &appv1alpha1.Cluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "default"},
+	}
+	cl.Spec.Workers = []appv1alpha1.WorkerNode{{Name: "mp"}, {Name: "md"}, {Name: "new"}}
+	cl.Status.WorkerPools = make([]appv1alpha1.WorkerPoolStatus, len(cl.Spec.Workers))
+	// the first pool is a machine pool, the second a machine deployment and the last wasn't created yet
+	mp := &capiexp.MachinePool{
+		ObjectMeta: metav1.ObjectMeta{Name: cl.MachinePoolName(0), Namespace: cl.Namespace},
+		Status: capiexp.MachinePoolStatus{
+			NodeRefs: []corev1.ObjectReference{{Name: "mp-1"}, {Name: "mp-2"}},
+		},
+	}
+	md := &capi.MachineDeployment{
+		ObjectMeta: metav1.ObjectMeta{Name: cl.MachineDeploymentName(1), Namespace: cl.Namespace},
+	}
+	machine := &capi.Machine{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "md-1",
+			Namespace: cl.Namespace,
+			Labels:    map[string]string{capi.MachineDeploymentLabelName: md.Name},
+		},
+		Status: capi.MachineStatus{NodeRef: &corev1.ObjectReference{Name: "md-1"}},
+	}
+	r := &ClusterReconciler{
+		Client: fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(mp, md, machine).Build(),
+	}
+	cp := testNode("cp-1", corev1.ConditionTrue, map[string]string{meta.LabelK8sCP: ""})
+	tests := []struct {
+		name       string
+		notReady   corev1.ConditionStatus
+		wantStatus metav1.ConditionStatus
+		wantMsg    string
+		wantReady  []int32
+	}{
+		{
+			name:       "all ready",
+			notReady:   corev1.ConditionTrue,
+			wantStatus: metav1.ConditionTrue,
+			wantMsg:    "ready nodes: control plane 1/1, mp 2/2, md 1/1, new 0/0",
+			wantReady:  []int32{2, 1, 0},
+		},
+		{
+			name:       "machine pool node not ready",
+			notReady:   corev1.ConditionFalse,
+			wantStatus: metav1.ConditionFalse,
+			wantMsg:    "ready nodes: control plane 1/1, mp 1/2, md 1/1, new 0/0",
+			wantReady:  []int32{1, 1, 0},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nodes := []corev1.Node{
+				*cp,
+				*testNode("mp-1", corev1.ConditionTrue, nil),
+				*testNode("mp-2", tt.notReady, nil),
+				*testNode("md-1", corev1.ConditionTrue, nil),
+			}
+			err := r.checkNodes(context.Background(), cl, nodes)
+			if err != nil {
+				t.Fatalf("checkNodes() error = %v", err)
+			}
+			cond := apimeta.FindStatusCondition(cl.Status.Conditions, meta.NodesHealthyCondition)
+			if cond == nil || cond.Status != tt.wantStatus || cond.Message != tt.wantMsg {
+				t.Errorf("checkNodes() condition = %v, want %s %q", cond, tt.wantStatus, tt.wantMsg)
+			}
+			for i, want := range tt.wantReady {
+				if got := cl.Status.WorkerPools[i].ReadyNodes; got != want {
+					t.Errorf("pool %s ready nodes = %d, want %d", cl.WorkerPoolName(i), got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckAddons(t *testing.T) {
+	cl := &appv1alpha1.Cluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "default"},
+	}
+	cl.Spec.Addons = []appv1alpha1.Addon{{Name: "metrics-server"}}
+	cni := &appv1alpha1.HelmRelease{
+		ObjectMeta: metav1.ObjectMeta{Name: cniReleaseName(cl, appv1alpha1.CalicoCNI), Namespace: cl.Namespace},
+		Status: appv1alpha1.HelmReleaseStatus{
+			Conditions: []metav1.Condition{{Type: meta.ReadyCondition, Status: metav1.ConditionTrue}},
+		},
+	}
+	addon := &appv1alpha1.HelmRelease{
+		ObjectMeta: metav1.ObjectMeta{Name: cl.AddonReleaseName("metrics-server"), Namespace: cl.Namespace},
+		Status: appv1alpha1.HelmReleaseStatus{
+			Conditions: []metav1.Condition{{Type: meta.ReadyCondition, Status: metav1.ConditionTrue}},
+		},
+	}
+	tests := []struct {
+		name       string
+		objs       []client.Object
+		pods       []client.Object
+		wantStatus metav1.ConditionStatus
+		wantMsg    string
+	}{
+		{
+			name:       "ready",
+			objs:       []client.Object{cni, addon},
+			pods:       []client.Object{testPod("coredns", corev1.PodRunning, corev1.ConditionTrue), testPod("job", corev1.PodSucceeded, "")},
+			wantStatus: metav1.ConditionTrue,
+			wantMsg:    "addons are ready",
+		},
+		{
+			name:       "pod not ready",
+			objs:       []client.Object{cni, addon},
+			pods:       []client.Object{testPod("coredns", corev1.PodRunning, corev1.ConditionFalse)},
+			wantStatus: metav1.ConditionFalse,
+			wantMsg:    "not ready: pod kube-system/coredns",
+		},
+		{
+			name:       "release missing",
+			objs:       []client.Object{cni},
+			pods:       []client.Object{testPod("coredns", corev1.PodRunning, corev1.ConditionTrue)},
+			wantStatus: metav1.ConditionFalse,
+			wantMsg:    "not ready: helmrelease metrics-server-test",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &ClusterReconciler{
+				Client: fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(tt.objs...).Build(),
+			}
+			wc := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(tt.pods...).Build()
+			err := r.checkAddons(context.Background(), wc, cl)
+			if err != nil {
+				t.Fatalf("checkAddons() error = %v", err)
+			}
+			cond := apimeta.FindStatusCondition(cl.Status.Conditions, meta.AddonsHealthyCondition)
+			if cond == nil || cond.Status != tt.wantStatus || cond.Message != tt.wantMsg {
+				t.Errorf("checkAddons() condition = %v, want %s %q", cond, tt.wantStatus, tt.wantMsg)
+			}
+		})
+	}
+}
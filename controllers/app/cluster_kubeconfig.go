@@ -0,0 +1,69 @@
+/*
+Copyright 2020-2021 The UnDistro authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"context"
+	"time"
+
+	appv1alpha1 "github.com/getupio-undistro/undistro/apis/app/v1alpha1"
+	"github.com/getupio-undistro/undistro/pkg/meta"
+	"github.com/getupio-undistro/undistro/pkg/record"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/cluster-api/util/kubeconfig"
+	"sigs.k8s.io/cluster-api/util/secret"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// reconcileKubeconfig reissues the admin kubeconfig client certificate when the rotation interval has passed.
+// It returns when the next rotation is due, 0 when the rotation is disabled.
+func (r *ClusterReconciler) reconcileKubeconfig(ctx context.Context, cl *appv1alpha1.Cluster) (time.Duration, error) {
+	if cl.Spec.KubeconfigRotationInterval == nil || cl.Spec.KubeconfigRotationInterval.Duration <= 0 {
+		return 0, nil
+	}
+	if cl.Spec.InfrastructureProvider.IsManaged() {
+		return 0, nil
+	}
+	interval := cl.Spec.KubeconfigRotationInterval.Duration
+	s := corev1.Secret{}
+	key := client.ObjectKey{
+		Name:      secret.Name(cl.Name, secret.Kubeconfig),
+		Namespace: cl.GetNamespace(),
+	}
+	err := r.Get(ctx, key, &s)
+	if err != nil {
+		return 0, err
+	}
+	// clusters never rotated count from the kubeconfig creation
+	last := s.CreationTimestamp.Time
+	if cl.Status.LastKubeconfigRotationTime != nil {
+		last = cl.Status.LastKubeconfigRotationTime.Time
+	}
+	next := interval - time.Since(last)
+	if next > 0 {
+		return next, nil
+	}
+	err = kubeconfig.RegenerateSecret(ctx, r.Client, &s)
+	if err != nil {
+		return 0, err
+	}
+	now := metav1.Now()
+	cl.Status.LastKubeconfigRotationTime = &now
+	record.Event(cl, meta.KubeconfigRotatedReason, "admin kubeconfig rotated")
+	return interval, nil
+}
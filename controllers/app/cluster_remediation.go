@@ -0,0 +1,294 @@
+/*
+Copyright 2020-2021 The UnDistro authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"context"
+	"time"
+
+	appv1alpha1 "github.com/getupio-undistro/undistro/apis/app/v1alpha1"
+	"github.com/getupio-undistro/undistro/pkg/cloud"
+	"github.com/getupio-undistro/undistro/pkg/kube"
+	"github.com/getupio-undistro/undistro/pkg/meta"
+	"github.com/getupio-undistro/undistro/pkg/record"
+	"github.com/getupio-undistro/undistro/pkg/scheme"
+	"github.com/getupio-undistro/undistro/pkg/util"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	capi "sigs.k8s.io/cluster-api/api/v1alpha3"
+	capiexp "sigs.k8s.io/cluster-api/exp/api/v1alpha3"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// remediatedAnnotation marks the machines and nodes already counted as remediated
+	remediatedAnnotation = "undistro.io/remediated-at"
+
+	defaultUnhealthyTimeout   = 5 * time.Minute
+	defaultNodeStartupTimeout = 10 * time.Minute
+)
+
+var defaultMaxUnhealthy = intstr.FromString("100%")
+
+// healthCheckPolicy returns the policy filled with the defaults
+func healthCheckPolicy(h *appv1alpha1.HealthCheckPolicy) appv1alpha1.HealthCheckPolicy {
+	p := appv1alpha1.HealthCheckPolicy{}
+	if h != nil {
+		p = *h.DeepCopy()
+	}
+	if len(p.UnhealthyConditions) == 0 {
+		p.UnhealthyConditions = []capi.UnhealthyCondition{
+			{
+				Type:    corev1.NodeReady,
+				Status:  corev1.ConditionUnknown,
+				Timeout: metav1.Duration{Duration: defaultUnhealthyTimeout},
+			},
+			{
+				Type:    corev1.NodeReady,
+				Status:  corev1.ConditionFalse,
+				Timeout: metav1.Duration{Duration: defaultUnhealthyTimeout},
+			},
+		}
+	}
+	if p.MaxUnhealthy == nil {
+		maxUnhealthy := defaultMaxUnhealthy
+		p.MaxUnhealthy = &maxUnhealthy
+	}
+	if p.NodeStartupTimeout == nil {
+		p.NodeStartupTimeout = &metav1.Duration{Duration: defaultNodeStartupTimeout}
+	}
+	return p
+}
+
+// reconcileHealthChecks keeps a machine health check for the control plane and for each machine
+// deployment pool with a health check policy. Machine pools have no machines to be remediated,
+// so their unhealthy nodes are replaced through the infrastructure provider.
+func (r *ClusterReconciler) reconcileHealthChecks(ctx context.Context, cl *appv1alpha1.Cluster) error {
+	desired := make(map[string]bool)
+	if !cl.Spec.InfrastructureProvider.IsManaged() {
+		selector := map[string]string{capi.MachineControlPlaneLabelName: ""}
+		err := r.applyMachineHealthCheck(ctx, cl, cl.Name, selector, cl.Spec.ControlPlane.HealthCheck)
+		if err != nil {
+			return err
+		}
+		desired[cl.Name] = true
+		n, err := r.countRemediations(ctx, cl, client.MatchingLabels{capi.ClusterLabelName: cl.Name, capi.MachineControlPlaneLabelName: ""})
+		if err != nil {
+			return err
+		}
+		cl.Status.ControlPlaneRemediations += n
+	}
+	var wc client.Client
+	for i, w := range cl.Spec.Workers {
+		if w.HealthCheck == nil {
+			continue
+		}
+		var n int32
+		pool, err := r.workerPool(ctx, cl, i)
+		if err != nil {
+			return err
+		}
+		if pool == nil {
+			continue
+		}
+		if mp, ok := pool.(*capiexp.MachinePool); ok {
+			if wc == nil {
+				wc, err = kube.NewClusterClient(ctx, r.Client, cl.Name, cl.GetNamespace())
+				if err != nil {
+					return err
+				}
+			}
+			n, err = r.replaceUnhealthyNodes(ctx, wc, cl, *mp, healthCheckPolicy(w.HealthCheck))
+			if err != nil {
+				return err
+			}
+		} else {
+			name := cl.MachineDeploymentName(i)
+			selector := map[string]string{capi.MachineDeploymentLabelName: name}
+			err = r.applyMachineHealthCheck(ctx, cl, name, selector, w.HealthCheck)
+			if err != nil {
+				return err
+			}
+			desired[name] = true
+			n, err = r.countRemediations(ctx, cl, selector)
+			if err != nil {
+				return err
+			}
+		}
+		if i < len(cl.Status.WorkerPools) {
+			cl.Status.WorkerPools[i].Remediations += n
+		}
+	}
+	// health checks of removed pools or policies
+	mhcList := capi.MachineHealthCheckList{}
+	err := r.List(ctx, &mhcList, client.InNamespace(cl.GetNamespace()), client.MatchingLabels{meta.LabelUndistroClusterName: cl.Name})
+	if err != nil {
+		return err
+	}
+	for i := range mhcList.Items {
+		mhc := &mhcList.Items[i]
+		if desired[mhc.Name] {
+			continue
+		}
+		err = r.Delete(ctx, mhc)
+		if client.IgnoreNotFound(err) != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *ClusterReconciler) applyMachineHealthCheck(ctx context.Context, cl *appv1alpha1.Cluster, name string, selector map[string]string, h *appv1alpha1.HealthCheckPolicy) error {
+	p := healthCheckPolicy(h)
+	mhc := capi.MachineHealthCheck{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: capi.GroupVersion.String(),
+			Kind:       "MachineHealthCheck",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: cl.GetNamespace(),
+			Labels: map[string]string{
+				meta.LabelUndistro:            "",
+				meta.LabelUndistroClusterName: cl.Name,
+				capi.ClusterLabelName:         cl.Name,
+			},
+		},
+		Spec: capi.MachineHealthCheckSpec{
+			ClusterName: cl.Name,
+			Selector: metav1.LabelSelector{
+				MatchLabels: selector,
+			},
+			UnhealthyConditions: p.UnhealthyConditions,
+			MaxUnhealthy:        p.MaxUnhealthy,
+			NodeStartupTimeout:  p.NodeStartupTimeout,
+		},
+	}
+	err := ctrl.SetControllerReference(cl, &mhc, scheme.Scheme)
+	if err != nil {
+		return err
+	}
+	_, err = util.CreateOrUpdate(ctx, r.Client, &mhc)
+	return err
+}
+
+// countRemediations returns how many of the selected machines started being remediated
+// since the last count. They are annotated to be counted once.
+func (r *ClusterReconciler) countRemediations(ctx context.Context, cl *appv1alpha1.Cluster, selector client.MatchingLabels) (int32, error) {
+	machines := capi.MachineList{}
+	err := r.List(ctx, &machines, client.InNamespace(cl.GetNamespace()), selector)
+	if err != nil {
+		return 0, err
+	}
+	var n int32
+	for i := range machines.Items {
+		m := &machines.Items[i]
+		if _, ok := m.Annotations[remediatedAnnotation]; ok {
+			continue
+		}
+		if !conditions.IsFalse(m, capi.MachineOwnerRemediatedCondition) {
+			continue
+		}
+		base := m.DeepCopy()
+		if m.Annotations == nil {
+			m.Annotations = make(map[string]string)
+		}
+		m.Annotations[remediatedAnnotation] = time.Now().UTC().Format(time.RFC3339)
+		err = r.Patch(ctx, m, client.MergeFrom(base))
+		if client.IgnoreNotFound(err) != nil {
+			return 0, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+// replaceUnhealthyNodes replaces the machine pool nodes matching the unhealthy conditions
+// unless more than maxUnhealthy nodes are unhealthy. It returns how many were replaced.
+func (r *ClusterReconciler) replaceUnhealthyNodes(ctx context.Context, wc client.Client, cl *appv1alpha1.Cluster, mp capiexp.MachinePool, p appv1alpha1.HealthCheckPolicy) (int32, error) {
+	unhealthy := make([]corev1.Node, 0)
+	for _, ref := range mp.Status.NodeRefs {
+		n := corev1.Node{}
+		err := wc.Get(ctx, client.ObjectKey{Name: ref.Name}, &n)
+		if err != nil {
+			if client.IgnoreNotFound(err) != nil {
+				return 0, err
+			}
+			continue
+		}
+		if isNodeUnhealthy(n, p.UnhealthyConditions) {
+			unhealthy = append(unhealthy, n)
+		}
+	}
+	maxUnhealthy, err := intstr.GetScaledValueFromIntOrPercent(p.MaxUnhealthy, len(mp.Status.NodeRefs), false)
+	if err != nil {
+		return 0, err
+	}
+	if len(unhealthy) == 0 || len(unhealthy) > maxUnhealthy {
+		return 0, nil
+	}
+	providerIDs := make([]string, 0, len(unhealthy))
+	for _, n := range unhealthy {
+		// nodes being replaced are kept until their instances are terminated
+		if _, ok := n.Annotations[remediatedAnnotation]; !ok && n.Spec.ProviderID != "" {
+			providerIDs = append(providerIDs, n.Spec.ProviderID)
+		}
+	}
+	if len(providerIDs) == 0 {
+		return 0, nil
+	}
+	ok, err := cloud.ReplaceMachines(ctx, r.Client, cl, providerIDs)
+	if err != nil || !ok {
+		return 0, err
+	}
+	var replaced int32
+	for i := range unhealthy {
+		n := &unhealthy[i]
+		if _, ok := n.Annotations[remediatedAnnotation]; ok || n.Spec.ProviderID == "" {
+			continue
+		}
+		patch := client.MergeFrom(n.DeepCopy())
+		if n.Annotations == nil {
+			n.Annotations = make(map[string]string)
+		}
+		n.Annotations[remediatedAnnotation] = time.Now().UTC().Format(time.RFC3339)
+		err = wc.Patch(ctx, n, patch)
+		if client.IgnoreNotFound(err) != nil {
+			return 0, err
+		}
+		replaced++
+	}
+	if replaced > 0 {
+		record.Eventf(cl, meta.RemediatingNodesReason, "replacing %d unhealthy nodes of %s", replaced, mp.Name)
+	}
+	return replaced, nil
+}
+
+// isNodeUnhealthy returns if any of the conditions lasted its timeout
+func isNodeUnhealthy(n corev1.Node, unhealthyConditions []capi.UnhealthyCondition) bool {
+	for _, uc := range unhealthyConditions {
+		for _, c := range n.Status.Conditions {
+			if c.Type == uc.Type && c.Status == uc.Status && time.Since(c.LastTransitionTime.Time) > uc.Timeout.Duration {
+				return true
+			}
+		}
+	}
+	return false
+}
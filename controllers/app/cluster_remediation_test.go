@@ -0,0 +1,90 @@
+/*
+Copyright 2020-2021 The UnDistro authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package app
+
+import (
+	"context"
+	"testing"
+
+	appv1alpha1 "github.com/getupio-undistro/undistro/apis/app/v1alpha1"
+	"github.com/getupio-undistro/undistro/pkg/scheme"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	capi "sigs.k8s.io/cluster-api/api/v1alpha3"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// typedClient creates unstructured objects as typed ones, as the fake client can't list them otherwise
+type typedClient struct {
+	client.Client
+}
+
+func (c typedClient) Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) error {
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return c.Client.Create(ctx, obj, opts...)
+	}
+	typed, err := c.Scheme().New(u.GroupVersionKind())
+	if err != nil {
+		return err
+	}
+	err = runtime.DefaultUnstructuredConverter.FromUnstructured(u.Object, typed)
+	if err != nil {
+		return err
+	}
+	return c.Client.Create(ctx, typed.(client.Object), opts...)
+}
+
+func TestReconcileHealthChecks(t *testing.T) {
+	cl := &appv1alpha1.Cluster{
+		TypeMeta:   metav1.TypeMeta{APIVersion: appv1alpha1.GroupVersion.String(), Kind: "Cluster"},
+		ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "default"},
+	}
+	cl.Spec.InfrastructureProvider = appv1alpha1.InfrastructureProvider{Name: appv1alpha1.Amazon.String(), Flavor: appv1alpha1.EC2.String()}
+	cl.Spec.ControlPlane = &appv1alpha1.ControlPlaneNode{}
+	// the first pool is a machine deployment and the second wasn't created yet
+	cl.Spec.Workers = []appv1alpha1.WorkerNode{
+		{Name: "md", HealthCheck: &appv1alpha1.HealthCheckPolicy{}},
+		{Name: "new", HealthCheck: &appv1alpha1.HealthCheckPolicy{}},
+	}
+	cl.Status.WorkerPools = make([]appv1alpha1.WorkerPoolStatus, len(cl.Spec.Workers))
+	md := &capi.MachineDeployment{
+		ObjectMeta: metav1.ObjectMeta{Name: cl.MachineDeploymentName(0), Namespace: cl.Namespace},
+	}
+	r := &ClusterReconciler{
+		Client: typedClient{fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(md).Build()},
+		Scheme: scheme.Scheme,
+	}
+	err := r.reconcileHealthChecks(context.Background(), cl)
+	if err != nil {
+		t.Fatalf("reconcileHealthChecks() error = %v", err)
+	}
+	mhcList := capi.MachineHealthCheckList{}
+	err = r.List(context.Background(), &mhcList, client.InNamespace(cl.Namespace))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]bool)
+	for _, mhc := range mhcList.Items {
+		got[mhc.Name] = true
+	}
+	want := map[string]bool{cl.Name: true, cl.MachineDeploymentName(0): true}
+	if len(got) != len(want) || !got[cl.Name] || !got[cl.MachineDeploymentName(0)] {
+		t.Errorf("machine health checks = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,85 @@
+/*
+Copyright 2020-2021 The UnDistro authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"context"
+
+	appv1alpha1 "github.com/getupio-undistro/undistro/apis/app/v1alpha1"
+	"github.com/getupio-undistro/undistro/pkg/fs"
+	"github.com/getupio-undistro/undistro/pkg/template"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// clusterTemplate returns the ClusterTemplate referenced by the cluster, nil when the built-in template is used
+func (r *ClusterReconciler) clusterTemplate(ctx context.Context, cl *appv1alpha1.Cluster) (*appv1alpha1.ClusterTemplate, error) {
+	if cl.Spec.TemplateRef == nil {
+		return nil, nil
+	}
+	tpl := appv1alpha1.ClusterTemplate{}
+	err := r.Get(ctx, client.ObjectKey{Name: cl.Spec.TemplateRef.Name, Namespace: cl.GetNamespace()}, &tpl)
+	if err != nil {
+		return nil, err
+	}
+	return &tpl, nil
+}
+
+// hasTemplateDiff returns if the template changed since the cluster objects were last applied
+func hasTemplateDiff(cl *appv1alpha1.Cluster, tpl *appv1alpha1.ClusterTemplate) bool {
+	if tpl == nil {
+		return cl.Status.TemplateName != ""
+	}
+	return tpl.Name != cl.Status.TemplateName || tpl.Generation != cl.Status.TemplateGeneration
+}
+
+// renderTemplate returns the cluster objects rendered from the ClusterTemplate or from the built-in template
+func renderTemplate(cl *appv1alpha1.Cluster, tpl *appv1alpha1.ClusterTemplate, vars map[string]interface{}) ([]unstructured.Unstructured, error) {
+	if tpl == nil {
+		return template.GetObjs(fs.FS, "clustertemplates", cl.GetTemplate(), vars)
+	}
+	return template.GetObjsFromText(tpl.Name, tpl.Spec.Template, vars)
+}
+
+// setTemplateStatus records the template the cluster objects were applied from
+func setTemplateStatus(cl *appv1alpha1.Cluster, tpl *appv1alpha1.ClusterTemplate) {
+	if tpl == nil {
+		cl.Status.TemplateName = ""
+		cl.Status.TemplateGeneration = 0
+		return
+	}
+	cl.Status.TemplateName = tpl.Name
+	cl.Status.TemplateGeneration = tpl.Generation
+}
+
+// templateToClusters enqueues the clusters referencing the changed ClusterTemplate
+func (r *ClusterReconciler) templateToClusters(o client.Object) []ctrl.Request {
+	clList := appv1alpha1.ClusterList{}
+	err := r.List(context.Background(), &clList, client.InNamespace(o.GetNamespace()))
+	if err != nil {
+		r.Log.Error(err, "unable to list clusters", "template", client.ObjectKeyFromObject(o))
+		return nil
+	}
+	reqs := make([]ctrl.Request, 0)
+	for _, cl := range clList.Items {
+		if cl.Spec.TemplateRef != nil && cl.Spec.TemplateRef.Name == o.GetName() {
+			reqs = append(reqs, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(&cl)})
+		}
+	}
+	return reqs
+}
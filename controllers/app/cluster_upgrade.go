@@ -0,0 +1,330 @@
+/*
+Copyright 2020-2021 The UnDistro authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"context"
+	"fmt"
+
+	appv1alpha1 "github.com/getupio-undistro/undistro/apis/app/v1alpha1"
+	"github.com/getupio-undistro/undistro/pkg/kube"
+	"github.com/getupio-undistro/undistro/pkg/meta"
+	"github.com/getupio-undistro/undistro/pkg/util"
+	"github.com/getupio-undistro/undistro/pkg/version"
+	corev1 "k8s.io/api/core/v1"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/discovery"
+	"k8s.io/utils/pointer"
+	capi "sigs.k8s.io/cluster-api/api/v1alpha3"
+	capicp "sigs.k8s.io/cluster-api/controlplane/kubeadm/api/v1alpha3"
+	capiexp "sigs.k8s.io/cluster-api/exp/api/v1alpha3"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func isUpgrading(cl *appv1alpha1.Cluster) bool {
+	return apimeta.IsStatusConditionTrue(cl.Status.Conditions, meta.UpgradeInProgressCondition)
+}
+
+// startUpgrade sets the cluster in the control plane phase of the upgrade
+// when the Kubernetes version of an existing cluster was changed
+func startUpgrade(cl *appv1alpha1.Cluster) {
+	applied := cl.Status.TargetKubernetesVersion
+	if applied == "" || applied == cl.Spec.KubernetesVersion {
+		return
+	}
+	msg := fmt.Sprintf("upgrading control plane from %s to %s", applied, cl.Spec.KubernetesVersion)
+	meta.SetResourceCondition(cl, meta.UpgradeInProgressCondition, metav1.ConditionTrue, meta.UpgradingControlPlaneReason, msg)
+}
+
+// normalizeVersion strips the build metadata added by providers
+// like EKS (v1.20.4-eks-6b7464) from versions reported by kubelets
+func normalizeVersion(v string) (string, error) {
+	sv, err := version.ParseVersion(v)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("v%d.%d.%d", sv.Major(), sv.Minor(), sv.Patch()), nil
+}
+
+// oldestVersion returns the oldest kubelet version of the given nodes
+func oldestVersion(nodes []corev1.Node) string {
+	oldest := ""
+	for _, n := range nodes {
+		v, err := normalizeVersion(n.Status.NodeInfo.KubeletVersion)
+		if err != nil {
+			continue
+		}
+		if oldest == "" {
+			oldest = v
+			continue
+		}
+		sv, _ := version.ParseVersion(v)
+		so, _ := version.ParseVersion(oldest)
+		if sv.LessThan(so) {
+			oldest = v
+		}
+	}
+	return oldest
+}
+
+// versionReached returns if the observed version is the one in the spec.
+// Managed control planes choose the patch version, so just the minor is compared.
+func versionReached(cl *appv1alpha1.Cluster, observed string) bool {
+	if observed == "" {
+		return false
+	}
+	target, err := normalizeVersion(cl.Spec.KubernetesVersion)
+	if err != nil {
+		return false
+	}
+	if !cl.Spec.InfrastructureProvider.IsManaged() {
+		return observed == target
+	}
+	o, err := version.ParseVersion(observed)
+	if err != nil {
+		return false
+	}
+	t, _ := version.ParseVersion(target)
+	return o.Major() == t.Major() && o.Minor() == t.Minor()
+}
+
+// upgradingPool returns the index of the first worker pool not running the spec version
+func upgradingPool(cl *appv1alpha1.Cluster) int {
+	for i, p := range cl.Status.WorkerPools {
+		if !versionReached(cl, p.KubernetesVersion) || p.ReadyReplicas < p.Replicas {
+			return i
+		}
+	}
+	return len(cl.Status.WorkerPools)
+}
+
+// workerPoolIndex returns the index of the worker pool rendered as the object or -1 when it isn't a pool
+func workerPoolIndex(cl *appv1alpha1.Cluster, o unstructured.Unstructured) int {
+	gvk := o.GroupVersionKind()
+	isPool := gvk.GroupKind() == capiexp.GroupVersion.WithKind("MachinePool").GroupKind() ||
+		gvk.GroupKind() == capi.GroupVersion.WithKind("MachineDeployment").GroupKind()
+	if !isPool {
+		return -1
+	}
+	for i := range cl.Spec.Workers {
+		if o.GetName() == cl.MachinePoolName(i) || o.GetName() == cl.MachineDeploymentName(i) {
+			return i
+		}
+	}
+	return -1
+}
+
+// holdWorkerPool returns if the object is a worker pool waiting for its turn in the upgrade.
+// Their machine templates are applied anyway because they aren't used until the pool is applied.
+func holdWorkerPool(cl *appv1alpha1.Cluster, o unstructured.Unstructured) bool {
+	if !isUpgrading(cl) {
+		return false
+	}
+	i := workerPoolIndex(cl, o)
+	if i < 0 {
+		return false
+	}
+	cond := apimeta.FindStatusCondition(cl.Status.Conditions, meta.UpgradeInProgressCondition)
+	if cond.Reason == meta.UpgradingControlPlaneReason {
+		return true
+	}
+	return i > upgradingPool(cl)
+}
+
+// reconcileVersions observes the versions running in the cluster
+// and moves the upgrade to the next phase when the current one is done
+func (r *ClusterReconciler) reconcileVersions(ctx context.Context, cl *appv1alpha1.Cluster, capiCluster capi.Cluster) error {
+	wc, err := kube.NewClusterClient(ctx, r.Client, cl.Name, cl.GetNamespace())
+	if err != nil {
+		return err
+	}
+	cpUpdated, err := r.observeControlPlane(ctx, wc, cl, capiCluster)
+	if err != nil {
+		return err
+	}
+	err = r.observeWorkerPools(ctx, wc, cl)
+	if err != nil {
+		return err
+	}
+	if !isUpgrading(cl) {
+		return nil
+	}
+	cond := apimeta.FindStatusCondition(cl.Status.Conditions, meta.UpgradeInProgressCondition)
+	if cond.Reason == meta.UpgradingControlPlaneReason && !cpUpdated {
+		return nil
+	}
+	i := upgradingPool(cl)
+	if i == len(cl.Status.WorkerPools) {
+		msg := fmt.Sprintf("cluster upgraded to %s", cl.Spec.KubernetesVersion)
+		meta.SetResourceCondition(cl, meta.UpgradeInProgressCondition, metav1.ConditionFalse, meta.UpgradeCompletedReason, msg)
+		return nil
+	}
+	msg := fmt.Sprintf("upgrading worker pool %s to %s", cl.Status.WorkerPools[i].Name, cl.Spec.KubernetesVersion)
+	if cond.Message != msg {
+		meta.SetResourceCondition(cl, meta.UpgradeInProgressCondition, metav1.ConditionTrue, meta.UpgradingWorkerPoolReason, msg)
+	}
+	return nil
+}
+
+// observeControlPlane sets the control plane version in the status
+// and returns if all control plane machines are running the spec version
+func (r *ClusterReconciler) observeControlPlane(ctx context.Context, wc client.Client, cl *appv1alpha1.Cluster, capiCluster capi.Cluster) (bool, error) {
+	if cl.Spec.InfrastructureProvider.IsManaged() {
+		cfg, err := kube.NewClusterConfig(ctx, r.Client, cl.Name, cl.GetNamespace())
+		if err != nil {
+			return false, err
+		}
+		dc, err := discovery.NewDiscoveryClientForConfig(cfg)
+		if err != nil {
+			return false, err
+		}
+		info, err := dc.ServerVersion()
+		if err != nil {
+			return false, err
+		}
+		cl.Status.KubernetesVersion, err = normalizeVersion(info.GitVersion)
+		if err != nil {
+			return false, err
+		}
+		return versionReached(cl, cl.Status.KubernetesVersion), nil
+	}
+	cp, _, err := util.GetMachinesForCluster(ctx, r.Client, &capiCluster)
+	if err != nil {
+		return false, err
+	}
+	nodes, err := machineNodes(ctx, wc, cp.Items)
+	if err != nil {
+		return false, err
+	}
+	cl.Status.KubernetesVersion = oldestVersion(nodes)
+	kcp := capicp.KubeadmControlPlane{}
+	err = r.Get(ctx, client.ObjectKeyFromObject(cl), &kcp)
+	if err != nil {
+		return false, client.IgnoreNotFound(err)
+	}
+	rolledOut := kcp.Status.UpdatedReplicas == kcp.Status.Replicas && kcp.Status.UnavailableReplicas == 0
+	return rolledOut && versionReached(cl, cl.Status.KubernetesVersion), nil
+}
+
+// observeWorkerPools sets the status of each worker pool in the spec order
+func (r *ClusterReconciler) observeWorkerPools(ctx context.Context, wc client.Client, cl *appv1alpha1.Cluster) error {
+	pools := make([]appv1alpha1.WorkerPoolStatus, len(cl.Spec.Workers))
+	for i := range cl.Spec.Workers {
+		pool, err := r.workerPool(ctx, cl, i)
+		if err != nil {
+			return err
+		}
+		switch p := pool.(type) {
+		case *capiexp.MachinePool:
+			nodes := make([]corev1.Node, 0, len(p.Status.NodeRefs))
+			for _, ref := range p.Status.NodeRefs {
+				n := corev1.Node{}
+				err = wc.Get(ctx, client.ObjectKey{Name: ref.Name}, &n)
+				if client.IgnoreNotFound(err) != nil {
+					return err
+				}
+				if err == nil {
+					nodes = append(nodes, n)
+				}
+			}
+			pools[i] = appv1alpha1.WorkerPoolStatus{
+				Name:              p.Name,
+				KubernetesVersion: oldestVersion(nodes),
+				Replicas:          pointer.Int32Deref(p.Spec.Replicas, 0),
+				ReadyReplicas:     p.Status.ReadyReplicas,
+			}
+		case *capi.MachineDeployment:
+			machines := capi.MachineList{}
+			err = r.List(ctx, &machines, client.InNamespace(p.Namespace), client.MatchingLabels{capi.MachineDeploymentLabelName: p.Name})
+			if err != nil {
+				return err
+			}
+			nodes, err := machineNodes(ctx, wc, machines.Items)
+			if err != nil {
+				return err
+			}
+			pools[i] = appv1alpha1.WorkerPoolStatus{
+				Name:              p.Name,
+				KubernetesVersion: oldestVersion(nodes),
+				Replicas:          pointer.Int32Deref(p.Spec.Replicas, 0),
+				ReadyReplicas:     p.Status.ReadyReplicas,
+			}
+		default:
+			// the pool wasn't created yet
+			pools[i] = appv1alpha1.WorkerPoolStatus{
+				Replicas: pointer.Int32Deref(cl.Spec.Workers[i].Replicas, 0),
+			}
+		}
+	}
+	// the counters set by the health checks are kept
+	for i := range pools {
+		for _, prev := range cl.Status.WorkerPools {
+			if pools[i].Name != "" && prev.Name == pools[i].Name {
+				pools[i].ReadyNodes = prev.ReadyNodes
+				pools[i].Remediations = prev.Remediations
+			}
+		}
+	}
+	cl.Status.WorkerPools = pools
+	return nil
+}
+
+// workerPool returns the machine pool of the worker pool at the index or, as providers
+// without machine pools run workers as machine deployments, its machine deployment.
+// It returns nil when the pool wasn't created yet.
+func (r *ClusterReconciler) workerPool(ctx context.Context, cl *appv1alpha1.Cluster, i int) (client.Object, error) {
+	key := client.ObjectKey{
+		Name:      cl.MachinePoolName(i),
+		Namespace: cl.GetNamespace(),
+	}
+	mp := capiexp.MachinePool{}
+	err := r.Get(ctx, key, &mp)
+	if err == nil {
+		return &mp, nil
+	}
+	if client.IgnoreNotFound(err) != nil {
+		return nil, err
+	}
+	key.Name = cl.MachineDeploymentName(i)
+	md := capi.MachineDeployment{}
+	err = r.Get(ctx, key, &md)
+	if err != nil {
+		return nil, client.IgnoreNotFound(err)
+	}
+	return &md, nil
+}
+
+func machineNodes(ctx context.Context, wc client.Client, machines []capi.Machine) ([]corev1.Node, error) {
+	nodes := make([]corev1.Node, 0, len(machines))
+	for _, m := range machines {
+		if m.Status.NodeRef == nil {
+			continue
+		}
+		n := corev1.Node{}
+		err := wc.Get(ctx, client.ObjectKey{Name: m.Status.NodeRef.Name}, &n)
+		if err != nil {
+			if client.IgnoreNotFound(err) != nil {
+				return nil, err
+			}
+			continue
+		}
+		nodes = append(nodes, n)
+	}
+	return nodes, nil
+}
@@ -17,6 +17,7 @@ limitations under the License.
 package app
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
@@ -73,7 +74,15 @@ type HelmReleaseReconciler struct {
 	client.Client
 	Log    logr.Logger
 	Scheme *runtime.Scheme
-	config *rest.Config
+	// ChartCache holds the repository indexes and charts across reconciles, nil disables it
+	ChartCache *helm.Cache
+	// MaxConcurrentReconciles is the number of releases reconciled at the same time, default 1
+	MaxConcurrentReconciles int
+	// MaxConcurrentReconcilesPerCluster is the number of releases of the same cluster
+	// reconciled at the same time, default 1 so they're serialized
+	MaxConcurrentReconcilesPerCluster int
+	config                            *rest.Config
+	clusters                          *keyedSemaphore
 }
 
 func (r *HelmReleaseReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
@@ -82,6 +91,16 @@ func (r *HelmReleaseReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 		return ctrl.Result{}, client.IgnoreNotFound(err)
 	}
 	log := r.Log.WithValues("helmrelease", req.NamespacedName)
+	// releases of other clusters are reconciled while the ones of this cluster wait
+	clusterKey := hr.Spec.ClusterName
+	if clusterKey != "" {
+		clusterKey = util.ObjectKeyFromString(clusterKey).String()
+	}
+	if !r.clusters.tryAcquire(clusterKey) {
+		log.V(1).Info("waiting other releases of the cluster", "cluster", clusterKey)
+		return ctrl.Result{RequeueAfter: 5 * time.Second}, nil
+	}
+	defer r.clusters.release(clusterKey)
 	// Initialize the patch helper.
 	patchHelper, err := patch.NewHelper(&hr, r.Client)
 	if err != nil {
@@ -153,79 +172,44 @@ func (r *HelmReleaseReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 }
 
 func (r *HelmReleaseReconciler) reconcile(ctx context.Context, log logr.Logger, hr appv1alpha1.HelmRelease) (appv1alpha1.HelmRelease, ctrl.Result, error) {
-	var clientOpts []getter.Option
+	var secret *corev1.Secret
 	if hr.Spec.Chart.SecretRef != nil {
 		name := types.NamespacedName{
 			Name:      hr.Spec.Chart.SecretRef.Name,
 			Namespace: hr.GetNamespace(),
 		}
-		var secret corev1.Secret
-		err := r.Client.Get(ctx, name, &secret)
+		var s corev1.Secret
+		err := r.Client.Get(ctx, name, &s)
 		if err != nil {
 			err = fmt.Errorf("auth secret error: %w", err)
 			hr = appv1alpha1.HelmReleaseNotReady(hr, meta.AuthenticationFailedReason, err.Error())
 			return hr, ctrl.Result{}, err
 		}
-		opts, cleanup, err := helm.ClientOptionsFromSecret(secret)
-		if err != nil {
-			err = fmt.Errorf("auth options error: %w", err)
-			hr = appv1alpha1.HelmReleaseNotReady(hr, meta.AuthenticationFailedReason, err.Error())
-			return hr, ctrl.Result{}, err
-		}
-		defer cleanup()
-		clientOpts = opts
-	}
-	if hr.Spec.Timeout != nil {
-		clientOpts = append(clientOpts, getter.WithTimeout(hr.Spec.Timeout.Duration))
-	}
-	chartRepo, err := helm.NewChartRepository(hr.Spec.Chart.RepoURL, getters, clientOpts)
-	if err != nil {
-		switch err.(type) {
-		default:
-			hr = appv1alpha1.HelmReleaseNotReady(hr, meta.IndexationFailedReason, err.Error())
-		case *url.Error:
-			hr = appv1alpha1.HelmReleaseNotReady(hr, meta.URLInvalidReason, err.Error())
-		}
-		return hr, ctrl.Result{}, err
-	}
-	if err := chartRepo.DownloadIndex(); err != nil {
-		err = fmt.Errorf("failed to download repository index: %w", err)
-		hr = appv1alpha1.HelmReleaseNotReady(hr, meta.IndexationFailedReason, err.Error())
-		return hr, ctrl.Result{}, err
-	}
-	chartRepo.Index.SortEntries()
-	versions := chartRepo.Index.Entries[hr.Spec.Chart.Name]
-	if versions.Len() > 0 {
-		latestVersion := versions[0]
-		lv, err := version.ParseVersion(latestVersion.Version)
+		secret = &s
+	}
+	var (
+		res      *bytes.Buffer
+		hc       *chart.Chart
+		digest   string
+		revision string
+		updated  bool
+		err      error
+	)
+	switch {
+	case hr.Spec.Chart.Git != nil:
+		hc, revision, err = helm.CloneChartWithCache(ctx, r.ChartCache, *hr.Spec.Chart.Git, secret)
 		if err != nil {
+			hr = appv1alpha1.HelmReleaseNotReady(hr, meta.ChartPullFailedReason, err.Error())
 			return hr, ctrl.Result{}, err
 		}
-		if hr.Spec.Chart.Version == "" {
-			hr.Spec.Chart.Version = lv.String()
-			return hr, ctrl.Result{}, nil
-		}
-		if hr.Spec.AutoUpgrade {
-			acv, err := version.ParseVersion(hr.Spec.Chart.Version)
-			if err != nil {
-				return hr, ctrl.Result{}, err
-			}
-			if lv.GreaterThan(acv) && lv.Major() == acv.Major() {
-				hr.Spec.Chart.Version = lv.String()
-				return hr, ctrl.Result{}, nil
-			}
-		}
+	case helm.IsOCI(hr.Spec.Chart.RepoURL):
+		res, digest, updated, err = r.pullOCIChart(ctx, &hr, secret)
+	default:
+		res, updated, err = r.pullRepoChart(ctx, &hr, secret)
 	}
-	ch, err := chartRepo.Get(hr.Spec.Chart.Name, hr.Spec.Chart.Version)
-	if err != nil {
-		hr = appv1alpha1.HelmReleaseNotReady(hr, meta.ChartPullFailedReason, err.Error())
+	if err != nil || updated {
 		return hr, ctrl.Result{}, err
 	}
-	res, err := chartRepo.DownloadChart(ch)
-	if err != nil {
-		hr = appv1alpha1.HelmReleaseNotReady(hr, meta.ChartPullFailedReason, err.Error())
-		return hr, ctrl.Result{Requeue: true}, err
-	}
 	// Check dependencies
 	if len(hr.Spec.Dependencies) > 0 {
 		if err := r.checkDependencies(ctx, hr); err != nil {
@@ -302,12 +286,15 @@ func (r *HelmReleaseReconciler) reconcile(ctx context.Context, log logr.Logger,
 		hr = appv1alpha1.HelmReleaseNotReady(hr, meta.InitFailedReason, err.Error())
 		return hr, ctrl.Result{Requeue: true}, nil
 	}
-	hc, err := loader.LoadArchive(res)
-	if err != nil {
-		hr = appv1alpha1.HelmReleaseNotReady(hr, meta.StorageOperationFailedReason, err.Error())
-		return hr, ctrl.Result{}, err
+	if hc == nil {
+		hc, err = loader.LoadArchive(res)
+		if err != nil {
+			hr = appv1alpha1.HelmReleaseNotReady(hr, meta.StorageOperationFailedReason, err.Error())
+			return hr, ctrl.Result{}, err
+		}
+		revision = chartRevision(hc, digest)
 	}
-	hr, err = r.reconcileRelease(ctx, getter, workloadClient, log, hr, hc, values)
+	hr, err = r.reconcileRelease(ctx, getter, workloadClient, log, hr, hc, revision, values)
 	if err != nil {
 		if errors.Is(err, driver.ErrNoDeployedReleases) {
 			return hr, ctrl.Result{Requeue: true}, nil
@@ -321,10 +308,132 @@ func (r *HelmReleaseReconciler) reconcile(ctx context.Context, log logr.Logger,
 		return hr, ctrl.Result{}, err
 	}
 	meta.SetResourceCondition(&hr, meta.ObjectsAppliedCondition, metav1.ConditionTrue, meta.ObjectsAppliedSuccessReason, "objects successfully applied after install")
+	result := ctrl.Result{}
 	if hr.Spec.AutoUpgrade {
-		return hr, ctrl.Result{RequeueAfter: 15 * time.Minute}, nil
+		result.RequeueAfter = 15 * time.Minute
+	}
+	if d := hr.Spec.DriftDetection; d != nil && d.Interval != nil && (result.RequeueAfter == 0 || d.Interval.Duration < result.RequeueAfter) {
+		result.RequeueAfter = d.Interval.Duration
 	}
-	return hr, ctrl.Result{}, nil
+	return hr, result, nil
+}
+
+// pullRepoChart downloads the chart from the index of an HTTP chart repository and returns if its version was updated to the latest one
+func (r *HelmReleaseReconciler) pullRepoChart(ctx context.Context, hr *appv1alpha1.HelmRelease, secret *corev1.Secret) (*bytes.Buffer, bool, error) {
+	var clientOpts []getter.Option
+	if secret != nil {
+		opts, cleanup, err := helm.ClientOptionsFromSecret(*secret)
+		if err != nil {
+			err = fmt.Errorf("auth options error: %w", err)
+			*hr = appv1alpha1.HelmReleaseNotReady(*hr, meta.AuthenticationFailedReason, err.Error())
+			return nil, false, err
+		}
+		defer cleanup()
+		clientOpts = opts
+	}
+	if hr.Spec.Timeout != nil {
+		clientOpts = append(clientOpts, getter.WithTimeout(hr.Spec.Timeout.Duration))
+	}
+	chartRepo, err := helm.NewChartRepository(hr.Spec.Chart.RepoURL, getters, clientOpts)
+	if err != nil {
+		switch err.(type) {
+		default:
+			*hr = appv1alpha1.HelmReleaseNotReady(*hr, meta.IndexationFailedReason, err.Error())
+		case *url.Error:
+			*hr = appv1alpha1.HelmReleaseNotReady(*hr, meta.URLInvalidReason, err.Error())
+		}
+		return nil, false, err
+	}
+	if err := chartRepo.DownloadIndexWithCache(ctx, r.ChartCache, secret); err != nil {
+		err = fmt.Errorf("failed to download repository index: %w", err)
+		*hr = appv1alpha1.HelmReleaseNotReady(*hr, meta.IndexationFailedReason, err.Error())
+		return nil, false, err
+	}
+	chartRepo.Index.SortEntries()
+	versions := chartRepo.Index.Entries[hr.Spec.Chart.Name]
+	if versions.Len() > 0 {
+		latestVersion := versions[0]
+		lv, err := version.ParseVersion(latestVersion.Version)
+		if err != nil {
+			return nil, false, err
+		}
+		if hr.Spec.Chart.Version == "" {
+			hr.Spec.Chart.Version = lv.String()
+			return nil, true, nil
+		}
+		if hr.Spec.AutoUpgrade {
+			acv, err := version.ParseVersion(hr.Spec.Chart.Version)
+			if err != nil {
+				return nil, false, err
+			}
+			if lv.GreaterThan(acv) && lv.Major() == acv.Major() {
+				hr.Spec.Chart.Version = lv.String()
+				return nil, true, nil
+			}
+		}
+	}
+	ch, err := chartRepo.Get(hr.Spec.Chart.Name, hr.Spec.Chart.Version)
+	if err != nil {
+		*hr = appv1alpha1.HelmReleaseNotReady(*hr, meta.ChartPullFailedReason, err.Error())
+		return nil, false, err
+	}
+	res, err := chartRepo.DownloadChartWithCache(r.ChartCache, ch)
+	if err != nil {
+		*hr = appv1alpha1.HelmReleaseNotReady(*hr, meta.ChartPullFailedReason, err.Error())
+		return nil, false, err
+	}
+	return res, false, nil
+}
+
+// pullOCIChart pulls the chart from an OCI registry, where the versions are tags and there is no index.
+// It returns the chart, the digest of its manifest and if the chart version was updated to the latest one instead.
+func (r *HelmReleaseReconciler) pullOCIChart(ctx context.Context, hr *appv1alpha1.HelmRelease, secret *corev1.Secret) (*bytes.Buffer, string, bool, error) {
+	var timeout time.Duration
+	if hr.Spec.Timeout != nil {
+		timeout = hr.Spec.Timeout.Duration
+	}
+	ociRepo, err := helm.NewOCIRepository(hr.Spec.Chart.RepoURL, secret, timeout)
+	if err != nil {
+		*hr = appv1alpha1.HelmReleaseNotReady(*hr, meta.URLInvalidReason, err.Error())
+		return nil, "", false, err
+	}
+	ociRepo.Cache = r.ChartCache
+	// pinned charts are never upgraded
+	if hr.Spec.Chart.Version == "" || (hr.Spec.AutoUpgrade && hr.Spec.Chart.Digest == "") {
+		lv, err := ociRepo.LatestVersion(ctx, hr.Spec.Chart.Name)
+		if err != nil {
+			err = fmt.Errorf("failed to list chart versions: %w", err)
+			*hr = appv1alpha1.HelmReleaseNotReady(*hr, meta.ChartPullFailedReason, err.Error())
+			return nil, "", false, err
+		}
+		if hr.Spec.Chart.Version == "" {
+			hr.Spec.Chart.Version = lv.String()
+			return nil, "", true, nil
+		}
+		acv, err := version.ParseVersion(hr.Spec.Chart.Version)
+		if err != nil {
+			return nil, "", false, err
+		}
+		if lv.GreaterThan(acv) && lv.Major() == acv.Major() {
+			hr.Spec.Chart.Version = lv.String()
+			return nil, "", true, nil
+		}
+	}
+	res, digest, err := ociRepo.DownloadChart(ctx, hr.Spec.Chart.Name, hr.Spec.Chart.Version, hr.Spec.Chart.Digest)
+	if err != nil {
+		*hr = appv1alpha1.HelmReleaseNotReady(*hr, meta.ChartPullFailedReason, err.Error())
+		return nil, "", false, err
+	}
+	return res, digest, false, nil
+}
+
+// chartRevision returns the chart version, with the digest of charts pulled from OCI registries,
+// so a version pushed again is released
+func chartRevision(c *chart.Chart, digest string) string {
+	if digest == "" {
+		return c.Metadata.Version
+	}
+	return fmt.Sprintf("%s@%s", c.Metadata.Version, digest)
 }
 
 func (r *HelmReleaseReconciler) applyObjs(ctx context.Context, c client.Client, objs []apiextensionsv1.JSON) error {
@@ -344,7 +453,7 @@ func (r *HelmReleaseReconciler) applyObjs(ctx context.Context, c client.Client,
 }
 
 func (r *HelmReleaseReconciler) reconcileRelease(ctx context.Context, getter genericclioptions.RESTClientGetter, workloadClient client.Client, log logr.Logger,
-	hr appv1alpha1.HelmRelease, chart *chart.Chart, values chartutil.Values) (appv1alpha1.HelmRelease, error) {
+	hr appv1alpha1.HelmRelease, chart *chart.Chart, revision string, values chartutil.Values) (appv1alpha1.HelmRelease, error) {
 
 	runner, err := helm.NewRunner(getter, hr.Spec.TargetNamespace, log)
 	if err != nil {
@@ -354,7 +463,6 @@ func (r *HelmReleaseReconciler) reconcileRelease(ctx context.Context, getter gen
 	if err != nil {
 		return appv1alpha1.HelmReleaseNotReady(hr, meta.GetLastReleaseFailedReason, "failed to get last release revision"), err
 	}
-	revision := chart.Metadata.Version
 	releaseRevision := util.ReleaseRevision(rel)
 	valuesChecksum := util.ValuesChecksum(values)
 	hr, hasNewState := appv1alpha1.HelmReleaseAttempted(hr, revision, releaseRevision, valuesChecksum)
@@ -368,6 +476,9 @@ func (r *HelmReleaseReconciler) reconcileRelease(ctx context.Context, getter gen
 	}
 	// Check status of any previous release attempt.
 	if meta.InReadyCondition(hr.Status.Conditions) && !hasNewState && rel != nil && rel.Info.Deleted.IsZero() {
+		if hr.Spec.DriftDetection != nil && rel.Info.Status == release.StatusDeployed {
+			hr = r.reconcileDrift(ctx, workloadClient, log, hr, rel)
+		}
 		return appv1alpha1.HelmReleaseReady(hr), nil
 	}
 	if rel == nil {
@@ -580,6 +691,19 @@ func (r *HelmReleaseReconciler) getRESTClientGetter(ctx context.Context, hr appv
 }
 
 func (r *HelmReleaseReconciler) reconcileDelete(ctx context.Context, logger logr.Logger, hr appv1alpha1.HelmRelease) (ctrl.Result, error) {
+	orphaned, err := r.isOrphaned(ctx, hr)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if orphaned {
+		// the cluster is detached from UnDistro, so the release is kept running
+		controllerutil.RemoveFinalizer(&hr, meta.Finalizer)
+		_, err = util.CreateOrUpdate(ctx, r.Client, &hr)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{}, nil
+	}
 	restClient, err := r.getRESTClientGetter(ctx, hr)
 	if err != nil {
 		if client.IgnoreNotFound(err) != nil {
@@ -630,10 +754,27 @@ func (r *HelmReleaseReconciler) reconcileDelete(ctx context.Context, logger logr
 	return ctrl.Result{}, nil
 }
 
+// isOrphaned returns if the release cluster is being deleted with the orphan policy
+func (r *HelmReleaseReconciler) isOrphaned(ctx context.Context, hr appv1alpha1.HelmRelease) (bool, error) {
+	if hr.Spec.ClusterName == "" {
+		return false, nil
+	}
+	cl := appv1alpha1.Cluster{}
+	err := r.Get(ctx, util.ObjectKeyFromString(hr.Spec.ClusterName), &cl)
+	if err != nil {
+		return false, client.IgnoreNotFound(err)
+	}
+	return !cl.DeletionTimestamp.IsZero() && cl.Spec.DeletionPolicy == appv1alpha1.OrphanPolicy, nil
+}
+
 func (r *HelmReleaseReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	r.config = mgr.GetConfig()
+	r.clusters = newKeyedSemaphore(r.MaxConcurrentReconcilesPerCluster)
+	if r.MaxConcurrentReconciles < 1 {
+		r.MaxConcurrentReconciles = 1
+	}
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&appv1alpha1.HelmRelease{}).
-		WithOptions(controller.Options{MaxConcurrentReconciles: 1}).
+		WithOptions(controller.Options{MaxConcurrentReconciles: r.MaxConcurrentReconciles}).
 		Complete(r)
 }
@@ -0,0 +1,179 @@
+/*
+Copyright 2020-2021 The UnDistro authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	appv1alpha1 "github.com/getupio-undistro/undistro/apis/app/v1alpha1"
+	"github.com/getupio-undistro/undistro/pkg/helm"
+	"github.com/getupio-undistro/undistro/pkg/meta"
+	"github.com/getupio-undistro/undistro/pkg/record"
+	"github.com/go-logr/logr"
+	"helm.sh/helm/v3/pkg/release"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// reconcileDrift compares the objects of the release with the live objects in the workload cluster,
+// reporting the drifted ones in the status and applying them again in the correct mode.
+// Failures are reported in the Drifted condition and retried in the next interval.
+func (r *HelmReleaseReconciler) reconcileDrift(ctx context.Context, workloadClient client.Client, log logr.Logger, hr appv1alpha1.HelmRelease, rel *release.Release) appv1alpha1.HelmRelease {
+	drifted, desired, err := r.driftedObjects(ctx, workloadClient, rel)
+	if err != nil {
+		log.Error(err, "failed to detect drift")
+		apimeta.SetStatusCondition(&hr.Status.Conditions, metav1.Condition{
+			Type:    meta.DriftedCondition,
+			Status:  metav1.ConditionUnknown,
+			Reason:  meta.DriftDetectionFailedReason,
+			Message: err.Error(),
+		})
+		return hr
+	}
+	hr.Status.DriftedObjects = drifted
+	if len(drifted) == 0 {
+		apimeta.SetStatusCondition(&hr.Status.Conditions, metav1.Condition{
+			Type:    meta.DriftedCondition,
+			Status:  metav1.ConditionFalse,
+			Reason:  meta.NoDriftReason,
+			Message: "release objects match the release manifest",
+		})
+		return hr
+	}
+	msg := fmt.Sprintf("%d objects drifted from the release: %s", len(drifted), driftedNames(drifted))
+	if hr.Spec.DriftDetection.Mode != appv1alpha1.DriftDetectionCorrect {
+		apimeta.SetStatusCondition(&hr.Status.Conditions, metav1.Condition{
+			Type:    meta.DriftedCondition,
+			Status:  metav1.ConditionTrue,
+			Reason:  meta.DriftDetectedReason,
+			Message: msg,
+		})
+		record.Warn(&hr, meta.DriftDetectedReason, msg)
+		return hr
+	}
+	err = r.correctDrift(ctx, workloadClient, rel, drifted, desired)
+	if err != nil {
+		msg = fmt.Sprintf("%s, failed to correct: %s", msg, err.Error())
+		apimeta.SetStatusCondition(&hr.Status.Conditions, metav1.Condition{
+			Type:    meta.DriftedCondition,
+			Status:  metav1.ConditionTrue,
+			Reason:  meta.DriftDetectionFailedReason,
+			Message: msg,
+		})
+		record.Warn(&hr, meta.DriftDetectionFailedReason, msg)
+		return hr
+	}
+	msg = fmt.Sprintf("%d objects applied again: %s", len(drifted), driftedNames(drifted))
+	apimeta.SetStatusCondition(&hr.Status.Conditions, metav1.Condition{
+		Type:    meta.DriftedCondition,
+		Status:  metav1.ConditionFalse,
+		Reason:  meta.DriftCorrectedReason,
+		Message: msg,
+	})
+	record.Event(&hr, meta.DriftCorrectedReason, msg)
+	return hr
+}
+
+// driftedObjects returns the objects of the release missing or modified in the workload cluster,
+// and their desired state in the release manifest
+func (r *HelmReleaseReconciler) driftedObjects(ctx context.Context, workloadClient client.Client, rel *release.Release) ([]appv1alpha1.DriftedObject, []*unstructured.Unstructured, error) {
+	objs, err := helm.ReleaseObjects(rel, workloadClient.RESTMapper())
+	if err != nil {
+		return nil, nil, err
+	}
+	drifted := make([]appv1alpha1.DriftedObject, 0)
+	driftedDesired := make([]*unstructured.Unstructured, 0)
+	for i := range objs {
+		desired := &objs[i]
+		live := unstructured.Unstructured{}
+		live.SetGroupVersionKind(desired.GroupVersionKind())
+		d := appv1alpha1.DriftedObject{
+			APIVersion: desired.GetAPIVersion(),
+			Kind:       desired.GetKind(),
+			Namespace:  desired.GetNamespace(),
+			Name:       desired.GetName(),
+		}
+		err = workloadClient.Get(ctx, client.ObjectKeyFromObject(desired), &live)
+		switch {
+		case apierrors.IsNotFound(err):
+			d.Reason = appv1alpha1.DriftMissingReason
+		case err != nil:
+			return nil, nil, err
+		default:
+			d.Fields = helm.DriftedFields(desired, &live)
+			if len(d.Fields) == 0 {
+				continue
+			}
+			d.Reason = appv1alpha1.DriftModifiedReason
+		}
+		drifted = append(drifted, d)
+		driftedDesired = append(driftedDesired, desired)
+	}
+	return drifted, driftedDesired, nil
+}
+
+// correctDrift applies the drifted objects of the release again. Missing objects are created with
+// the Helm ownership metadata, so the next upgrades adopt them, and modified objects are patched
+// with the fields of the manifest.
+func (r *HelmReleaseReconciler) correctDrift(ctx context.Context, workloadClient client.Client, rel *release.Release, drifted []appv1alpha1.DriftedObject, desired []*unstructured.Unstructured) error {
+	for i, d := range drifted {
+		o := desired[i]
+		var err error
+		if d.Reason == appv1alpha1.DriftMissingReason {
+			labels := o.GetLabels()
+			if labels == nil {
+				labels = make(map[string]string)
+			}
+			labels["app.kubernetes.io/managed-by"] = "Helm"
+			o.SetLabels(labels)
+			annotations := o.GetAnnotations()
+			if annotations == nil {
+				annotations = make(map[string]string)
+			}
+			annotations["meta.helm.sh/release-name"] = rel.Name
+			annotations["meta.helm.sh/release-namespace"] = rel.Namespace
+			o.SetAnnotations(annotations)
+			err = workloadClient.Create(ctx, o)
+		} else {
+			var data []byte
+			data, err = json.Marshal(o.Object)
+			if err != nil {
+				return err
+			}
+			err = workloadClient.Patch(ctx, o, client.RawPatch(types.MergePatchType, data))
+		}
+		if err != nil {
+			return fmt.Errorf("failed to apply %s %s: %w", d.Kind, d.Name, err)
+		}
+	}
+	return nil
+}
+
+func driftedNames(drifted []appv1alpha1.DriftedObject) string {
+	names := make([]string, len(drifted))
+	for i, d := range drifted {
+		names[i] = fmt.Sprintf("%s/%s", strings.ToLower(d.Kind), d.Name)
+	}
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,58 @@
+/*
+Copyright 2020-2021 The UnDistro authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import "sync"
+
+// keyedSemaphore limits the concurrent holders of each key, e.g. the reconciles of the releases of a cluster.
+type keyedSemaphore struct {
+	mu      sync.Mutex
+	size    int
+	holders map[string]int
+}
+
+func newKeyedSemaphore(size int) *keyedSemaphore {
+	if size < 1 {
+		size = 1
+	}
+	return &keyedSemaphore{
+		size:    size,
+		holders: make(map[string]int),
+	}
+}
+
+// tryAcquire acquires the key without waiting, it returns false when the key has no room.
+func (s *keyedSemaphore) tryAcquire(key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.holders[key] >= s.size {
+		return false
+	}
+	s.holders[key]++
+	return true
+}
+
+// release releases the key acquired by tryAcquire.
+func (s *keyedSemaphore) release(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.holders[key] <= 1 {
+		delete(s.holders, key)
+		return
+	}
+	s.holders[key]--
+}
@@ -0,0 +1,45 @@
+/*
+Copyright 2020-2021 The UnDistro authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import "testing"
+
+func TestKeyedSemaphore(t *testing.T) {
+	s := newKeyedSemaphore(2)
+	if !s.tryAcquire("a") || !s.tryAcquire("a") {
+		t.Fatal("tryAcquire(a) failed with room")
+	}
+	if s.tryAcquire("a") {
+		t.Error("tryAcquire(a) succeeded over the size")
+	}
+	if !s.tryAcquire("b") {
+		t.Error("tryAcquire(b) failed while other key is full")
+	}
+	s.release("a")
+	if !s.tryAcquire("a") {
+		t.Error("tryAcquire(a) failed after release")
+	}
+	s.release("a")
+	s.release("a")
+	s.release("b")
+	if len(s.holders) != 0 {
+		t.Errorf("semaphore holds %v after releasing all keys", s.holders)
+	}
+	if newKeyedSemaphore(0).size != 1 {
+		t.Error("newKeyedSemaphore(0) doesn't serialize")
+	}
+}
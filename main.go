@@ -20,11 +20,14 @@ import (
 	"context"
 	"flag"
 	"os"
+	"time"
 
 	appv1alpha1 "github.com/getupio-undistro/undistro/apis/app/v1alpha1"
 	configv1alpha1 "github.com/getupio-undistro/undistro/apis/config/v1alpha1"
 	appcontroller "github.com/getupio-undistro/undistro/controllers/app"
 	configcontroller "github.com/getupio-undistro/undistro/controllers/config"
+	_ "github.com/getupio-undistro/undistro/pkg/cloud/providers"
+	"github.com/getupio-undistro/undistro/pkg/helm"
 	"github.com/getupio-undistro/undistro/pkg/record"
 	"github.com/getupio-undistro/undistro/pkg/scheme"
 	"github.com/getupio-undistro/undistro/pkg/undistro/apiserver"
@@ -45,9 +48,21 @@ func main() {
 	var undistroApiAddr string
 	var enableLeaderElection bool
 	var probeAddr string
+	var helmCacheSize int64
+	var helmIndexTTL time.Duration
+	var helmReleaseConcurrency int
+	var helmReleaseClusterConcurrency int
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
 	flag.StringVar(&metricsAddr, "metrics-addr", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&undistroApiAddr, "undistro-api-addr", ":2020", "The address and port of the UnDistro API server")
+	flag.Int64Var(&helmCacheSize, "helm-cache-size", 256<<20,
+		"Maximum size in bytes of the Helm repository indexes and charts cached across reconciles, 0 disables the cache.")
+	flag.DurationVar(&helmIndexTTL, "helm-index-ttl", 5*time.Minute,
+		"Time the cached Helm repository indexes are used before being revalidated with the repository.")
+	flag.IntVar(&helmReleaseConcurrency, "helm-release-concurrency", 4,
+		"Number of HelmReleases reconciled at the same time.")
+	flag.IntVar(&helmReleaseClusterConcurrency, "helm-release-cluster-concurrency", 1,
+		"Number of HelmReleases of the same cluster reconciled at the same time.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
@@ -92,9 +107,12 @@ func main() {
 		os.Exit(1)
 	}
 	if err = (&appcontroller.HelmReleaseReconciler{
-		Client: mgr.GetClient(),
-		Log:    ctrl.Log.WithName("controllers").WithName("HelmRelease"),
-		Scheme: mgr.GetScheme(),
+		Client:                            mgr.GetClient(),
+		Log:                               ctrl.Log.WithName("controllers").WithName("HelmRelease"),
+		Scheme:                            mgr.GetScheme(),
+		ChartCache:                        helm.NewCache(helmCacheSize, helmIndexTTL),
+		MaxConcurrentReconciles:           helmReleaseConcurrency,
+		MaxConcurrentReconcilesPerCluster: helmReleaseClusterConcurrency,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "HelmRelease")
 		os.Exit(1)
@@ -125,6 +143,16 @@ func main() {
 		os.Exit(1)
 	}
 
+	if err = (&appv1alpha1.ClusterTemplate{}).SetupWebhookWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create webhook", "webhook", "ClusterTemplate")
+		os.Exit(1)
+	}
+
+	if err = (&appv1alpha1.ClusterProfile{}).SetupWebhookWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create webhook", "webhook", "ClusterProfile")
+		os.Exit(1)
+	}
+
 	// +kubebuilder:scaffold:builder
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
 		setupLog.Error(err, "unable to set up health check")
@@ -0,0 +1,455 @@
+/*
+Copyright 2020-2021 The UnDistro authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package backup builds the objects taking etcd snapshots of self managed control planes
+// and restoring them. They run in the workload cluster, so the snapshots are taken on
+// the control plane machines and uploaded to an S3 compatible bucket.
+package backup
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+
+	appv1alpha1 "github.com/getupio-undistro/undistro/apis/app/v1alpha1"
+	"github.com/getupio-undistro/undistro/pkg/meta"
+	"github.com/pkg/errors"
+	batchv1 "k8s.io/api/batch/v1"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/pointer"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// Name of the CronJob and of the Secret with the bucket credentials in the workload cluster
+	Name      = "undistro-etcd-backup"
+	Namespace = metav1.NamespaceSystem
+
+	DefaultEtcdImage = "k8s.gcr.io/etcd:3.4.13-0"
+	AWSCLIImage      = "amazon/aws-cli:2.2.14"
+
+	AccessKeyIDKey     = "accessKeyID"
+	SecretAccessKeyKey = "secretAccessKey"
+
+	nameLabel       = "app.kubernetes.io/name"
+	restoreName     = "undistro-etcd-restore"
+	defaultDataDir  = "/var/lib/etcd"
+	etcdPKIDir      = "/etc/kubernetes/pki/etcd"
+	manifestsDir    = "/etc/kubernetes/manifests"
+	hostDir         = "/host"
+	snapshotDir     = "/snapshot"
+	snapshotFile    = snapshotDir + "/snapshot.db"
+	stoppedManifest = "/etc/kubernetes/etcd.yaml.undistro-restore"
+	// times the peer port is checked, every 5 seconds, before the restore gives up waiting etcd to stop
+	etcdStopChecks = 24
+)
+
+// SnapshotKey returns the key in the bucket of the snapshot taken by the job
+func SnapshotKey(cl *appv1alpha1.Cluster, job string) string {
+	return path.Join(cl.Spec.Backup.Destination.GetPrefix(cl), job+".db")
+}
+
+func snapshotURL(cl *appv1alpha1.Cluster, key string) string {
+	return fmt.Sprintf("s3://%s/%s", cl.Spec.Backup.Destination.Bucket, key)
+}
+
+// Selector matches the jobs created by the backup CronJob
+func Selector() client.MatchingLabels {
+	return client.MatchingLabels{nameLabel: Name}
+}
+
+// Secret returns the bucket credentials copied to the workload cluster
+func Secret(creds *corev1.Secret) (*corev1.Secret, error) {
+	s := corev1.Secret{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: corev1.SchemeGroupVersion.String(),
+			Kind:       "Secret",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      Name,
+			Namespace: Namespace,
+			Labels: map[string]string{
+				meta.LabelUndistro: "",
+				nameLabel:          Name,
+			},
+		},
+		Data: make(map[string][]byte),
+	}
+	for _, k := range []string{AccessKeyIDKey, SecretAccessKeyKey} {
+		v, ok := creds.Data[k]
+		if !ok {
+			return nil, errors.Errorf("secret %s has no %s key", creds.Name, k)
+		}
+		s.Data[k] = v
+	}
+	return &s, nil
+}
+
+// awsEnv returns the environment of the aws-cli containers.
+// Without a secret the credentials of the control plane machines are used.
+func awsEnv(cl *appv1alpha1.Cluster) []corev1.EnvVar {
+	dest := cl.Spec.Backup.Destination
+	env := make([]corev1.EnvVar, 0)
+	if dest.Region != "" {
+		env = append(env, corev1.EnvVar{Name: "AWS_DEFAULT_REGION", Value: dest.Region})
+	}
+	if dest.SecretRef != nil {
+		secretEnv := func(name, key string) corev1.EnvVar {
+			return corev1.EnvVar{
+				Name: name,
+				ValueFrom: &corev1.EnvVarSource{
+					SecretKeyRef: &corev1.SecretKeySelector{
+						LocalObjectReference: corev1.LocalObjectReference{Name: Name},
+						Key:                  key,
+					},
+				},
+			}
+		}
+		env = append(env, secretEnv("AWS_ACCESS_KEY_ID", AccessKeyIDKey), secretEnv("AWS_SECRET_ACCESS_KEY", SecretAccessKeyKey))
+	}
+	return env
+}
+
+func awsArgs(cl *appv1alpha1.Cluster, args ...string) []string {
+	if cl.Spec.Backup.Destination.Endpoint != "" {
+		args = append(args, "--endpoint-url", cl.Spec.Backup.Destination.Endpoint)
+	}
+	return args
+}
+
+// CronJob returns the CronJob taking the etcd snapshots in a control plane node.
+// Each snapshot is named after its job, so the controller finds it from the job status.
+func CronJob(cl *appv1alpha1.Cluster, etcdImage string) *batchv1beta1.CronJob {
+	labels := map[string]string{
+		meta.LabelUndistro: "",
+		nameLabel:          Name,
+	}
+	env := append(awsEnv(cl), corev1.EnvVar{
+		Name: "JOB_NAME",
+		ValueFrom: &corev1.EnvVarSource{
+			FieldRef: &corev1.ObjectFieldSelector{FieldPath: "metadata.labels['job-name']"},
+		},
+	})
+	key := path.Join(cl.Spec.Backup.Destination.GetPrefix(cl), "$(JOB_NAME).db")
+	return &batchv1beta1.CronJob{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: batchv1beta1.SchemeGroupVersion.String(),
+			Kind:       "CronJob",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      Name,
+			Namespace: Namespace,
+			Labels:    labels,
+		},
+		Spec: batchv1beta1.CronJobSpec{
+			Schedule:                   cl.Spec.Backup.Schedule,
+			ConcurrencyPolicy:          batchv1beta1.ForbidConcurrent,
+			SuccessfulJobsHistoryLimit: pointer.Int32Ptr(3),
+			FailedJobsHistoryLimit:     pointer.Int32Ptr(3),
+			JobTemplate: batchv1beta1.JobTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: labels,
+				},
+				Spec: batchv1.JobSpec{
+					BackoffLimit: pointer.Int32Ptr(3),
+					Template: corev1.PodTemplateSpec{
+						ObjectMeta: metav1.ObjectMeta{
+							Labels: labels,
+						},
+						Spec: corev1.PodSpec{
+							RestartPolicy: corev1.RestartPolicyOnFailure,
+							// etcd listens for clients only in the node addresses
+							HostNetwork: true,
+							DNSPolicy:   corev1.DNSClusterFirstWithHostNet,
+							Affinity:    controlPlaneAffinity(),
+							Tolerations: []corev1.Toleration{{Operator: corev1.TolerationOpExists}},
+							InitContainers: []corev1.Container{
+								{
+									Name:    "snapshot",
+									Image:   etcdImage,
+									Command: []string{"etcdctl"},
+									Args: []string{
+										"--endpoints=https://127.0.0.1:2379",
+										"--cacert=" + path.Join(etcdPKIDir, "ca.crt"),
+										"--cert=" + path.Join(etcdPKIDir, "healthcheck-client.crt"),
+										"--key=" + path.Join(etcdPKIDir, "healthcheck-client.key"),
+										"snapshot", "save", snapshotFile,
+									},
+									Env: []corev1.EnvVar{{Name: "ETCDCTL_API", Value: "3"}},
+									VolumeMounts: []corev1.VolumeMount{
+										{Name: "etcd-certs", MountPath: etcdPKIDir, ReadOnly: true},
+										{Name: "snapshot", MountPath: snapshotDir},
+									},
+								},
+							},
+							Containers: []corev1.Container{
+								{
+									Name:    "upload",
+									Image:   AWSCLIImage,
+									Command: []string{"aws"},
+									Args:    awsArgs(cl, "s3", "cp", snapshotFile, snapshotURL(cl, key)),
+									Env:     env,
+									VolumeMounts: []corev1.VolumeMount{
+										{Name: "snapshot", MountPath: snapshotDir, ReadOnly: true},
+									},
+								},
+							},
+							Volumes: []corev1.Volume{
+								hostPathVolume("etcd-certs", etcdPKIDir),
+								{
+									Name:         "snapshot",
+									VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func controlPlaneAffinity() *corev1.Affinity {
+	term := func(label string) corev1.NodeSelectorTerm {
+		return corev1.NodeSelectorTerm{
+			MatchExpressions: []corev1.NodeSelectorRequirement{
+				{Key: label, Operator: corev1.NodeSelectorOpExists},
+			},
+		}
+	}
+	return &corev1.Affinity{
+		NodeAffinity: &corev1.NodeAffinity{
+			RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{
+				NodeSelectorTerms: []corev1.NodeSelectorTerm{term(meta.LabelK8sMaster), term(meta.LabelK8sCP)},
+			},
+		},
+	}
+}
+
+func hostPathVolume(name, p string) corev1.Volume {
+	hostPathType := corev1.HostPathDirectory
+	return corev1.Volume{
+		Name: name,
+		VolumeSource: corev1.VolumeSource{
+			HostPath: &corev1.HostPathVolumeSource{Path: p, Type: &hostPathType},
+		},
+	}
+}
+
+// LastSnapshot returns the snapshot of the last succeeded job or nil when none succeeded
+func LastSnapshot(cl *appv1alpha1.Cluster, jobs []batchv1.Job) *appv1alpha1.BackupStatus {
+	var last *batchv1.Job
+	for i := range jobs {
+		j := &jobs[i]
+		if j.Status.Succeeded == 0 || j.Status.CompletionTime == nil {
+			continue
+		}
+		if last == nil || last.Status.CompletionTime.Before(j.Status.CompletionTime) {
+			last = j
+		}
+	}
+	if last == nil {
+		return nil
+	}
+	return &appv1alpha1.BackupStatus{
+		Snapshot: SnapshotKey(cl, last.Name),
+		Time:     *last.Status.CompletionTime,
+	}
+}
+
+// Member is an etcd member running as a static pod in a control plane node
+type Member struct {
+	Node    string
+	Name    string
+	PeerURL string
+	DataDir string
+	Image   string
+}
+
+// Members returns the etcd members of the workload cluster from their static pods
+func Members(ctx context.Context, wc client.Client) ([]Member, error) {
+	pods := corev1.PodList{}
+	err := wc.List(ctx, &pods, client.InNamespace(Namespace), client.MatchingLabels{"component": "etcd", "tier": "control-plane"})
+	if err != nil {
+		return nil, err
+	}
+	members := make([]Member, 0, len(pods.Items))
+	for _, p := range pods.Items {
+		if len(p.Spec.Containers) == 0 {
+			continue
+		}
+		c := p.Spec.Containers[0]
+		m := Member{
+			Node:    p.Spec.NodeName,
+			Image:   c.Image,
+			DataDir: defaultDataDir,
+		}
+		for _, arg := range append(c.Command, c.Args...) {
+			switch {
+			case strings.HasPrefix(arg, "--name="):
+				m.Name = strings.TrimPrefix(arg, "--name=")
+			case strings.HasPrefix(arg, "--initial-advertise-peer-urls="):
+				m.PeerURL = strings.TrimPrefix(arg, "--initial-advertise-peer-urls=")
+			case strings.HasPrefix(arg, "--data-dir="):
+				m.DataDir = strings.TrimPrefix(arg, "--data-dir=")
+			}
+		}
+		if m.Name == "" || m.PeerURL == "" {
+			return nil, errors.Errorf("unable to get the etcd member of pod %s", p.Name)
+		}
+		members = append(members, m)
+	}
+	return members, nil
+}
+
+// EtcdImage returns the image of the etcd running in the control plane,
+// so the snapshots are taken by a matching etcdctl
+func EtcdImage(ctx context.Context, wc client.Client) (string, error) {
+	members, err := Members(ctx, wc)
+	if err != nil {
+		return "", err
+	}
+	if len(members) == 0 {
+		return DefaultEtcdImage, nil
+	}
+	return members[0].Image, nil
+}
+
+// InitialCluster returns the etcd --initial-cluster flag value of the members
+func InitialCluster(members []Member) string {
+	peers := make([]string, 0, len(members))
+	for _, m := range members {
+		peers = append(peers, fmt.Sprintf("%s=%s", m.Name, m.PeerURL))
+	}
+	return strings.Join(peers, ",")
+}
+
+// RestorePodName returns the name of the pod restoring the member of the node
+func RestorePodName(node string) string {
+	return fmt.Sprintf("%s-%s", restoreName, node)
+}
+
+// RestorePod returns the pod replacing the data of the member with the snapshot.
+// It restores the snapshot in a new data dir while etcd runs, then stops etcd moving
+// its static pod manifest away, swaps the data dirs and moves the manifest back.
+// The manifest and the previous data dir are put back when any step fails.
+// The pod keeps running while the API server is down, so only the first
+// container reads the bucket credentials.
+func RestorePod(cl *appv1alpha1.Cluster, m Member, initialCluster, key string) *corev1.Pod {
+	dataDir := path.Clean(m.DataDir)
+	hostDataDir := path.Join(hostDir, path.Dir(dataDir))
+	hostKubernetesDir := path.Join(hostDir, "/etc/kubernetes")
+	manifest := path.Join(hostDir, manifestsDir, "etcd.yaml")
+	stopped := path.Join(hostDir, stoppedManifest)
+	currentDataDir := path.Join(hostDataDir, path.Base(dataDir))
+	restoredDataDir := currentDataDir + ".restored"
+	swap := strings.Join([]string{
+		"set -e",
+		fmt.Sprintf("previous=%s.before-restore-$(date +%%s)", currentDataDir),
+		"cleanup() {",
+		fmt.Sprintf("  if [ ! -d %s ] && [ -d $previous ]; then mv $previous %s; fi", currentDataDir, currentDataDir),
+		fmt.Sprintf("  if [ -f %s ]; then mv %s %s; fi", stopped, stopped, manifest),
+		fmt.Sprintf("  rm -rf %s", restoredDataDir),
+		"}",
+		"trap cleanup EXIT",
+		fmt.Sprintf("mv %s %s", manifest, stopped),
+		// waits the kubelet to stop etcd, its peer port refuses connections after it
+		"i=0",
+		fmt.Sprintf("until curl -sk --max-time 5 -o /dev/null %s; [ $? -eq 7 ]; do", m.PeerURL),
+		"  i=$((i+1))",
+		fmt.Sprintf("  if [ $i -ge %d ]; then echo \"etcd didn't stop\"; exit 1; fi", etcdStopChecks),
+		"  sleep 5",
+		"done",
+		fmt.Sprintf("mv %s $previous", currentDataDir),
+		fmt.Sprintf("mv %s %s", restoredDataDir, currentDataDir),
+	}, "\n")
+	mounts := []corev1.VolumeMount{
+		{Name: "kubernetes", MountPath: hostKubernetesDir},
+		{Name: "data", MountPath: hostDataDir},
+		{Name: "snapshot", MountPath: snapshotDir},
+	}
+	return &corev1.Pod{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: corev1.SchemeGroupVersion.String(),
+			Kind:       "Pod",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      RestorePodName(m.Node),
+			Namespace: Namespace,
+			Labels: map[string]string{
+				meta.LabelUndistro: "",
+				nameLabel:          restoreName,
+			},
+		},
+		Spec: corev1.PodSpec{
+			NodeName:      m.Node,
+			RestartPolicy: corev1.RestartPolicyNever,
+			HostNetwork:   true,
+			DNSPolicy:     corev1.DNSClusterFirstWithHostNet,
+			Tolerations:   []corev1.Toleration{{Operator: corev1.TolerationOpExists}},
+			InitContainers: []corev1.Container{
+				{
+					Name:         "download",
+					Image:        AWSCLIImage,
+					Command:      []string{"aws"},
+					Args:         awsArgs(cl, "s3", "cp", snapshotURL(cl, key), snapshotFile),
+					Env:          awsEnv(cl),
+					VolumeMounts: mounts,
+				},
+				{
+					// a restore failed before leaves its data dir
+					Name:         "clean",
+					Image:        AWSCLIImage,
+					Command:      []string{"rm", "-rf", restoredDataDir},
+					VolumeMounts: mounts,
+				},
+				{
+					Name:    "restore",
+					Image:   m.Image,
+					Command: []string{"etcdctl"},
+					Args: []string{
+						"snapshot", "restore", snapshotFile,
+						"--name=" + m.Name,
+						"--initial-cluster=" + initialCluster,
+						"--initial-advertise-peer-urls=" + m.PeerURL,
+						"--data-dir=" + restoredDataDir,
+					},
+					Env:          []corev1.EnvVar{{Name: "ETCDCTL_API", Value: "3"}},
+					VolumeMounts: mounts,
+				},
+			},
+			Containers: []corev1.Container{
+				{
+					Name:         "swap-data",
+					Image:        AWSCLIImage,
+					Command:      []string{"sh", "-c", swap},
+					VolumeMounts: mounts,
+				},
+			},
+			Volumes: []corev1.Volume{
+				hostPathVolume("kubernetes", "/etc/kubernetes"),
+				hostPathVolume("data", path.Dir(dataDir)),
+				{
+					Name:         "snapshot",
+					VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}},
+				},
+			},
+		},
+	}
+}
@@ -0,0 +1,164 @@
+/*
+Copyright 2020-2021 The UnDistro authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package backup
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	appv1alpha1 "github.com/getupio-undistro/undistro/apis/app/v1alpha1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newCluster() *appv1alpha1.Cluster {
+	cl := &appv1alpha1.Cluster{}
+	cl.Name = "cool-cluster"
+	cl.Namespace = "cool-namespace"
+	cl.Spec.Backup = &appv1alpha1.Backup{
+		Schedule: "@daily",
+		Destination: appv1alpha1.BackupDestination{
+			Bucket:    "backups",
+			Endpoint:  "http://minio.minio.svc:9000",
+			SecretRef: &corev1.LocalObjectReference{Name: "minio"},
+		},
+	}
+	return cl
+}
+
+func TestCronJob(t *testing.T) {
+	cl := newCluster()
+	cj := CronJob(cl, DefaultEtcdImage)
+	if cj.Spec.Schedule != "@daily" {
+		t.Errorf("schedule = %q, want @daily", cj.Spec.Schedule)
+	}
+	upload := cj.Spec.JobTemplate.Spec.Template.Spec.Containers[0]
+	wantArgs := []string{"s3", "cp", "/snapshot/snapshot.db", "s3://backups/cool-namespace/cool-cluster/$(JOB_NAME).db", "--endpoint-url", "http://minio.minio.svc:9000"}
+	if !reflect.DeepEqual(upload.Args, wantArgs) {
+		t.Errorf("upload args = %v, want %v", upload.Args, wantArgs)
+	}
+	env := make(map[string]bool)
+	for _, e := range upload.Env {
+		env[e.Name] = true
+	}
+	for _, name := range []string{"AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY", "JOB_NAME"} {
+		if !env[name] {
+			t.Errorf("upload env %s not set", name)
+		}
+	}
+}
+
+func TestLastSnapshot(t *testing.T) {
+	cl := newCluster()
+	cl.Spec.Backup.Destination.Prefix = "/etcd/"
+	now := time.Now()
+	job := func(name string, succeeded int32, completed time.Time) batchv1.Job {
+		j := batchv1.Job{}
+		j.Name = name
+		j.Status.Succeeded = succeeded
+		if !completed.IsZero() {
+			j.Status.CompletionTime = &metav1.Time{Time: completed}
+		}
+		return j
+	}
+	tests := []struct {
+		name string
+		jobs []batchv1.Job
+		want *appv1alpha1.BackupStatus
+	}{
+		{
+			name: "no jobs",
+		},
+		{
+			name: "running",
+			jobs: []batchv1.Job{job("backup-1", 0, time.Time{})},
+		},
+		{
+			name: "last succeeded",
+			jobs: []batchv1.Job{
+				job("backup-1", 1, now.Add(-2*time.Hour)),
+				job("backup-2", 1, now.Add(-time.Hour)),
+				job("backup-3", 0, time.Time{}),
+			},
+			want: &appv1alpha1.BackupStatus{
+				Snapshot: "etcd/backup-2.db",
+				Time:     metav1.Time{Time: now.Add(-time.Hour)},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := LastSnapshot(cl, tt.jobs); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("LastSnapshot() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInitialCluster(t *testing.T) {
+	members := []Member{
+		{Name: "cp-0", PeerURL: "https://10.0.0.1:2380"},
+		{Name: "cp-1", PeerURL: "https://10.0.0.2:2380"},
+	}
+	want := "cp-0=https://10.0.0.1:2380,cp-1=https://10.0.0.2:2380"
+	if got := InitialCluster(members); got != want {
+		t.Errorf("InitialCluster() = %q, want %q", got, want)
+	}
+}
+
+func TestRestorePod(t *testing.T) {
+	cl := newCluster()
+	m := Member{
+		Node:    "cp-0",
+		Name:    "cp-0",
+		PeerURL: "https://10.0.0.1:2380",
+		DataDir: "/var/lib/etcd",
+		Image:   DefaultEtcdImage,
+	}
+	p := RestorePod(cl, m, InitialCluster([]Member{m}), "cool-namespace/cool-cluster/backup-1.db")
+	if p.Spec.NodeName != "cp-0" {
+		t.Errorf("node = %q, want cp-0", p.Spec.NodeName)
+	}
+	// only the download reads the credentials, the others run while the API server is down
+	for _, c := range append(p.Spec.InitContainers[1:], p.Spec.Containers...) {
+		for _, e := range c.Env {
+			if e.ValueFrom != nil {
+				t.Errorf("container %s reads %s from the API server", c.Name, e.Name)
+			}
+		}
+	}
+	restore := p.Spec.InitContainers[2]
+	wantArgs := []string{
+		"snapshot", "restore", "/snapshot/snapshot.db",
+		"--name=cp-0",
+		"--initial-cluster=cp-0=https://10.0.0.1:2380",
+		"--initial-advertise-peer-urls=https://10.0.0.1:2380",
+		"--data-dir=/host/var/lib/etcd.restored",
+	}
+	if !reflect.DeepEqual(restore.Args, wantArgs) {
+		t.Errorf("restore args = %v, want %v", restore.Args, wantArgs)
+	}
+	// etcd is stopped just after the snapshot is restored and started again on every exit
+	swap := p.Spec.Containers[0].Command[2]
+	for _, want := range []string{"trap cleanup EXIT", "mv /host/etc/kubernetes/etcd.yaml.undistro-restore /host/etc/kubernetes/manifests/etcd.yaml", "https://10.0.0.1:2380"} {
+		if !strings.Contains(swap, want) {
+			t.Errorf("swap script doesn't contain %q:\n%s", want, swap)
+		}
+	}
+}
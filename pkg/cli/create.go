@@ -72,6 +72,8 @@ func (o *ClusterOptions) Complete(f cmdutil.Factory, cmd *cobra.Command, args []
 			o.K8sVersion = "v1.20.6"
 		case "eks":
 			o.K8sVersion = "v1.19.8"
+		case "kubeadm":
+			o.K8sVersion = "v1.20.7"
 		}
 	}
 	if len(args) != 1 {
@@ -105,6 +107,13 @@ func (o *ClusterOptions) validateInfraFlavor() error {
 		default:
 			return errors.Errorf("unknown flavor: %s", o.Flavor)
 		}
+	case appv1alpha1.Docker.String():
+		switch o.Flavor {
+		case appv1alpha1.Kubeadm.String():
+			return nil
+		default:
+			return errors.Errorf("unknown flavor: %s", o.Flavor)
+		}
 	default:
 		return errors.Errorf("unknown infrastructure: %s", o.Infra)
 	}
@@ -143,7 +152,8 @@ func (o *ClusterOptions) RunCreateCluster(f cmdutil.Factory, cmd *cobra.Command)
 	if err != nil {
 		return errors.Errorf("unable to create client: %v", err)
 	}
-	if o.Region == "" {
+	// docker clusters run in the host of the management cluster, so there is no region
+	if o.Region == "" && o.Infra != appv1alpha1.Docker.String() {
 		err = o.setRegionByInfra(cmd.Context(), c)
 		if err != nil {
 			return err
@@ -222,6 +232,7 @@ func NewCmdCluster(f cmdutil.Factory, flags *pflag.FlagSet, streams genericcliop
 		Long:                  LongDesc(`Create a cluster based on spec recommend by Getup`),
 		Example: Examples(`
 		undistro create cluster cool-cluster -n cool-namespace --infra aws --flavor ec2
+		undistro create cluster local-cluster -n cool-namespace --infra docker --flavor kubeadm
 		`),
 		Run: func(cmd *cobra.Command, args []string) {
 			cmdutil.CheckErr(o.Complete(f, cmd, args))
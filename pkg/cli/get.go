@@ -16,10 +16,13 @@ limitations under the License.
 package cli
 
 import (
+	"time"
+
 	"github.com/getupio-undistro/undistro/pkg/kube"
 	"github.com/getupio-undistro/undistro/pkg/scheme"
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 	"k8s.io/cli-runtime/pkg/genericclioptions"
 	"k8s.io/kubectl/pkg/cmd/get"
 	cmdutil "k8s.io/kubectl/pkg/cmd/util"
@@ -30,14 +33,24 @@ type KubeconfigOptions struct {
 	genericclioptions.IOStreams
 	Namespace   string
 	ClusterName string
+	User        string
+	Groups      []string
+	TTL         time.Duration
 }
 
 func NewKubeconfigOptions(streams genericclioptions.IOStreams) *KubeconfigOptions {
 	return &KubeconfigOptions{
 		IOStreams: streams,
+		TTL:       8 * time.Hour,
 	}
 }
 
+func (o *KubeconfigOptions) AddFlags(flags *pflag.FlagSet) {
+	flags.StringVar(&o.User, "user", o.User, "issue a client certificate kubeconfig for this user instead of getting the admin kubeconfig")
+	flags.StringSliceVar(&o.Groups, "group", o.Groups, "groups of the user, can be repeated")
+	flags.DurationVar(&o.TTL, "ttl", o.TTL, "how long the user kubeconfig is valid")
+}
+
 func (o *KubeconfigOptions) Complete(f cmdutil.Factory, cmd *cobra.Command, args []string) error {
 	var err error
 	o.Namespace, _, err = f.ToRawKubeConfigLoader().Namespace()
@@ -48,6 +61,12 @@ func (o *KubeconfigOptions) Complete(f cmdutil.Factory, cmd *cobra.Command, args
 		return errors.New("required 1 argument")
 	}
 	o.ClusterName = args[0]
+	if o.User == "" && len(o.Groups) > 0 {
+		return errors.New("--group requires --user")
+	}
+	if o.User != "" && o.TTL <= 0 {
+		return errors.New("--ttl must be greater than 0")
+	}
 	return nil
 }
 
@@ -62,10 +81,16 @@ func (o *KubeconfigOptions) RunGetKubeconfig(f cmdutil.Factory, cmd *cobra.Comma
 	if err != nil {
 		return errors.Errorf("unable to create client: %v", err)
 	}
-	byt, err := kube.GetKubeconfig(cmd.Context(), c, client.ObjectKey{
+	key := client.ObjectKey{
 		Namespace: o.Namespace,
 		Name:      o.ClusterName,
-	})
+	}
+	var byt []byte
+	if o.User != "" {
+		byt, err = kube.NewUserKubeconfig(cmd.Context(), c, key, o.User, o.Groups, o.TTL)
+	} else {
+		byt, err = kube.GetKubeconfig(cmd.Context(), c, key)
+	}
 	if err != nil {
 		return errors.Errorf("unable to get kubeconfig: %v", err)
 	}
@@ -79,18 +104,23 @@ func NewCmdKubeconfig(f cmdutil.Factory, streams genericclioptions.IOStreams) *c
 		Use:                   "kubeconfig [cluster name]",
 		DisableFlagsInUseLine: true,
 		Short:                 "Get kubeconfig of a cluster",
-		Long:                  LongDesc(`Get kubeconfig of a cluster created or imported by UnDistro.`),
+		Long: LongDesc(`Get kubeconfig of a cluster created or imported by UnDistro.
+		With --user, a kubeconfig authenticating the user with a client certificate
+		signed by the cluster CA is issued instead. It expires after --ttl.`),
 		Example: Examples(`
 		# Get kubeconfig of a cluster in default namespace
 		undistro get kubeconfig cool-cluster
 		# Get kubeconfig of a cluster in others namespace
 		undistro get kubeconfig cool-cluster -n cool-namespace
+		# Get a kubeconfig valid for 1 hour for the user jane in the developers group
+		undistro get kubeconfig cool-cluster --user jane --group developers --ttl 1h
 		`),
 		Run: func(cmd *cobra.Command, args []string) {
 			cmdutil.CheckErr(o.Complete(f, cmd, args))
 			cmdutil.CheckErr(o.RunGetKubeconfig(f, cmd))
 		},
 	}
+	o.AddFlags(cmd.Flags())
 	return cmd
 }
 
@@ -400,6 +400,7 @@ func (o *MoveOptions) deleteGroup(ctx context.Context, group graph.MoveGroup, fr
 
 var (
 	removeFinalizersPatch = client.RawPatch(types.MergePatchType, []byte("{\"metadata\":{\"finalizers\":[]}}"))
+	removeProtectionPatch = client.RawPatch(types.MergePatchType, []byte(fmt.Sprintf("{\"metadata\":{\"annotations\":{%q:null}}}", meta.ProtectAnnotation)))
 )
 
 // deleteSourceObject deletes the Kubernetes object corresponding to the node from the source management cluster, taking care of removing all the finalizers so
@@ -434,6 +435,14 @@ func (o *MoveOptions) deleteSourceObject(ctx context.Context, nodeToDelete *grap
 		}
 	}
 
+	// protected objects are deleted from the source because they were already created in the target
+	if _, ok := sourceObj.GetAnnotations()[meta.ProtectAnnotation]; ok {
+		if err := fromProxy.Patch(ctx, sourceObj, removeProtectionPatch); err != nil {
+			return errors.Wrapf(err, "error removing protection from %q %s/%s",
+				sourceObj.GroupVersionKind(), sourceObj.GetNamespace(), sourceObj.GetName())
+		}
+	}
+
 	if err := fromProxy.Delete(ctx, sourceObj); err != nil {
 		return errors.Wrapf(err, "error deleting %q %s/%s",
 			sourceObj.GroupVersionKind(), sourceObj.GetNamespace(), sourceObj.GetName())
@@ -0,0 +1,239 @@
+/*
+Copyright 2020-2021 The UnDistro authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cli
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	appv1alpha1 "github.com/getupio-undistro/undistro/apis/app/v1alpha1"
+	"github.com/getupio-undistro/undistro/pkg/backup"
+	"github.com/getupio-undistro/undistro/pkg/kube"
+	"github.com/getupio-undistro/undistro/pkg/scheme"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	cmdutil "k8s.io/kubectl/pkg/cmd/util"
+	capi "sigs.k8s.io/cluster-api/api/v1alpha3"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+type RestoreOptions struct {
+	genericclioptions.IOStreams
+	Namespace   string
+	ClusterName string
+	Snapshot    string
+	Timeout     time.Duration
+}
+
+func NewRestoreOptions(streams genericclioptions.IOStreams) *RestoreOptions {
+	return &RestoreOptions{
+		IOStreams: streams,
+		Timeout:   30 * time.Minute,
+	}
+}
+
+func (o *RestoreOptions) AddFlags(flags *pflag.FlagSet) {
+	flags.StringVar(&o.Snapshot, "snapshot", o.Snapshot, "key of the snapshot in the bucket (default the last successful snapshot)")
+	flags.DurationVar(&o.Timeout, "timeout", o.Timeout, "how long to wait for the restore")
+}
+
+func (o *RestoreOptions) Complete(f cmdutil.Factory, cmd *cobra.Command, args []string) error {
+	var err error
+	o.Namespace, _, err = f.ToRawKubeConfigLoader().Namespace()
+	if err != nil {
+		return err
+	}
+	if len(args) != 1 {
+		return errors.New("required 1 argument")
+	}
+	o.ClusterName = args[0]
+	return nil
+}
+
+func (o *RestoreOptions) RunRestore(f cmdutil.Factory, cmd *cobra.Command) error {
+	cfg, err := f.ToRESTConfig()
+	if err != nil {
+		return errors.Errorf("unable to get config: %v", err)
+	}
+	c, err := client.New(cfg, client.Options{
+		Scheme: scheme.Scheme,
+	})
+	if err != nil {
+		return errors.Errorf("unable to create client: %v", err)
+	}
+	key := client.ObjectKey{
+		Name:      o.ClusterName,
+		Namespace: o.Namespace,
+	}
+	cl := appv1alpha1.Cluster{}
+	err = c.Get(cmd.Context(), key, &cl)
+	if err != nil {
+		return err
+	}
+	if cl.Spec.InfrastructureProvider.IsManaged() {
+		return errors.New("restore is not supported in managed clusters")
+	}
+	if cl.Spec.Backup == nil {
+		return errors.Errorf("cluster %s has no backup configured", o.ClusterName)
+	}
+	snapshot := o.Snapshot
+	if snapshot == "" {
+		if cl.Status.LastBackup == nil {
+			return errors.Errorf("cluster %s has no successful snapshot", o.ClusterName)
+		}
+		snapshot = cl.Status.LastBackup.Snapshot
+	}
+	wc, err := kube.NewClusterClient(cmd.Context(), c, o.ClusterName, o.Namespace)
+	if err != nil {
+		return errors.Errorf("unable to create cluster client: %v", err)
+	}
+	members, err := backup.Members(cmd.Context(), wc)
+	if err != nil {
+		return err
+	}
+	if len(members) == 0 {
+		return errors.Errorf("no etcd members found in cluster %s", o.ClusterName)
+	}
+	// UnDistro and the machine health checks would replace the control plane while etcd is down
+	paused, err := setPaused(cmd.Context(), c, key, true)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_, pauseErr := setPaused(context.Background(), c, key, paused)
+		if pauseErr != nil {
+			fmt.Fprintf(o.IOStreams.ErrOut, "unable to resume cluster %s: %v\n", o.ClusterName, pauseErr)
+		}
+	}()
+	fmt.Fprintf(o.IOStreams.Out, "Restoring snapshot %s in %d etcd members\n", snapshot, len(members))
+	initialCluster := backup.InitialCluster(members)
+	started := make(map[string]metav1.Time, len(members))
+	for _, m := range members {
+		p := backup.RestorePod(&cl, m, initialCluster, snapshot)
+		err = wc.Create(cmd.Context(), p)
+		if err != nil {
+			return errors.Errorf("unable to restore etcd member %s: %v", m.Name, err)
+		}
+		started[m.Node] = p.CreationTimestamp
+	}
+	// the API server is unavailable while etcd is restored, so errors are retried until the timeout
+	err = wait.PollImmediate(10*time.Second, o.Timeout, func() (bool, error) {
+		return restoreDone(cmd.Context(), wc, members, started)
+	})
+	if err != nil {
+		return errors.Errorf("unable to restore cluster %s: %v", o.ClusterName, err)
+	}
+	fmt.Fprintf(o.IOStreams.Out, "Cluster %s restored from snapshot %s\n", o.ClusterName, snapshot)
+	return nil
+}
+
+// restoreDone returns if the etcd of every member is ready again since its restore pod was created.
+// The restored etcd has no restore pods, so they are just checked for failures before the API server goes down.
+func restoreDone(ctx context.Context, wc client.Client, members []backup.Member, started map[string]metav1.Time) (bool, error) {
+	pods := corev1.PodList{}
+	err := wc.List(ctx, &pods, client.InNamespace(backup.Namespace), client.MatchingLabels{"component": "etcd", "tier": "control-plane"})
+	if err != nil {
+		return false, nil
+	}
+	for _, m := range members {
+		p := corev1.Pod{}
+		err = wc.Get(ctx, client.ObjectKey{Name: backup.RestorePodName(m.Node), Namespace: backup.Namespace}, &p)
+		switch {
+		case apierrors.IsNotFound(err):
+		case err != nil:
+			return false, nil
+		case p.Status.Phase == corev1.PodFailed:
+			return false, errors.Errorf("restore of etcd member %s failed, check the logs of pod %s/%s", m.Name, p.Namespace, p.Name)
+		default:
+			return false, nil
+		}
+		if !etcdReadySince(pods.Items, m.Node, started[m.Node]) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// etcdReadySince returns if the etcd static pod of the node became ready after the time
+func etcdReadySince(pods []corev1.Pod, node string, t metav1.Time) bool {
+	for _, p := range pods {
+		if p.Spec.NodeName != node {
+			continue
+		}
+		for _, c := range p.Status.Conditions {
+			if c.Type == corev1.PodReady && c.Status == corev1.ConditionTrue && t.Before(&c.LastTransitionTime) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// setPaused pauses or resumes the reconciliation of the cluster and of its Cluster API cluster.
+// It returns if the cluster was paused before.
+func setPaused(ctx context.Context, c client.Client, key client.ObjectKey, paused bool) (bool, error) {
+	cl := appv1alpha1.Cluster{}
+	err := c.Get(ctx, key, &cl)
+	if err != nil {
+		return false, err
+	}
+	was := cl.Spec.Paused
+	patch := client.MergeFrom(cl.DeepCopy())
+	cl.Spec.Paused = paused
+	err = c.Patch(ctx, &cl, patch)
+	if err != nil {
+		return was, err
+	}
+	capiCluster := capi.Cluster{}
+	err = c.Get(ctx, key, &capiCluster)
+	if err != nil {
+		return was, err
+	}
+	patch = client.MergeFrom(capiCluster.DeepCopy())
+	capiCluster.Spec.Paused = paused
+	return was, c.Patch(ctx, &capiCluster, patch)
+}
+
+func NewCmdRestore(f cmdutil.Factory, streams genericclioptions.IOStreams) *cobra.Command {
+	o := NewRestoreOptions(streams)
+	cmd := &cobra.Command{
+		Use:                   "restore [cluster name]",
+		DisableFlagsInUseLine: true,
+		Short:                 "Restore the etcd of a cluster from a snapshot",
+		Long: LongDesc(`Restore the etcd of a cluster from a snapshot taken by the cluster backup.
+		The snapshot replaces the data of every etcd member, so changes made after it are lost.
+		The cluster reconciliation is paused during the restore.`),
+		Example: Examples(`
+		# Restore a cluster from the last successful snapshot
+		undistro restore cool-cluster -n cool-namespace
+		# Restore a cluster from a chosen snapshot
+		undistro restore cool-cluster -n cool-namespace --snapshot cool-namespace/cool-cluster/undistro-etcd-backup-1625097600.db
+		`),
+		Run: func(cmd *cobra.Command, args []string) {
+			cmdutil.CheckErr(o.Complete(f, cmd, args))
+			cmdutil.CheckErr(o.RunRestore(f, cmd))
+		},
+	}
+	o.AddFlags(cmd.Flags())
+	return cmd
+}
@@ -0,0 +1,111 @@
+/*
+Copyright 2020-2021 The UnDistro authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cli
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/getupio-undistro/undistro/pkg/backup"
+	"github.com/getupio-undistro/undistro/pkg/scheme"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func etcdPod(node string, ready corev1.ConditionStatus, since time.Time) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "etcd-" + node,
+			Namespace: backup.Namespace,
+			Labels:    map[string]string{"component": "etcd", "tier": "control-plane"},
+		},
+		Spec: corev1.PodSpec{NodeName: node},
+		Status: corev1.PodStatus{
+			Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: ready, LastTransitionTime: metav1.NewTime(since)}},
+		},
+	}
+}
+
+func restorePod(node string, phase corev1.PodPhase) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: backup.RestorePodName(node), Namespace: backup.Namespace},
+		Status:     corev1.PodStatus{Phase: phase},
+	}
+}
+
+func TestRestoreDone(t *testing.T) {
+	start := time.Now().Truncate(time.Second)
+	before, after := start.Add(-time.Minute), start.Add(time.Minute)
+	members := []backup.Member{{Node: "cp-0", Name: "cp-0"}, {Node: "cp-1", Name: "cp-1"}}
+	started := map[string]metav1.Time{
+		"cp-0": metav1.NewTime(start),
+		"cp-1": metav1.NewTime(start),
+	}
+	tests := []struct {
+		name    string
+		objs    []client.Object
+		want    bool
+		wantErr bool
+	}{
+		{
+			name: "restoring",
+			objs: []client.Object{
+				restorePod("cp-0", corev1.PodRunning), restorePod("cp-1", corev1.PodPending),
+				etcdPod("cp-0", corev1.ConditionTrue, before), etcdPod("cp-1", corev1.ConditionTrue, before),
+			},
+		},
+		{
+			name: "restore failed",
+			objs: []client.Object{
+				restorePod("cp-0", corev1.PodFailed), restorePod("cp-1", corev1.PodRunning),
+				etcdPod("cp-0", corev1.ConditionTrue, before), etcdPod("cp-1", corev1.ConditionTrue, before),
+			},
+			wantErr: true,
+		},
+		{
+			name: "etcd ready since the snapshot",
+			objs: []client.Object{etcdPod("cp-0", corev1.ConditionTrue, after), etcdPod("cp-1", corev1.ConditionTrue, before)},
+		},
+		{
+			name: "etcd not ready",
+			objs: []client.Object{etcdPod("cp-0", corev1.ConditionTrue, after), etcdPod("cp-1", corev1.ConditionFalse, after)},
+		},
+		{
+			name: "etcd pod missing",
+			objs: []client.Object{etcdPod("cp-0", corev1.ConditionTrue, after)},
+		},
+		{
+			name: "restored",
+			objs: []client.Object{etcdPod("cp-0", corev1.ConditionTrue, after), etcdPod("cp-1", corev1.ConditionTrue, after)},
+			want: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wc := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(tt.objs...).Build()
+			got, err := restoreDone(context.Background(), wc, members, started)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("restoreDone() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("restoreDone() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
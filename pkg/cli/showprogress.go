@@ -30,6 +30,7 @@ import (
 	"github.com/spf13/cobra"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/cli-runtime/pkg/genericclioptions"
 	"k8s.io/client-go/kubernetes"
 	cmdutil "k8s.io/kubectl/pkg/cmd/util"
@@ -90,7 +91,17 @@ func (o *ShowProgressOptions) RunShowProgress(f cmdutil.Factory, cmd *cobra.Comm
 		"ENV":     make(map[string]interface{}),
 		"Cluster": &obj,
 	}
-	objs, err := template.GetObjs(fs.FS, "clustertemplates", obj.GetTemplate(), vars)
+	var objs []unstructured.Unstructured
+	if obj.Spec.TemplateRef != nil {
+		tpl := appv1alpha1.ClusterTemplate{}
+		err = k8sClient.Get(cmd.Context(), client.ObjectKey{Name: obj.Spec.TemplateRef.Name, Namespace: o.Namespace}, &tpl)
+		if err != nil {
+			return err
+		}
+		objs, err = template.GetObjsFromText(tpl.Name, tpl.Spec.Template, vars)
+	} else {
+		objs, err = template.GetObjs(fs.FS, "clustertemplates", obj.GetTemplate(), vars)
+	}
 	if err != nil {
 		return err
 	}
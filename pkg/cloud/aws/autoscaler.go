@@ -0,0 +1,154 @@
+/*
+Copyright 2021 The UnDistro authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package aws
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/autoscaling"
+	"github.com/aws/aws-sdk-go/service/autoscaling/autoscalingiface"
+	"github.com/aws/aws-sdk-go/service/eks"
+	"github.com/aws/aws-sdk-go/service/eks/eksiface"
+	appv1alpha1 "github.com/getupio-undistro/undistro/apis/app/v1alpha1"
+	"github.com/getupio-undistro/undistro/pkg/cloud/aws/awserrors"
+	"github.com/getupio-undistro/undistro/pkg/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var awsManagedControlPlaneGVK = schema.GroupVersionKind{
+	Group:   "controlplane.cluster.x-k8s.io",
+	Version: "v1alpha3",
+	Kind:    "AWSManagedControlPlane",
+}
+
+// AutoscalerValues returns the values of the AWS provider of cluster-autoscaler. It runs in the workload cluster
+// with the instance role of its nodes and discovers the auto scaling groups tagged with k8s.io/cluster-autoscaler/enabled
+// and k8s.io/cluster-autoscaler/<name>, set in the machine pools of EC2 clusters and by EKS in the ones of its node groups.
+// In EC2 clusters it runs in the control plane, as just the control plane role is allowed to scale the groups.
+func AutoscalerValues(ctx context.Context, c client.Client, cl *appv1alpha1.Cluster) (map[string]interface{}, error) {
+	name, err := autoscalerClusterName(ctx, c, cl)
+	if err != nil {
+		return nil, err
+	}
+	values := map[string]interface{}{
+		"cloudProvider": "aws",
+		"awsRegion":     cl.Spec.InfrastructureProvider.Region,
+		"autoDiscovery": map[string]interface{}{
+			"clusterName": name,
+		},
+	}
+	if cl.Spec.InfrastructureProvider.IsManaged() {
+		return values, nil
+	}
+	term := func(label string) map[string]interface{} {
+		return map[string]interface{}{
+			"matchExpressions": []interface{}{
+				map[string]interface{}{"key": label, "operator": "Exists"},
+			},
+		}
+	}
+	values["affinity"] = map[string]interface{}{
+		"nodeAffinity": map[string]interface{}{
+			"requiredDuringSchedulingIgnoredDuringExecution": map[string]interface{}{
+				"nodeSelectorTerms": []interface{}{term(meta.LabelK8sMaster), term(meta.LabelK8sCP)},
+			},
+		},
+	}
+	values["tolerations"] = []interface{}{
+		map[string]interface{}{"key": meta.LabelK8sMaster, "operator": "Exists", "effect": "NoSchedule"},
+		map[string]interface{}{"key": meta.LabelK8sCP, "operator": "Exists", "effect": "NoSchedule"},
+	}
+	return values, nil
+}
+
+// AutoscaledReplicas returns the desired capacity of the auto scaling group of the
+// machine pool, or the desired size of the node group in EKS clusters
+func AutoscaledReplicas(ctx context.Context, c client.Client, cl *appv1alpha1.Cluster, name string) (int32, bool, error) {
+	sess, err := clusterSession(ctx, c, cl)
+	if err != nil {
+		return 0, false, err
+	}
+	if cl.Spec.InfrastructureProvider.Flavor != appv1alpha1.EKS.String() {
+		return groupDesiredCapacity(ctx, autoscaling.New(sess), name)
+	}
+	clusterName, err := autoscalerClusterName(ctx, c, cl)
+	if err != nil {
+		return 0, false, err
+	}
+	return nodegroupDesiredSize(ctx, eks.New(sess), clusterName, name)
+}
+
+// autoscalerClusterName returns the cluster name in the cluster-autoscaler tags of the auto scaling groups,
+// in EKS clusters it's the name of the EKS cluster
+func autoscalerClusterName(ctx context.Context, c client.Client, cl *appv1alpha1.Cluster) (string, error) {
+	if cl.Spec.InfrastructureProvider.Flavor != appv1alpha1.EKS.String() {
+		return cl.Name, nil
+	}
+	cp := unstructured.Unstructured{}
+	cp.SetGroupVersionKind(awsManagedControlPlaneGVK)
+	err := c.Get(ctx, client.ObjectKeyFromObject(cl), &cp)
+	if err != nil {
+		return "", err
+	}
+	name, _, err := unstructured.NestedString(cp.Object, "spec", "eksClusterName")
+	if err != nil {
+		return "", err
+	}
+	if name == "" {
+		return "", fmt.Errorf("EKS cluster name of %s isn't set yet", cl.Name)
+	}
+	return name, nil
+}
+
+// groupDesiredCapacity returns the desired capacity of the auto scaling group, which is
+// named after the AWSMachinePool
+func groupDesiredCapacity(ctx context.Context, asgClient autoscalingiface.AutoScalingAPI, name string) (int32, bool, error) {
+	out, err := asgClient.DescribeAutoScalingGroupsWithContext(ctx, &autoscaling.DescribeAutoScalingGroupsInput{
+		AutoScalingGroupNames: []*string{aws.String(name)},
+	})
+	if err != nil {
+		return 0, false, err
+	}
+	for _, g := range out.AutoScalingGroups {
+		if aws.StringValue(g.AutoScalingGroupName) == name {
+			return int32(aws.Int64Value(g.DesiredCapacity)), true, nil
+		}
+	}
+	return 0, false, nil
+}
+
+// nodegroupDesiredSize returns the desired size of the EKS node group, which is
+// named after the AWSManagedMachinePool
+func nodegroupDesiredSize(ctx context.Context, eksClient eksiface.EKSAPI, clusterName, name string) (int32, bool, error) {
+	out, err := eksClient.DescribeNodegroupWithContext(ctx, &eks.DescribeNodegroupInput{
+		ClusterName:   aws.String(clusterName),
+		NodegroupName: aws.String(name),
+	})
+	if err != nil {
+		if code, ok := awserrors.Code(err); ok && code == eks.ErrCodeResourceNotFoundException {
+			return 0, false, nil
+		}
+		return 0, false, err
+	}
+	if out.Nodegroup == nil || out.Nodegroup.ScalingConfig == nil {
+		return 0, false, nil
+	}
+	return int32(aws.Int64Value(out.Nodegroup.ScalingConfig.DesiredSize)), true, nil
+}
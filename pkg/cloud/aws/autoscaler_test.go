@@ -0,0 +1,113 @@
+/*
+Copyright 2021 The UnDistro authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package aws
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/eks"
+	"github.com/aws/aws-sdk-go/service/eks/eksiface"
+	appv1alpha1 "github.com/getupio-undistro/undistro/apis/app/v1alpha1"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+type fakeEKS struct {
+	eksiface.EKSAPI
+	desired map[string]int64
+}
+
+func (f *fakeEKS) DescribeNodegroupWithContext(_ aws.Context, in *eks.DescribeNodegroupInput, _ ...request.Option) (*eks.DescribeNodegroupOutput, error) {
+	desired, ok := f.desired[aws.StringValue(in.ClusterName)+"/"+aws.StringValue(in.NodegroupName)]
+	if !ok {
+		return nil, awserr.New(eks.ErrCodeResourceNotFoundException, "nodegroup not found", nil)
+	}
+	return &eks.DescribeNodegroupOutput{
+		Nodegroup: &eks.Nodegroup{
+			ScalingConfig: &eks.NodegroupScalingConfig{DesiredSize: aws.Int64(desired)},
+		},
+	}, nil
+}
+
+func TestGroupDesiredCapacity(t *testing.T) {
+	g := NewWithT(t)
+	asgClient := &fakeAutoScaling{desired: 3}
+	replicas, ok, err := groupDesiredCapacity(context.Background(), asgClient, "pool")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(ok).To(BeTrue())
+	g.Expect(replicas).To(BeEquivalentTo(3))
+
+	_, ok, err = groupDesiredCapacity(context.Background(), asgClient, "other")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(ok).To(BeFalse())
+}
+
+func TestNodegroupDesiredSize(t *testing.T) {
+	g := NewWithT(t)
+	eksClient := &fakeEKS{desired: map[string]int64{"default_test-control-plane/test-mp-pool": 4}}
+	replicas, ok, err := nodegroupDesiredSize(context.Background(), eksClient, "default_test-control-plane", "test-mp-pool")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(ok).To(BeTrue())
+	g.Expect(replicas).To(BeEquivalentTo(4))
+
+	_, ok, err = nodegroupDesiredSize(context.Background(), eksClient, "default_test-control-plane", "test-mp-new")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(ok).To(BeFalse())
+}
+
+func TestAutoscalerClusterName(t *testing.T) {
+	cp := &unstructured.Unstructured{}
+	cp.SetGroupVersionKind(awsManagedControlPlaneGVK)
+	cp.SetName("test")
+	cp.SetNamespace("default")
+	tests := []struct {
+		name           string
+		flavor         string
+		eksClusterName string
+		want           string
+		wantErr        bool
+	}{
+		{name: "ec2", flavor: appv1alpha1.EC2.String(), want: "test"},
+		{name: "eks", flavor: appv1alpha1.EKS.String(), eksClusterName: "default_test-control-plane", want: "default_test-control-plane"},
+		{name: "eks name not set", flavor: appv1alpha1.EKS.String(), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			obj := cp.DeepCopy()
+			if tt.eksClusterName != "" {
+				g.Expect(unstructured.SetNestedField(obj.Object, tt.eksClusterName, "spec", "eksClusterName")).To(Succeed())
+			}
+			c := fake.NewClientBuilder().WithScheme(runtime.NewScheme()).WithObjects(obj).Build()
+			cl := &appv1alpha1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "default"}}
+			cl.Spec.InfrastructureProvider.Flavor = tt.flavor
+			got, err := autoscalerClusterName(context.Background(), c, cl)
+			if tt.wantErr {
+				g.Expect(err).To(HaveOccurred())
+				return
+			}
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(got).To(Equal(tt.want))
+		})
+	}
+}
@@ -40,6 +40,7 @@ import (
 	"github.com/getupio-undistro/undistro/pkg/util"
 	"github.com/pkg/errors"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/cli-runtime/pkg/genericclioptions"
 	capi "sigs.k8s.io/cluster-api/api/v1alpha3"
@@ -100,7 +101,7 @@ func ReconcileLaunchTemplate(ctx context.Context, r client.Client, cl *appv1alph
 	for i := range cl.Spec.Workers {
 		if !cl.Spec.InfrastructureProvider.IsManaged() {
 			key := client.ObjectKey{
-				Name:      fmt.Sprintf("%s-mp-%d", cl.Name, i),
+				Name:      cl.MachinePoolName(i),
 				Namespace: cl.GetNamespace(),
 			}
 			u := unstructured.Unstructured{}
@@ -108,7 +109,11 @@ func ReconcileLaunchTemplate(ctx context.Context, r client.Client, cl *appv1alph
 			u.SetKind(kindByFlavor(cl.Spec.InfrastructureProvider.Flavor))
 			err := r.Get(ctx, key, &u)
 			if err != nil {
-				return client.IgnoreNotFound(err)
+				// pools with data volumes are machine deployments without launch templates
+				if apierrors.IsNotFound(err) {
+					continue
+				}
+				return err
 			}
 			ref, err := launchTemplateRef(ctx, u)
 			if err != nil {
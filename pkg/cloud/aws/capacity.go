@@ -0,0 +1,116 @@
+/*
+Copyright 2021 The UnDistro authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package aws
+
+import (
+	"context"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/ec2/ec2iface"
+	appv1alpha1 "github.com/getupio-undistro/undistro/apis/app/v1alpha1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// describeInstancesLimit is the maximum number of instance IDs in a DescribeInstances request
+const describeInstancesLimit = 1000
+
+// CapacityTypes returns the capacity type of the EC2 instances with the given provider IDs
+func CapacityTypes(ctx context.Context, c client.Client, cl *appv1alpha1.Cluster, providerIDs []string) (map[string]appv1alpha1.CapacityType, error) {
+	if len(providerIDs) == 0 {
+		return nil, nil
+	}
+	sess, err := clusterSession(ctx, c, cl)
+	if err != nil {
+		return nil, err
+	}
+	return instanceCapacityTypes(ctx, ec2.New(sess), providerIDs)
+}
+
+// clusterSession returns a session in the cluster region using the credentials of the provider
+func clusterSession(ctx context.Context, c client.Client, cl *appv1alpha1.Cluster) (*session.Session, error) {
+	cred, _, err := Credentials(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	return session.NewSession(&aws.Config{
+		Region: aws.String(cl.Spec.InfrastructureProvider.Region),
+		Credentials: credentials.NewStaticCredentials(
+			cred.AccessKeyID,
+			cred.SecretAccessKey,
+			cred.SessionToken,
+		),
+	})
+}
+
+func instanceCapacityTypes(ctx context.Context, ec2Client ec2iface.EC2API, providerIDs []string) (map[string]appv1alpha1.CapacityType, error) {
+	byInstance := make(map[string]string, len(providerIDs))
+	ids := make([]*string, 0, len(providerIDs))
+	for _, pid := range providerIDs {
+		id := instanceID(pid)
+		if id == "" {
+			continue
+		}
+		byInstance[id] = pid
+		ids = append(ids, aws.String(id))
+	}
+	res := make(map[string]appv1alpha1.CapacityType, len(ids))
+	for len(ids) > 0 {
+		n := len(ids)
+		if n > describeInstancesLimit {
+			n = describeInstancesLimit
+		}
+		input := ec2.DescribeInstancesInput{
+			InstanceIds: ids[:n],
+		}
+		ids = ids[n:]
+		err := ec2Client.DescribeInstancesPagesWithContext(ctx, &input, func(out *ec2.DescribeInstancesOutput, _ bool) bool {
+			for _, r := range out.Reservations {
+				for _, i := range r.Instances {
+					pid, ok := byInstance[aws.StringValue(i.InstanceId)]
+					if !ok {
+						continue
+					}
+					res[pid] = appv1alpha1.OnDemandCapacity
+					if aws.StringValue(i.InstanceLifecycle) == ec2.InstanceLifecycleTypeSpot {
+						res[pid] = appv1alpha1.SpotCapacity
+					}
+				}
+			}
+			return true
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+// instanceID returns the instance ID of a provider ID like aws:///us-east-1a/i-0123456789abcdef0
+func instanceID(providerID string) string {
+	if !strings.HasPrefix(providerID, "aws://") {
+		return ""
+	}
+	split := strings.Split(providerID, "/")
+	id := split[len(split)-1]
+	if !strings.HasPrefix(id, "i-") {
+		return ""
+	}
+	return id
+}
@@ -0,0 +1,63 @@
+/*
+Copyright 2021 The UnDistro authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package aws
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/ec2/ec2iface"
+	appv1alpha1 "github.com/getupio-undistro/undistro/apis/app/v1alpha1"
+	. "github.com/onsi/gomega"
+)
+
+type fakeEC2 struct {
+	ec2iface.EC2API
+	lifecycle map[string]string
+}
+
+func (f fakeEC2) DescribeInstancesPagesWithContext(_ aws.Context, in *ec2.DescribeInstancesInput, fn func(*ec2.DescribeInstancesOutput, bool) bool, _ ...request.Option) error {
+	r := &ec2.Reservation{}
+	for _, id := range in.InstanceIds {
+		i := &ec2.Instance{InstanceId: id}
+		if l := f.lifecycle[aws.StringValue(id)]; l != "" {
+			i.InstanceLifecycle = aws.String(l)
+		}
+		r.Instances = append(r.Instances, i)
+	}
+	fn(&ec2.DescribeInstancesOutput{Reservations: []*ec2.Reservation{r}}, true)
+	return nil
+}
+
+func TestInstanceCapacityTypes(t *testing.T) {
+	g := NewWithT(t)
+	ec2Client := fakeEC2{
+		lifecycle: map[string]string{"i-0b": ec2.InstanceLifecycleTypeSpot},
+	}
+	got, err := instanceCapacityTypes(context.Background(), ec2Client, []string{
+		"aws:///us-east-1a/i-0a",
+		"aws:///us-east-1b/i-0b",
+		"openstack:///5d0b3e52",
+	})
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(got).To(Equal(map[string]appv1alpha1.CapacityType{
+		"aws:///us-east-1a/i-0a": appv1alpha1.OnDemandCapacity,
+		"aws:///us-east-1b/i-0b": appv1alpha1.SpotCapacity,
+	}))
+}
@@ -144,6 +144,36 @@ Resources:
       - Ref: AWSIAMRoleControlPlane
       - Ref: AWSIAMRoleNodes
     Type: AWS::IAM::ManagedPolicy
+  AWSIAMManagedPolicyClusterAutoscaler:
+    Properties:
+      Description: For the cluster-autoscaler of machine pools
+      ManagedPolicyName: cluster-autoscaler.cluster-api-provider-aws.sigs.k8s.io
+      PolicyDocument:
+        Statement:
+        - Action:
+          - autoscaling:DescribeAutoScalingGroups
+          - autoscaling:DescribeAutoScalingInstances
+          - autoscaling:DescribeLaunchConfigurations
+          - autoscaling:DescribeTags
+          - ec2:DescribeInstanceTypes
+          - ec2:DescribeLaunchTemplateVersions
+          Effect: Allow
+          Resource:
+          - '*'
+        - Action:
+          - autoscaling:SetDesiredCapacity
+          - autoscaling:TerminateInstanceInAutoScalingGroup
+          Condition:
+            StringEquals:
+              autoscaling:ResourceTag/k8s.io/cluster-autoscaler/enabled: "true"
+          Effect: Allow
+          Resource:
+          - '*'
+        Version: 2012-10-17
+      Roles:
+      - Ref: AWSIAMRoleControlPlane
+      - Ref: AWSIAMRoleEKSNodegroup
+    Type: AWS::IAM::ManagedPolicy
   AWSIAMManagedPolicyControllers:
     Properties:
       Description: For the Kubernetes Cluster API Provider AWS Controllers
@@ -0,0 +1,126 @@
+/*
+Copyright 2021 The UnDistro authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package aws
+
+import (
+	"context"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/autoscaling"
+	"github.com/aws/aws-sdk-go/service/autoscaling/autoscalingiface"
+	appv1alpha1 "github.com/getupio-undistro/undistro/apis/app/v1alpha1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// RemoveMachines terminates the EC2 instances with the given provider IDs
+// decreasing the size of their auto scaling groups, so no other instance is replaced
+func RemoveMachines(ctx context.Context, c client.Client, cl *appv1alpha1.Cluster, providerIDs []string) error {
+	if len(providerIDs) == 0 {
+		return nil
+	}
+	sess, err := clusterSession(ctx, c, cl)
+	if err != nil {
+		return err
+	}
+	return terminateInstances(ctx, autoscaling.New(sess), providerIDs, true)
+}
+
+// ReplaceMachines terminates the EC2 instances with the given provider IDs
+// keeping the size of their auto scaling groups, so they are replaced by new instances
+func ReplaceMachines(ctx context.Context, c client.Client, cl *appv1alpha1.Cluster, providerIDs []string) error {
+	if len(providerIDs) == 0 {
+		return nil
+	}
+	sess, err := clusterSession(ctx, c, cl)
+	if err != nil {
+		return err
+	}
+	return terminateInstances(ctx, autoscaling.New(sess), providerIDs, false)
+}
+
+func terminateInstances(ctx context.Context, asgClient autoscalingiface.AutoScalingAPI, providerIDs []string, decrement bool) error {
+	ids := make([]*string, 0, len(providerIDs))
+	for _, pid := range providerIDs {
+		if id := instanceID(pid); id != "" {
+			ids = append(ids, aws.String(id))
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	out, err := asgClient.DescribeAutoScalingInstancesWithContext(ctx, &autoscaling.DescribeAutoScalingInstancesInput{
+		InstanceIds: ids,
+	})
+	if err != nil {
+		return err
+	}
+	// instances terminated by a previous attempt are skipped
+	byGroup := make(map[string][]*string)
+	for _, i := range out.AutoScalingInstances {
+		if strings.HasPrefix(aws.StringValue(i.LifecycleState), "Terminat") {
+			continue
+		}
+		name := aws.StringValue(i.AutoScalingGroupName)
+		byGroup[name] = append(byGroup[name], i.InstanceId)
+	}
+	for name, instances := range byGroup {
+		if !decrement {
+			for _, id := range instances {
+				_, err = asgClient.TerminateInstanceInAutoScalingGroupWithContext(ctx, &autoscaling.TerminateInstanceInAutoScalingGroupInput{
+					InstanceId:                     id,
+					ShouldDecrementDesiredCapacity: aws.Bool(false),
+				})
+				if err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		groups, err := asgClient.DescribeAutoScalingGroupsWithContext(ctx, &autoscaling.DescribeAutoScalingGroupsInput{
+			AutoScalingGroupNames: []*string{aws.String(name)},
+		})
+		if err != nil {
+			return err
+		}
+		if len(groups.AutoScalingGroups) == 0 {
+			continue
+		}
+		g := groups.AutoScalingGroups[0]
+		// the desired capacity can't be decreased below the minimum size,
+		// which is set to the pool replicas when autoscaling is disabled
+		desired := aws.Int64Value(g.DesiredCapacity) - int64(len(instances))
+		if desired < aws.Int64Value(g.MinSize) {
+			_, err = asgClient.UpdateAutoScalingGroupWithContext(ctx, &autoscaling.UpdateAutoScalingGroupInput{
+				AutoScalingGroupName: g.AutoScalingGroupName,
+				MinSize:              aws.Int64(desired),
+			})
+			if err != nil {
+				return err
+			}
+		}
+		for _, id := range instances {
+			_, err = asgClient.TerminateInstanceInAutoScalingGroupWithContext(ctx, &autoscaling.TerminateInstanceInAutoScalingGroupInput{
+				InstanceId:                     id,
+				ShouldDecrementDesiredCapacity: aws.Bool(true),
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+/*
+Copyright 2021 The UnDistro authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package aws
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/autoscaling"
+	"github.com/aws/aws-sdk-go/service/autoscaling/autoscalingiface"
+	. "github.com/onsi/gomega"
+)
+
+type fakeAutoScaling struct {
+	autoscalingiface.AutoScalingAPI
+	states     map[string]string
+	minSize    int64
+	desired    int64
+	terminated []string
+}
+
+func (f *fakeAutoScaling) DescribeAutoScalingInstancesWithContext(_ aws.Context, in *autoscaling.DescribeAutoScalingInstancesInput, _ ...request.Option) (*autoscaling.DescribeAutoScalingInstancesOutput, error) {
+	out := &autoscaling.DescribeAutoScalingInstancesOutput{}
+	for _, id := range in.InstanceIds {
+		state, ok := f.states[aws.StringValue(id)]
+		if !ok {
+			continue
+		}
+		out.AutoScalingInstances = append(out.AutoScalingInstances, &autoscaling.InstanceDetails{
+			InstanceId:           id,
+			AutoScalingGroupName: aws.String("pool"),
+			LifecycleState:       aws.String(state),
+		})
+	}
+	return out, nil
+}
+
+func (f *fakeAutoScaling) DescribeAutoScalingGroupsWithContext(_ aws.Context, in *autoscaling.DescribeAutoScalingGroupsInput, _ ...request.Option) (*autoscaling.DescribeAutoScalingGroupsOutput, error) {
+	if len(in.AutoScalingGroupNames) > 0 && aws.StringValue(in.AutoScalingGroupNames[0]) != "pool" {
+		return &autoscaling.DescribeAutoScalingGroupsOutput{}, nil
+	}
+	return &autoscaling.DescribeAutoScalingGroupsOutput{
+		AutoScalingGroups: []*autoscaling.Group{{
+			AutoScalingGroupName: aws.String("pool"),
+			MinSize:              aws.Int64(f.minSize),
+			DesiredCapacity:      aws.Int64(f.desired),
+		}},
+	}, nil
+}
+
+func (f *fakeAutoScaling) UpdateAutoScalingGroupWithContext(_ aws.Context, in *autoscaling.UpdateAutoScalingGroupInput, _ ...request.Option) (*autoscaling.UpdateAutoScalingGroupOutput, error) {
+	f.minSize = aws.Int64Value(in.MinSize)
+	return &autoscaling.UpdateAutoScalingGroupOutput{}, nil
+}
+
+func (f *fakeAutoScaling) TerminateInstanceInAutoScalingGroupWithContext(_ aws.Context, in *autoscaling.TerminateInstanceInAutoScalingGroupInput, _ ...request.Option) (*autoscaling.TerminateInstanceInAutoScalingGroupOutput, error) {
+	if aws.BoolValue(in.ShouldDecrementDesiredCapacity) {
+		f.desired--
+	}
+	f.terminated = append(f.terminated, aws.StringValue(in.InstanceId))
+	return &autoscaling.TerminateInstanceInAutoScalingGroupOutput{}, nil
+}
+
+func TestTerminateInstances(t *testing.T) {
+	g := NewWithT(t)
+	asgClient := &fakeAutoScaling{
+		states: map[string]string{
+			"i-0a": autoscaling.LifecycleStateInService,
+			"i-0b": autoscaling.LifecycleStateTerminatingWait,
+			"i-0c": autoscaling.LifecycleStateInService,
+		},
+		minSize: 3,
+		desired: 3,
+	}
+	err := terminateInstances(context.Background(), asgClient, []string{
+		"aws:///us-east-1a/i-0a",
+		"aws:///us-east-1a/i-0b",
+		"aws:///us-east-1b/i-0c",
+		"aws:///us-east-1b/i-0d",
+	}, true)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(asgClient.terminated).To(ConsistOf("i-0a", "i-0c"))
+	g.Expect(asgClient.minSize).To(Equal(int64(1)))
+	g.Expect(asgClient.desired).To(Equal(int64(1)))
+}
+
+func TestTerminateInstancesReplacing(t *testing.T) {
+	g := NewWithT(t)
+	asgClient := &fakeAutoScaling{
+		states: map[string]string{
+			"i-0a": autoscaling.LifecycleStateInService,
+			"i-0b": autoscaling.LifecycleStateTerminating,
+		},
+		minSize: 2,
+		desired: 2,
+	}
+	err := terminateInstances(context.Background(), asgClient, []string{
+		"aws:///us-east-1a/i-0a",
+		"aws:///us-east-1a/i-0b",
+	}, false)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(asgClient.terminated).To(ConsistOf("i-0a"))
+	g.Expect(asgClient.minSize).To(Equal(int64(2)))
+	g.Expect(asgClient.desired).To(Equal(int64(2)))
+}
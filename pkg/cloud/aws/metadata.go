@@ -25,7 +25,6 @@ import (
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/ec2"
 	undistrov1alpha1 "github.com/getupio-undistro/undistro/apis/app/v1alpha1"
-	undistroaws "github.com/getupio-undistro/undistro/pkg/cloud/aws"
 	"github.com/getupio-undistro/undistro/pkg/scheme"
 	"k8s.io/apimachinery/pkg/util/json"
 	"k8s.io/client-go/rest"
@@ -137,7 +136,7 @@ func describeSSHKeys(region string, restConf *rest.Config) (res []string, err er
 	if err != nil {
 		return []string{}, errGetCredentials
 	}
-	creds, _, err := undistroaws.Credentials(context.Background(), k8sClient)
+	creds, _, err := Credentials(context.Background(), k8sClient)
 	if err != nil {
 		return []string{}, errGetCredentials
 	}
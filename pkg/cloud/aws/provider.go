@@ -0,0 +1,125 @@
+/*
+Copyright 2021 The UnDistro authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package aws
+
+import (
+	"context"
+
+	appv1alpha1 "github.com/getupio-undistro/undistro/apis/app/v1alpha1"
+	"github.com/getupio-undistro/undistro/pkg/cloud"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/client-go/rest"
+	capi "sigs.k8s.io/cluster-api/api/v1alpha3"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func init() {
+	cloud.Register(provider{})
+}
+
+// provider implements cloud.Provider for Amazon Web Services
+type provider struct{}
+
+func (provider) Name() string {
+	return appv1alpha1.Amazon.String()
+}
+
+func (provider) Flavors() []appv1alpha1.InfraFlavor {
+	return appv1alpha1.BuiltinFlavors(appv1alpha1.Amazon.String())
+}
+
+func (provider) CapacityTypes(ctx context.Context, c client.Client, cl *appv1alpha1.Cluster, providerIDs []string) (map[string]appv1alpha1.CapacityType, error) {
+	return CapacityTypes(ctx, c, cl, providerIDs)
+}
+
+func (provider) RemoveMachines(ctx context.Context, c client.Client, cl *appv1alpha1.Cluster, providerIDs []string) error {
+	return RemoveMachines(ctx, c, cl, providerIDs)
+}
+
+func (provider) ReplaceMachines(ctx context.Context, c client.Client, cl *appv1alpha1.Cluster, providerIDs []string) error {
+	return ReplaceMachines(ctx, c, cl, providerIDs)
+}
+
+func (provider) AutoscalerValues(ctx context.Context, c client.Client, cl *appv1alpha1.Cluster) (map[string]interface{}, error) {
+	return AutoscalerValues(ctx, c, cl)
+}
+
+func (provider) AutoscaledReplicas(ctx context.Context, c client.Client, cl *appv1alpha1.Cluster, name string) (int32, bool, error) {
+	return AutoscaledReplicas(ctx, c, cl, name)
+}
+
+func (provider) DefaultRegion() string {
+	return DefaultAWSRegion
+}
+
+func (provider) Init(ctx context.Context, c client.Client, cfg []appv1alpha1.ValuesReference, version string) ([]appv1alpha1.ValuesReference, error) {
+	return Init(ctx, c, cfg, version)
+}
+
+func (provider) Upgrade(ctx context.Context, c client.Client, cfg []appv1alpha1.ValuesReference, version string) ([]appv1alpha1.ValuesReference, error) {
+	return Upgrade(ctx, c, cfg, version)
+}
+
+func (provider) PostInstall(ctx context.Context, c client.Client) error {
+	return PostInstall(ctx, c)
+}
+
+func (provider) ReconcileNetwork(ctx context.Context, c client.Client, cl *appv1alpha1.Cluster, capiCluster *capi.Cluster) error {
+	return ReconcileNetwork(ctx, c, cl, capiCluster)
+}
+
+func (provider) ReconcileLaunchTemplate(ctx context.Context, c client.Client, cl *appv1alpha1.Cluster) error {
+	return ReconcileLaunchTemplate(ctx, c, cl)
+}
+
+func (provider) GetAccount(ctx context.Context, c client.Client, cl *appv1alpha1.Cluster) (cloud.Account, error) {
+	acc, err := NewAccount(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	return acc, nil
+}
+
+func (provider) CalicoValues(flavor string) map[string]interface{} {
+	return map[string]interface{}{
+		"vxlan": flavor == appv1alpha1.EKS.String(),
+	}
+}
+
+// CiliumValues chains Cilium to the AWS VPC CNI in EKS, so it just enforces network policies
+func (provider) CiliumValues(flavor string) map[string]interface{} {
+	if flavor != appv1alpha1.EKS.String() {
+		return nil
+	}
+	return map[string]interface{}{
+		"cni": map[string]interface{}{
+			"chainingMode": "aws-cni",
+		},
+		"enableIPv4Masquerade": false,
+		"tunnel":               "disabled",
+		"endpointRoutes": map[string]interface{}{
+			"enabled": true,
+		},
+	}
+}
+
+func (provider) DescribeMetadata(config *rest.Config, region, meta string, page, itemsPerPage int) (interface{}, error) {
+	return DescribeMeta(config, region, meta, page, itemsPerPage)
+}
+
+func (provider) InstallTools(ctx context.Context, streams genericclioptions.IOStreams) error {
+	return InstallTools(ctx, streams)
+}
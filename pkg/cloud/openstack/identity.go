@@ -0,0 +1,224 @@
+/*
+Copyright 2021 The UnDistro authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package openstack
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	passwordMethod              = "password"
+	applicationCredentialMethod = "application_credential"
+	subjectTokenHeader          = "X-Subject-Token"
+)
+
+var errMissingAuthURL = errors.New("auth_url is required in clouds.yaml")
+
+type domain struct {
+	ID   string `json:"id,omitempty"`
+	Name string `json:"name,omitempty"`
+}
+
+type user struct {
+	ID       string  `json:"id,omitempty"`
+	Name     string  `json:"name,omitempty"`
+	Password string  `json:"password,omitempty"`
+	Domain   *domain `json:"domain,omitempty"`
+}
+
+type project struct {
+	ID     string  `json:"id,omitempty"`
+	Name   string  `json:"name,omitempty"`
+	Domain *domain `json:"domain,omitempty"`
+}
+
+type applicationCredential struct {
+	ID     string `json:"id,omitempty"`
+	Secret string `json:"secret,omitempty"`
+}
+
+type identity struct {
+	Methods               []string               `json:"methods"`
+	Password              *passwordIdentity      `json:"password,omitempty"`
+	ApplicationCredential *applicationCredential `json:"application_credential,omitempty"`
+}
+
+type passwordIdentity struct {
+	User user `json:"user"`
+}
+
+type scope struct {
+	Project *project `json:"project,omitempty"`
+}
+
+type authRequest struct {
+	Auth struct {
+		Identity identity `json:"identity"`
+		Scope    *scope   `json:"scope,omitempty"`
+	} `json:"auth"`
+}
+
+type role struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// token is the subset of a Keystone v3 token used by UnDistro
+type token struct {
+	ID        string    `json:"-"`
+	ExpiresAt time.Time `json:"expires_at"`
+	User      user      `json:"user"`
+	Project   project   `json:"project"`
+	Roles     []role    `json:"roles"`
+}
+
+type tokenResponse struct {
+	Token token `json:"token"`
+}
+
+// identityClient talks to the Keystone v3 API
+type identityClient struct {
+	httpClient *http.Client
+	authURL    string
+}
+
+func newIdentityClient(cloud Cloud, caCert []byte) (*identityClient, error) {
+	if cloud.Auth.AuthURL == "" {
+		return nil, errMissingAuthURL
+	}
+	tlsConfig := &tls.Config{}
+	if len(caCert) > 0 {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caCert) {
+			return nil, errors.New("unable to parse OpenStack CA certificate")
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if cloud.Verify != nil && !*cloud.Verify {
+		tlsConfig.InsecureSkipVerify = true
+	}
+	authURL := strings.TrimSuffix(cloud.Auth.AuthURL, "/")
+	if !strings.HasSuffix(authURL, "/v3") {
+		authURL = fmt.Sprintf("%s/v3", authURL)
+	}
+	return &identityClient{
+		httpClient: &http.Client{
+			Timeout: 30 * time.Second,
+			Transport: &http.Transport{
+				Proxy:           http.ProxyFromEnvironment,
+				TLSClientConfig: tlsConfig,
+			},
+		},
+		authURL: authURL,
+	}, nil
+}
+
+func newAuthRequest(a AuthInfo) authRequest {
+	req := authRequest{}
+	if a.ApplicationCredentialID != "" {
+		req.Auth.Identity = identity{
+			Methods: []string{applicationCredentialMethod},
+			ApplicationCredential: &applicationCredential{
+				ID:     a.ApplicationCredentialID,
+				Secret: a.ApplicationCredentialSecret,
+			},
+		}
+		return req
+	}
+	u := user{
+		ID:       a.UserID,
+		Name:     a.Username,
+		Password: a.Password,
+	}
+	if u.ID == "" {
+		u.Domain = newDomain(a.UserDomainID, a.UserDomainName, a.DomainID, a.DomainName)
+	}
+	req.Auth.Identity = identity{
+		Methods:  []string{passwordMethod},
+		Password: &passwordIdentity{User: u},
+	}
+	if a.ProjectID != "" || a.ProjectName != "" {
+		p := &project{
+			ID:   a.ProjectID,
+			Name: a.ProjectName,
+		}
+		if p.ID == "" {
+			p.Domain = newDomain(a.ProjectDomainID, a.ProjectDomainName, a.DomainID, a.DomainName)
+		}
+		req.Auth.Scope = &scope{Project: p}
+	}
+	return req
+}
+
+// newDomain returns the first domain set, falling back to the "Default" domain
+func newDomain(id, name, fallbackID, fallbackName string) *domain {
+	switch {
+	case id != "":
+		return &domain{ID: id}
+	case name != "":
+		return &domain{Name: name}
+	case fallbackID != "":
+		return &domain{ID: fallbackID}
+	case fallbackName != "":
+		return &domain{Name: fallbackName}
+	}
+	return &domain{ID: "default"}
+}
+
+// authenticate issues a scoped token using the credentials of the given cloud
+func (c *identityClient) authenticate(ctx context.Context, a AuthInfo) (*token, error) {
+	byt, err := json.Marshal(newAuthRequest(a))
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf("%s/auth/tokens", c.authURL), bytes.NewReader(byt))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusCreated {
+		return nil, errors.Errorf("unable to authenticate on %s: %s", c.authURL, http.StatusText(resp.StatusCode))
+	}
+	tr := tokenResponse{}
+	err = json.Unmarshal(body, &tr)
+	if err != nil {
+		return nil, err
+	}
+	tr.Token.ID = resp.Header.Get(subjectTokenHeader)
+	return &tr.Token, nil
+}
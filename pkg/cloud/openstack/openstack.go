@@ -0,0 +1,364 @@
+/*
+Copyright 2021 The UnDistro authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package openstack
+
+import (
+	"bytes"
+	"context"
+	"text/template"
+
+	appv1alpha1 "github.com/getupio-undistro/undistro/apis/app/v1alpha1"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	capi "sigs.k8s.io/cluster-api/api/v1alpha3"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	DefaultOpenStackRegion = "RegionOne"
+	DefaultCloudName       = "openstack"
+	name                   = "undistro-openstack-config"
+	namespace              = "undistro-system"
+	cloudsKey              = "clouds.yaml"
+	caCertKey              = "cacert"
+	caCertPath             = "/etc/certs/cacert"
+	adminRole              = "admin"
+	cloudConfigTemplate    = `[Global]
+auth-url={{ .AuthURL }}
+{{- if .ApplicationCredentialID }}
+application-credential-id={{ .ApplicationCredentialID }}
+application-credential-secret={{ .ApplicationCredentialSecret }}
+{{- else }}
+{{- if .UserID }}
+user-id={{ .UserID }}
+{{- else }}
+username={{ .Username }}
+{{- end }}
+password={{ .Password }}
+{{- if .ProjectID }}
+tenant-id={{ .ProjectID }}
+{{- else }}
+tenant-name={{ .ProjectName }}
+{{- end }}
+{{- if .UserDomainName }}
+domain-name={{ .UserDomainName }}
+{{- end }}
+{{- if .ProjectDomainName }}
+tenant-domain-name={{ .ProjectDomainName }}
+{{- end }}
+{{- end }}
+region={{ .Region }}
+{{- if .CAFile }}
+ca-file={{ .CAFile }}
+{{- end }}
+
+[LoadBalancer]
+use-octavia=true
+`
+)
+
+// Clouds is the content of a clouds.yaml file
+type Clouds struct {
+	Clouds map[string]Cloud `json:"clouds"`
+}
+
+type Cloud struct {
+	Auth               AuthInfo `json:"auth"`
+	AuthType           string   `json:"auth_type,omitempty"`
+	RegionName         string   `json:"region_name,omitempty"`
+	Interface          string   `json:"interface,omitempty"`
+	IdentityAPIVersion string   `json:"identity_api_version,omitempty"`
+	Verify             *bool    `json:"verify,omitempty"`
+}
+
+type AuthInfo struct {
+	AuthURL                     string `json:"auth_url"`
+	Username                    string `json:"username,omitempty"`
+	UserID                      string `json:"user_id,omitempty"`
+	Password                    string `json:"password,omitempty"`
+	ProjectName                 string `json:"project_name,omitempty"`
+	ProjectID                   string `json:"project_id,omitempty"`
+	UserDomainName              string `json:"user_domain_name,omitempty"`
+	UserDomainID                string `json:"user_domain_id,omitempty"`
+	ProjectDomainName           string `json:"project_domain_name,omitempty"`
+	ProjectDomainID             string `json:"project_domain_id,omitempty"`
+	DomainName                  string `json:"domain_name,omitempty"`
+	DomainID                    string `json:"domain_id,omitempty"`
+	ApplicationCredentialID     string `json:"application_credential_id,omitempty"`
+	ApplicationCredentialSecret string `json:"application_credential_secret,omitempty"`
+}
+
+// OpenStackCredentials holds the clouds.yaml stored in the provider secret
+type OpenStackCredentials struct {
+	Clouds Clouds
+	Raw    []byte
+	CACert []byte
+}
+
+// Cloud returns the named cloud. When the file has a single cloud it's used regardless of name.
+func (c OpenStackCredentials) Cloud(cloudName string) (Cloud, error) {
+	if cloudName == "" {
+		cloudName = DefaultCloudName
+	}
+	cloud, ok := c.Clouds.Clouds[cloudName]
+	if ok {
+		return cloud, nil
+	}
+	if len(c.Clouds.Clouds) == 1 {
+		for _, cloud := range c.Clouds.Clouds {
+			return cloud, nil
+		}
+	}
+	return Cloud{}, errors.Errorf("cloud %s not found in %s", cloudName, cloudsKey)
+}
+
+func Credentials(ctx context.Context, c client.Client) (OpenStackCredentials, *corev1.Secret, error) {
+	secret := corev1.Secret{}
+	nm := client.ObjectKey{
+		Name:      name,
+		Namespace: namespace,
+	}
+	err := c.Get(ctx, nm, &secret)
+	if err != nil {
+		return OpenStackCredentials{}, nil, err
+	}
+	cred, err := credentialsFromSecret(&secret)
+	if err != nil {
+		return OpenStackCredentials{}, nil, err
+	}
+	return cred, &secret, nil
+}
+
+func credentialsFromSecret(s *corev1.Secret) (OpenStackCredentials, error) {
+	raw, ok := s.Data[cloudsKey]
+	if !ok || len(raw) == 0 {
+		return OpenStackCredentials{}, errors.Errorf("missing key %q in secret %s/%s", cloudsKey, s.Namespace, s.Name)
+	}
+	cred := OpenStackCredentials{
+		Raw:    raw,
+		CACert: s.Data[caCertKey],
+	}
+	err := yaml.Unmarshal(raw, &cred.Clouds)
+	if err != nil {
+		return OpenStackCredentials{}, errors.Wrapf(err, "unable to parse %s", cloudsKey)
+	}
+	if len(cred.Clouds.Clouds) == 0 {
+		return OpenStackCredentials{}, errors.Errorf("no clouds found in %s", cloudsKey)
+	}
+	return cred, nil
+}
+
+// Init providers
+func Init(ctx context.Context, c client.Client, cfg []appv1alpha1.ValuesReference, version string) ([]appv1alpha1.ValuesReference, error) {
+	err := verifyCredentials(ctx, c)
+	if err != nil {
+		return cfg, err
+	}
+	return cfg, nil
+}
+
+// Upgrade providers
+func Upgrade(ctx context.Context, c client.Client, cfg []appv1alpha1.ValuesReference, version string) ([]appv1alpha1.ValuesReference, error) {
+	err := verifyCredentials(ctx, c)
+	if err != nil {
+		return cfg, err
+	}
+	return cfg, nil
+}
+
+// verifyCredentials authenticates on every cloud of clouds.yaml to fail fast on bad credentials
+func verifyCredentials(ctx context.Context, c client.Client) error {
+	cred, _, err := Credentials(ctx, c)
+	if err != nil {
+		return err
+	}
+	for cloudName, cloud := range cred.Clouds.Clouds {
+		ic, err := newIdentityClient(cloud, cred.CACert)
+		if err != nil {
+			return errors.Wrapf(err, "cloud %s", cloudName)
+		}
+		_, err = ic.authenticate(ctx, cloud.Auth)
+		if err != nil {
+			return errors.Wrapf(err, "cloud %s", cloudName)
+		}
+	}
+	return nil
+}
+
+func ReconcileNetwork(ctx context.Context, r client.Client, cl *appv1alpha1.Cluster, capiCluster *capi.Cluster) error {
+	u := unstructured.Unstructured{}
+	u.SetGroupVersionKind(capiCluster.Spec.InfrastructureRef.GroupVersionKind())
+	key := client.ObjectKey{
+		Name:      capiCluster.Spec.InfrastructureRef.Name,
+		Namespace: capiCluster.Spec.InfrastructureRef.Namespace,
+	}
+	err := r.Get(ctx, key, &u)
+	if err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	return clusterNetwork(cl, u)
+}
+
+func clusterNetwork(cl *appv1alpha1.Cluster, u unstructured.Unstructured) error {
+	host, ok, err := unstructured.NestedString(u.Object, "spec", "controlPlaneEndpoint", "host")
+	if err != nil {
+		return err
+	}
+	if ok && host != "" {
+		cl.Spec.ControlPlane.Endpoint.Host = host
+	}
+	port, ok, err := unstructured.NestedInt64(u.Object, "spec", "controlPlaneEndpoint", "port")
+	if err != nil {
+		return err
+	}
+	if ok && port != 0 {
+		cl.Spec.ControlPlane.Endpoint.Port = int32(port)
+	}
+	id, ok, err := unstructured.NestedString(u.Object, "status", "network", "id")
+	if err != nil {
+		return err
+	}
+	// the CIDR is never copied back: when set it tells the template
+	// that the network is managed by UnDistro instead of an existing one
+	if ok && id != "" && cl.Spec.Network.VPC.ID == "" {
+		cl.Spec.Network.VPC.ID = id
+	}
+	subnetID, ok, err := unstructured.NestedString(u.Object, "status", "network", "subnet", "id")
+	if err != nil {
+		return err
+	}
+	if ok && subnetID != "" {
+		cidr, _, err := unstructured.NestedString(u.Object, "status", "network", "subnet", "cidr")
+		if err != nil {
+			return err
+		}
+		n := appv1alpha1.NetworkSpec{
+			ID:        subnetID,
+			CIDRBlock: cidr,
+		}
+		for _, s := range cl.Spec.Network.Subnets {
+			if s == n {
+				return nil
+			}
+		}
+		cl.Spec.Network.Subnets = append(cl.Spec.Network.Subnets, n)
+	}
+	return nil
+}
+
+func cloudName(cl *appv1alpha1.Cluster) string {
+	if cl.Spec.InfrastructureProvider.OpenStack == nil {
+		return DefaultCloudName
+	}
+	return cl.Spec.InfrastructureProvider.OpenStack.CloudName
+}
+
+// Account is the identity UnDistro uses on OpenStack.
+// It also exposes the cloud configuration rendered in cluster templates.
+type Account struct {
+	token  *token
+	cloud  Cloud
+	region string
+	cred   OpenStackCredentials
+}
+
+func NewAccount(ctx context.Context, c client.Client, cl *appv1alpha1.Cluster) (*Account, error) {
+	cred, _, err := Credentials(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	cloud, err := cred.Cloud(cloudName(cl))
+	if err != nil {
+		return nil, err
+	}
+	ic, err := newIdentityClient(cloud, cred.CACert)
+	if err != nil {
+		return nil, err
+	}
+	t, err := ic.authenticate(ctx, cloud.Auth)
+	if err != nil {
+		return nil, err
+	}
+	region := cl.Spec.InfrastructureProvider.Region
+	if region == "" {
+		region = cloud.RegionName
+	}
+	return &Account{
+		token:  t,
+		cloud:  cloud,
+		region: region,
+		cred:   cred,
+	}, nil
+}
+
+func (a *Account) GetID() string {
+	return a.token.Project.ID
+}
+
+func (a *Account) GetUsername() string {
+	return a.token.User.Name
+}
+
+func (a *Account) IsRoot() bool {
+	for _, r := range a.token.Roles {
+		if r.Name == adminRole {
+			return true
+		}
+	}
+	return false
+}
+
+// CloudsYAML returns the clouds.yaml consumed by the infrastructure provider
+func (a *Account) CloudsYAML() string {
+	return string(a.cred.Raw)
+}
+
+// CACert returns the CA certificate of the OpenStack API, if any
+func (a *Account) CACert() string {
+	return string(a.cred.CACert)
+}
+
+// CACertPath is where the CA certificate is written in the machines
+func (a *Account) CACertPath() string {
+	return caCertPath
+}
+
+// CloudConfig returns the cloud.conf used by the Kubernetes OpenStack cloud provider
+func (a *Account) CloudConfig() (string, error) {
+	tmpl, err := template.New("OpenStack cloud config").Parse(cloudConfigTemplate)
+	if err != nil {
+		return "", err
+	}
+	data := struct {
+		AuthInfo
+		Region string
+		CAFile string
+	}{
+		AuthInfo: a.cloud.Auth,
+		Region:   a.region,
+	}
+	if len(a.cred.CACert) > 0 {
+		data.CAFile = caCertPath
+	}
+	var buff bytes.Buffer
+	err = tmpl.Execute(&buff, data)
+	if err != nil {
+		return "", err
+	}
+	return buff.String(), nil
+}
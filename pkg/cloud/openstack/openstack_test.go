@@ -0,0 +1,219 @@
+/*
+Copyright 2021 The UnDistro authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package openstack
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	appv1alpha1 "github.com/getupio-undistro/undistro/apis/app/v1alpha1"
+	"github.com/getupio-undistro/undistro/pkg/scheme"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// newKeystone stubs the Keystone v3 token API accepting only the given password
+func newKeystone(password string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/v3/auth/tokens" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		req := authRequest{}
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		id := req.Auth.Identity
+		switch {
+		case id.Password != nil && id.Password.User.Password == password:
+		case id.ApplicationCredential != nil && id.ApplicationCredential.Secret == password:
+		default:
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set(subjectTokenHeader, "gAAAAABg")
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, `{"token": {
+			"expires_at": "2021-07-01T00:00:00.000000Z",
+			"user": {"id": "u1", "name": "undistro"},
+			"project": {"id": "p1", "name": "undistro"},
+			"roles": [{"id": "r1", "name": "member"}, {"id": "r2", "name": "admin"}]
+		}}`)
+	}))
+}
+
+func cloudsSecret(authURL, password string) *corev1.Secret {
+	clouds := fmt.Sprintf(`clouds:
+  openstack:
+    auth:
+      auth_url: %s
+      username: undistro
+      password: %s
+      project_name: undistro
+      user_domain_name: Default
+      project_domain_name: Default
+    region_name: RegionOne
+`, authURL, password)
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+		},
+		Data: map[string][]byte{
+			cloudsKey: []byte(clouds),
+		},
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	ks := newKeystone("secret")
+	defer ks.Close()
+	testCases := []struct {
+		name    string
+		auth    AuthInfo
+		wantErr bool
+	}{
+		{
+			name: "password",
+			auth: AuthInfo{
+				AuthURL:     ks.URL,
+				Username:    "undistro",
+				Password:    "secret",
+				ProjectName: "undistro",
+			},
+		},
+		{
+			name: "password with versioned url",
+			auth: AuthInfo{
+				AuthURL:  ks.URL + "/v3/",
+				UserID:   "u1",
+				Password: "secret",
+			},
+		},
+		{
+			name: "application credential",
+			auth: AuthInfo{
+				AuthURL:                     ks.URL,
+				ApplicationCredentialID:     "ac1",
+				ApplicationCredentialSecret: "secret",
+			},
+		},
+		{
+			name: "wrong password",
+			auth: AuthInfo{
+				AuthURL:  ks.URL,
+				Username: "undistro",
+				Password: "wrong",
+			},
+			wantErr: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			ic, err := newIdentityClient(Cloud{Auth: tc.auth}, nil)
+			g.Expect(err).ToNot(HaveOccurred())
+			tk, err := ic.authenticate(context.Background(), tc.auth)
+			if tc.wantErr {
+				g.Expect(err).To(HaveOccurred())
+				return
+			}
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(tk.ID).To(Equal("gAAAAABg"))
+			g.Expect(tk.Project.ID).To(Equal("p1"))
+		})
+	}
+}
+
+func TestNewAccount(t *testing.T) {
+	g := NewWithT(t)
+	ks := newKeystone("secret")
+	defer ks.Close()
+	c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(cloudsSecret(ks.URL, "secret")).Build()
+	cl := &appv1alpha1.Cluster{
+		Spec: appv1alpha1.ClusterSpec{
+			InfrastructureProvider: appv1alpha1.InfrastructureProvider{
+				Name:      appv1alpha1.OpenStack.String(),
+				OpenStack: &appv1alpha1.OpenStackConfig{CloudName: "openstack"},
+			},
+		},
+	}
+	acc, err := NewAccount(context.Background(), c, cl)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(acc.GetID()).To(Equal("p1"))
+	g.Expect(acc.GetUsername()).To(Equal("undistro"))
+	g.Expect(acc.IsRoot()).To(BeTrue())
+	conf, err := acc.CloudConfig()
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(conf).To(ContainSubstring("auth-url=" + ks.URL))
+	g.Expect(conf).To(ContainSubstring("tenant-name=undistro"))
+	g.Expect(conf).To(ContainSubstring("region=RegionOne"))
+	g.Expect(conf).ToNot(ContainSubstring("ca-file"))
+
+	g.Expect(Init(context.Background(), c, nil, "")).To(BeEmpty())
+
+	bad := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(cloudsSecret(ks.URL, "wrong")).Build()
+	_, err = NewAccount(context.Background(), bad, cl)
+	g.Expect(err).To(HaveOccurred())
+	_, err = Init(context.Background(), bad, nil, "")
+	g.Expect(err).To(HaveOccurred())
+}
+
+func TestClusterNetwork(t *testing.T) {
+	g := NewWithT(t)
+	u := unstructured.Unstructured{Object: map[string]interface{}{
+		"spec": map[string]interface{}{
+			"controlPlaneEndpoint": map[string]interface{}{
+				"host": "10.0.0.10",
+				"port": int64(6443),
+			},
+		},
+		"status": map[string]interface{}{
+			"network": map[string]interface{}{
+				"id": "net-1",
+				"subnet": map[string]interface{}{
+					"id":   "subnet-1",
+					"cidr": "10.6.0.0/24",
+					"tags": []interface{}{"undistro"},
+				},
+			},
+		},
+	}}
+	cl := &appv1alpha1.Cluster{
+		Spec: appv1alpha1.ClusterSpec{
+			ControlPlane: &appv1alpha1.ControlPlaneNode{},
+			Network: appv1alpha1.Network{
+				VPC: appv1alpha1.NetworkSpec{CIDRBlock: "10.6.0.0/24"},
+			},
+		},
+	}
+	g.Expect(clusterNetwork(cl, u)).To(Succeed())
+	g.Expect(clusterNetwork(cl, u)).To(Succeed())
+	g.Expect(cl.Spec.ControlPlane.Endpoint.Host).To(Equal("10.0.0.10"))
+	g.Expect(cl.Spec.ControlPlane.Endpoint.Port).To(Equal(int32(6443)))
+	g.Expect(cl.Spec.Network.VPC.ID).To(Equal("net-1"))
+	g.Expect(cl.Spec.Network.VPC.CIDRBlock).To(Equal("10.6.0.0/24"))
+	g.Expect(cl.Spec.Network.Subnets).To(Equal([]appv1alpha1.NetworkSpec{{ID: "subnet-1", CIDRBlock: "10.6.0.0/24"}}))
+}
@@ -0,0 +1,107 @@
+/*
+Copyright 2021 The UnDistro authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package openstack
+
+import (
+	"context"
+
+	appv1alpha1 "github.com/getupio-undistro/undistro/apis/app/v1alpha1"
+	"github.com/getupio-undistro/undistro/pkg/cloud"
+	"github.com/pkg/errors"
+	"k8s.io/client-go/rest"
+	capi "sigs.k8s.io/cluster-api/api/v1alpha3"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func init() {
+	cloud.Register(provider{})
+}
+
+// ErrNoProviderMeta is returned when the requested metadata is unknown
+var ErrNoProviderMeta = errors.New("meta is required. supported are ['supportedFlavors']")
+
+type metaParam string
+
+const SupportedFlavorsMeta = metaParam("supportedFlavors")
+
+type flavor struct {
+	Name               string   `json:"name"`
+	KubernetesVersions []string `json:"kubernetesVersion"`
+}
+
+var flavors = []flavor{
+	{
+		Name: appv1alpha1.Kubeadm.String(),
+		KubernetesVersions: []string{
+			"v1.18.19", "v1.18.20", "v1.21.2", "v1.19.12", "v1.20.8",
+		},
+	},
+}
+
+// provider implements cloud.Provider for OpenStack
+type provider struct{}
+
+func (provider) Name() string {
+	return appv1alpha1.OpenStack.String()
+}
+
+func (provider) Flavors() []appv1alpha1.InfraFlavor {
+	return appv1alpha1.BuiltinFlavors(appv1alpha1.OpenStack.String())
+}
+
+func (provider) DefaultRegion() string {
+	return DefaultOpenStackRegion
+}
+
+func (provider) Init(ctx context.Context, c client.Client, cfg []appv1alpha1.ValuesReference, version string) ([]appv1alpha1.ValuesReference, error) {
+	return Init(ctx, c, cfg, version)
+}
+
+func (provider) Upgrade(ctx context.Context, c client.Client, cfg []appv1alpha1.ValuesReference, version string) ([]appv1alpha1.ValuesReference, error) {
+	return Upgrade(ctx, c, cfg, version)
+}
+
+func (provider) PostInstall(ctx context.Context, c client.Client) error {
+	return nil
+}
+
+func (provider) ReconcileNetwork(ctx context.Context, c client.Client, cl *appv1alpha1.Cluster, capiCluster *capi.Cluster) error {
+	return ReconcileNetwork(ctx, c, cl, capiCluster)
+}
+
+func (provider) ReconcileLaunchTemplate(ctx context.Context, c client.Client, cl *appv1alpha1.Cluster) error {
+	return nil
+}
+
+func (provider) GetAccount(ctx context.Context, c client.Client, cl *appv1alpha1.Cluster) (cloud.Account, error) {
+	acc, err := NewAccount(ctx, c, cl)
+	if err != nil {
+		return nil, err
+	}
+	return acc, nil
+}
+
+func (provider) CalicoValues(flavor string) map[string]interface{} {
+	return nil
+}
+
+func (provider) DescribeMetadata(config *rest.Config, region, meta string, page, itemsPerPage int) (interface{}, error) {
+	switch meta {
+	case string(SupportedFlavorsMeta):
+		return flavors, nil
+	}
+	return nil, ErrNoProviderMeta
+}
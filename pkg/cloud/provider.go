@@ -0,0 +1,142 @@
+/*
+Copyright 2021 The UnDistro authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cloud
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+
+	appv1alpha1 "github.com/getupio-undistro/undistro/apis/app/v1alpha1"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/client-go/rest"
+	capi "sigs.k8s.io/cluster-api/api/v1alpha3"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// chartPrefix is the prefix of the Helm chart name of infrastructure providers
+const chartPrefix = "undistro-"
+
+// Provider is an infrastructure provider supported by UnDistro.
+// Implementations register themselves using Register, usually in an init function.
+type Provider interface {
+	// Name is the value of spec.infrastructureProvider.name handled by the provider
+	Name() string
+	// Flavors supported by the provider
+	Flavors() []appv1alpha1.InfraFlavor
+	DefaultRegion() string
+	// Init is called before the provider chart is installed
+	Init(ctx context.Context, c client.Client, cfg []appv1alpha1.ValuesReference, version string) ([]appv1alpha1.ValuesReference, error)
+	// Upgrade is called before the provider chart is upgraded
+	Upgrade(ctx context.Context, c client.Client, cfg []appv1alpha1.ValuesReference, version string) ([]appv1alpha1.ValuesReference, error)
+	// PostInstall is called after the provider chart is installed
+	PostInstall(ctx context.Context, c client.Client) error
+	ReconcileNetwork(ctx context.Context, c client.Client, cl *appv1alpha1.Cluster, capiCluster *capi.Cluster) error
+	ReconcileLaunchTemplate(ctx context.Context, c client.Client, cl *appv1alpha1.Cluster) error
+	GetAccount(ctx context.Context, c client.Client, cl *appv1alpha1.Cluster) (Account, error)
+	// CalicoValues returns the Helm values of Calico for the given flavor
+	CalicoValues(flavor string) map[string]interface{}
+	// DescribeMetadata returns the metadata used by the UnDistro API server, like regions and machine types
+	DescribeMetadata(config *rest.Config, region, meta string, page, itemsPerPage int) (interface{}, error)
+}
+
+// ToolsInstaller is implemented by providers that need tools installed in the user machine
+type ToolsInstaller interface {
+	InstallTools(ctx context.Context, streams genericclioptions.IOStreams) error
+}
+
+// CiliumValuer is implemented by providers that need Cilium configured for their network, like EKS VPC CNI chaining
+type CiliumValuer interface {
+	// CiliumValues returns the Helm values of Cilium for the given flavor
+	CiliumValues(flavor string) map[string]interface{}
+}
+
+// CapacityTyper is implemented by providers that sell spare capacity, like AWS spot instances
+type CapacityTyper interface {
+	// CapacityTypes returns the capacity type of the machines by provider ID
+	CapacityTypes(ctx context.Context, c client.Client, cl *appv1alpha1.Cluster, providerIDs []string) (map[string]appv1alpha1.CapacityType, error)
+}
+
+// MachineRemover is implemented by providers that can remove chosen machines of a machine pool.
+// Otherwise the machines removed when the pool is shrunk are chosen by the infrastructure.
+type MachineRemover interface {
+	// RemoveMachines deletes the machines with the given provider IDs decreasing the pool size
+	RemoveMachines(ctx context.Context, c client.Client, cl *appv1alpha1.Cluster, providerIDs []string) error
+}
+
+// MachineReplacer is implemented by providers that can replace chosen machines of a machine pool.
+// Machine pools have no machines to be remediated by machine health checks.
+type MachineReplacer interface {
+	// ReplaceMachines deletes the machines with the given provider IDs keeping the pool size
+	ReplaceMachines(ctx context.Context, c client.Client, cl *appv1alpha1.Cluster, providerIDs []string) error
+}
+
+// MachinePoolAutoscaler is implemented by providers whose machine pools are scaled by the
+// cloud provider of cluster-autoscaler, as its clusterapi provider only scales machine deployments
+type MachinePoolAutoscaler interface {
+	// AutoscalerValues returns the Helm values of cluster-autoscaler for the machine pools of the cluster.
+	// It runs in the workload cluster, so it must reach the cloud without the credentials of UnDistro.
+	AutoscalerValues(ctx context.Context, c client.Client, cl *appv1alpha1.Cluster) (map[string]interface{}, error)
+	// AutoscaledReplicas returns the size set by cluster-autoscaler in the machine pool
+	// and false when it wasn't created yet
+	AutoscaledReplicas(ctx context.Context, c client.Client, cl *appv1alpha1.Cluster, name string) (int32, bool, error)
+}
+
+var (
+	providersMu sync.RWMutex
+	providers   = make(map[string]Provider)
+)
+
+// Register makes an infrastructure provider available by its name.
+// It panics if a provider with the same name is already registered.
+func Register(p Provider) {
+	providersMu.Lock()
+	defer providersMu.Unlock()
+	if _, dup := providers[p.Name()]; dup {
+		panic("cloud: Register called twice for provider " + p.Name())
+	}
+	providers[p.Name()] = p
+	appv1alpha1.RegisterFlavors(p.Name(), p.Flavors())
+}
+
+// Get returns the provider registered with the given name
+func Get(name string) (Provider, bool) {
+	providersMu.RLock()
+	defer providersMu.RUnlock()
+	p, ok := providers[name]
+	return p, ok
+}
+
+// Providers returns the sorted names of the registered providers
+func Providers() []string {
+	providersMu.RLock()
+	defer providersMu.RUnlock()
+	names := make([]string, 0, len(providers))
+	for name := range providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// fromChart returns the provider installed by a chart like undistro-aws
+func fromChart(chartName string) (Provider, bool) {
+	if !strings.HasPrefix(chartName, chartPrefix) {
+		return nil, false
+	}
+	return Get(strings.TrimPrefix(chartName, chartPrefix))
+}
@@ -0,0 +1,125 @@
+/*
+Copyright 2021 The UnDistro authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cloud
+
+import (
+	"context"
+	"testing"
+
+	appv1alpha1 "github.com/getupio-undistro/undistro/apis/app/v1alpha1"
+	configv1alpha1 "github.com/getupio-undistro/undistro/apis/config/v1alpha1"
+	. "github.com/onsi/gomega"
+	"k8s.io/client-go/rest"
+	capi "sigs.k8s.io/cluster-api/api/v1alpha3"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+type fakeProvider struct {
+	initCalled bool
+}
+
+func (*fakeProvider) Name() string {
+	return "fake"
+}
+
+func (*fakeProvider) Flavors() []appv1alpha1.InfraFlavor {
+	return []appv1alpha1.InfraFlavor{
+		{Name: "self"},
+		{Name: "managed", Managed: true},
+	}
+}
+
+func (*fakeProvider) DefaultRegion() string {
+	return "fake-1"
+}
+
+func (p *fakeProvider) Init(ctx context.Context, c client.Client, cfg []appv1alpha1.ValuesReference, version string) ([]appv1alpha1.ValuesReference, error) {
+	p.initCalled = true
+	return append(cfg, appv1alpha1.ValuesReference{Name: "fake-config"}), nil
+}
+
+func (*fakeProvider) Upgrade(ctx context.Context, c client.Client, cfg []appv1alpha1.ValuesReference, version string) ([]appv1alpha1.ValuesReference, error) {
+	return cfg, nil
+}
+
+func (*fakeProvider) PostInstall(ctx context.Context, c client.Client) error {
+	return nil
+}
+
+func (*fakeProvider) ReconcileNetwork(ctx context.Context, c client.Client, cl *appv1alpha1.Cluster, capiCluster *capi.Cluster) error {
+	return nil
+}
+
+func (*fakeProvider) ReconcileLaunchTemplate(ctx context.Context, c client.Client, cl *appv1alpha1.Cluster) error {
+	return nil
+}
+
+func (*fakeProvider) GetAccount(ctx context.Context, c client.Client, cl *appv1alpha1.Cluster) (Account, error) {
+	return nil, nil
+}
+
+func (*fakeProvider) CalicoValues(flavor string) map[string]interface{} {
+	return map[string]interface{}{
+		"vxlan": flavor == "managed",
+	}
+}
+
+func (*fakeProvider) DescribeMetadata(config *rest.Config, region, meta string, page, itemsPerPage int) (interface{}, error) {
+	return nil, nil
+}
+
+func TestRegistry(t *testing.T) {
+	g := NewWithT(t)
+	p := &fakeProvider{}
+	Register(p)
+	g.Expect(func() { Register(p) }).To(Panic())
+	g.Expect(Providers()).To(ContainElement("fake"))
+	g.Expect(DefaultRegion("fake")).To(Equal("fake-1"))
+	g.Expect(DefaultRegion("unknown")).To(BeEmpty())
+
+	infra := appv1alpha1.InfrastructureProvider{Name: "fake", Flavor: "managed"}
+	g.Expect(infra.Flavors()).To(Equal([]string{"self", "managed"}))
+	g.Expect(infra.IsManaged()).To(BeTrue())
+	infra.Flavor = "self"
+	g.Expect(infra.IsManaged()).To(BeFalse())
+	v, err := CalicoValues(infra)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(string(v)).To(Equal(`{"vxlan":false}`))
+	cl := &appv1alpha1.Cluster{}
+	cl.Spec.InfrastructureProvider = infra
+	v, err = CiliumValues(cl)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(string(v)).To(Equal(`{"ipam":{"operator":{"clusterPoolIPv4PodCIDR":"192.168.0.0/16"}}}`))
+	cl.Spec.Network.Pods = &capi.NetworkRanges{CIDRBlocks: []string{"10.244.0.0/16"}}
+	v, err = CiliumValues(cl)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(string(v)).To(Equal(`{"ipam":{"operator":{"clusterPoolIPv4PodCIDR":"10.244.0.0/16"}}}`))
+
+	unknown := appv1alpha1.InfrastructureProvider{Name: "unknown"}
+	g.Expect(unknown.Flavors()).To(BeEmpty())
+	g.Expect(unknown.IsManaged()).To(BeFalse())
+
+	pr := configv1alpha1.Provider{}
+	pr.Spec.ProviderName = "undistro"
+	pr, err = Init(context.Background(), nil, pr)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(p.initCalled).To(BeFalse())
+	pr.Spec.ProviderName = "undistro-fake"
+	pr, err = Init(context.Background(), nil, pr)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(p.initCalled).To(BeTrue())
+	g.Expect(pr.Spec.ConfigurationFrom).To(HaveLen(1))
+}
@@ -20,7 +20,7 @@ import (
 
 	appv1alpha1 "github.com/getupio-undistro/undistro/apis/app/v1alpha1"
 	configv1alpha1 "github.com/getupio-undistro/undistro/apis/config/v1alpha1"
-	"github.com/getupio-undistro/undistro/pkg/cloud/aws"
+	"github.com/getupio-undistro/undistro/pkg/util"
 	"k8s.io/apimachinery/pkg/util/json"
 	"k8s.io/cli-runtime/pkg/genericclioptions"
 	capi "sigs.k8s.io/cluster-api/api/v1alpha3"
@@ -41,92 +41,192 @@ func ReconcileNetwork(ctx context.Context, r client.Client, cl *appv1alpha1.Clus
 	if capiCluster.Spec.ClusterNetwork != nil {
 		cl.Spec.Network.ClusterNetwork = *capiCluster.Spec.ClusterNetwork
 	}
-	switch cl.Spec.InfrastructureProvider.Name {
-	case appv1alpha1.Amazon.String():
-		return aws.ReconcileNetwork(ctx, r, cl, capiCluster)
+	p, ok := Get(cl.Spec.InfrastructureProvider.Name)
+	if !ok {
+		return nil
 	}
-	return nil
+	return p.ReconcileNetwork(ctx, r, cl, capiCluster)
 }
 
 func PostInstall(ctx context.Context, c client.Client, p configv1alpha1.Provider) error {
-	switch p.Spec.ProviderName {
-	case "undistro-aws":
-		return aws.PostInstall(ctx, c)
+	infra, ok := fromChart(p.Spec.ProviderName)
+	if !ok {
+		return nil
 	}
-	return nil
+	return infra.PostInstall(ctx, c)
 }
 
 // ReconcileLaunchTemplate from clouds
 func ReconcileLaunchTemplate(ctx context.Context, r client.Client, cl *appv1alpha1.Cluster) error {
-	switch cl.Spec.InfrastructureProvider.Name {
-	case appv1alpha1.Amazon.String():
-		return aws.ReconcileLaunchTemplate(ctx, r, cl)
+	p, ok := Get(cl.Spec.InfrastructureProvider.Name)
+	if !ok {
+		return nil
 	}
-	return nil
+	return p.ReconcileLaunchTemplate(ctx, r, cl)
 }
 
-func CalicoValues(flavor string) ([]byte, error) {
-	values := make(map[string]interface{})
-	switch flavor {
-	case appv1alpha1.EKS.String():
-		values["vxlan"] = true
-	default:
-		values["vxlan"] = false
+func CalicoValues(infra appv1alpha1.InfrastructureProvider) ([]byte, error) {
+	values := map[string]interface{}{
+		"vxlan": false,
+	}
+	p, ok := Get(infra.Name)
+	if ok {
+		for k, v := range p.CalicoValues(infra.Flavor) {
+			values[k] = v
+		}
+	}
+	return json.Marshal(values)
+}
+
+// defaultPodCIDR is the pod network used when the cluster doesn't set one, the same of Calico
+const defaultPodCIDR = "192.168.0.0/16"
+
+func CiliumValues(cl *appv1alpha1.Cluster) ([]byte, error) {
+	podCIDR := defaultPodCIDR
+	if pods := cl.Spec.Network.Pods; pods != nil && len(pods.CIDRBlocks) > 0 {
+		podCIDR = pods.CIDRBlocks[0]
+	}
+	// the default pool of Cilium overlaps the networks created for clusters
+	values := map[string]interface{}{
+		"ipam": map[string]interface{}{
+			"operator": map[string]interface{}{
+				"clusterPoolIPv4PodCIDR": podCIDR,
+			},
+		},
+	}
+	p, ok := Get(cl.Spec.InfrastructureProvider.Name)
+	if ok {
+		if cv, ok := p.(CiliumValuer); ok {
+			values = util.MergeMaps(values, cv.CiliumValues(cl.Spec.InfrastructureProvider.Flavor))
+		}
 	}
 	return json.Marshal(values)
 }
 
 // Init providers
 func Init(ctx context.Context, c client.Client, p configv1alpha1.Provider) (configv1alpha1.Provider, error) {
+	infra, ok := fromChart(p.Spec.ProviderName)
+	if !ok {
+		return p, nil
+	}
 	var err error
-	switch p.Spec.ProviderName {
-	case "undistro-aws":
-		p.Spec.ConfigurationFrom, err = aws.Init(ctx, c, p.Spec.ConfigurationFrom, p.Spec.ProviderVersion)
-		if err != nil {
-			return p, err
-		}
+	p.Spec.ConfigurationFrom, err = infra.Init(ctx, c, p.Spec.ConfigurationFrom, p.Spec.ProviderVersion)
+	if err != nil {
+		return p, err
 	}
 	return p, nil
 }
 
 // Upgrade providers
 func Upgrade(ctx context.Context, c client.Client, p configv1alpha1.Provider) (configv1alpha1.Provider, error) {
+	infra, ok := fromChart(p.Spec.ProviderName)
+	if !ok {
+		return p, nil
+	}
 	var err error
-	switch p.Spec.ProviderName {
-	case "undistro-aws":
-		p.Spec.ConfigurationFrom, err = aws.Upgrade(ctx, c, p.Spec.ConfigurationFrom, p.Spec.ProviderVersion)
-		if err != nil {
-			return p, err
-		}
+	p.Spec.ConfigurationFrom, err = infra.Upgrade(ctx, c, p.Spec.ConfigurationFrom, p.Spec.ProviderVersion)
+	if err != nil {
+		return p, err
 	}
 	return p, nil
 }
 
 // InstallTools install required tools for provider
 func InstallTools(ctx context.Context, streams genericclioptions.IOStreams, providerName string) error {
-	var err error
-	switch providerName {
-	case "aws":
-		err = aws.InstallTools(ctx, streams)
-		if err != nil {
-			return err
-		}
+	p, ok := Get(providerName)
+	if !ok {
+		return nil
+	}
+	ti, ok := p.(ToolsInstaller)
+	if !ok {
+		return nil
+	}
+	return ti.InstallTools(ctx, streams)
+}
+
+// CapacityTypes returns the capacity type of the machines by provider ID.
+// It's empty when the provider has just on-demand machines.
+func CapacityTypes(ctx context.Context, c client.Client, cl *appv1alpha1.Cluster, providerIDs []string) (map[string]appv1alpha1.CapacityType, error) {
+	p, ok := Get(cl.Spec.InfrastructureProvider.Name)
+	if !ok {
+		return nil, nil
+	}
+	ct, ok := p.(CapacityTyper)
+	if !ok {
+		return nil, nil
+	}
+	return ct.CapacityTypes(ctx, c, cl, providerIDs)
+}
+
+// RemoveMachines deletes the machines of a machine pool when the provider supports it
+// and returns if they were removed
+func RemoveMachines(ctx context.Context, c client.Client, cl *appv1alpha1.Cluster, providerIDs []string) (bool, error) {
+	p, ok := Get(cl.Spec.InfrastructureProvider.Name)
+	if !ok {
+		return false, nil
+	}
+	mr, ok := p.(MachineRemover)
+	if !ok {
+		return false, nil
+	}
+	return true, mr.RemoveMachines(ctx, c, cl, providerIDs)
+}
+
+// ReplaceMachines replaces the machines of a machine pool when the provider supports it
+// and returns if they were replaced
+func ReplaceMachines(ctx context.Context, c client.Client, cl *appv1alpha1.Cluster, providerIDs []string) (bool, error) {
+	p, ok := Get(cl.Spec.InfrastructureProvider.Name)
+	if !ok {
+		return false, nil
+	}
+	mr, ok := p.(MachineReplacer)
+	if !ok {
+		return false, nil
+	}
+	return true, mr.ReplaceMachines(ctx, c, cl, providerIDs)
+}
+
+// AutoscalerValues returns the Helm values of cluster-autoscaler for the machine pools of
+// the cluster and false when the provider doesn't autoscale machine pools
+func AutoscalerValues(ctx context.Context, c client.Client, cl *appv1alpha1.Cluster) (map[string]interface{}, bool, error) {
+	p, ok := Get(cl.Spec.InfrastructureProvider.Name)
+	if !ok {
+		return nil, false, nil
+	}
+	ma, ok := p.(MachinePoolAutoscaler)
+	if !ok {
+		return nil, false, nil
+	}
+	v, err := ma.AutoscalerValues(ctx, c, cl)
+	return v, true, err
+}
+
+// AutoscaledReplicas returns the size set by cluster-autoscaler in the machine pool
+// and false when it's unknown
+func AutoscaledReplicas(ctx context.Context, c client.Client, cl *appv1alpha1.Cluster, name string) (int32, bool, error) {
+	p, ok := Get(cl.Spec.InfrastructureProvider.Name)
+	if !ok {
+		return 0, false, nil
+	}
+	ma, ok := p.(MachinePoolAutoscaler)
+	if !ok {
+		return 0, false, nil
 	}
-	return nil
+	return ma.AutoscaledReplicas(ctx, c, cl, name)
 }
 
 func DefaultRegion(infra string) string {
-	switch infra {
-	case "aws":
-		return aws.DefaultAWSRegion
+	p, ok := Get(infra)
+	if !ok {
+		return ""
 	}
-	return ""
+	return p.DefaultRegion()
 }
 
 func GetAccount(ctx context.Context, c client.Client, cl *appv1alpha1.Cluster) (Account, error) {
-	switch cl.Spec.InfrastructureProvider.Name {
-	case "aws":
-		return aws.NewAccount(ctx, c)
+	p, ok := Get(cl.Spec.InfrastructureProvider.Name)
+	if !ok {
+		return nil, nil
 	}
-	return nil, nil
+	return p.GetAccount(ctx, c, cl)
 }
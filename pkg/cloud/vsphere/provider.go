@@ -0,0 +1,163 @@
+/*
+Copyright 2021 The UnDistro authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package vsphere
+
+import (
+	"context"
+
+	appv1alpha1 "github.com/getupio-undistro/undistro/apis/app/v1alpha1"
+	"github.com/getupio-undistro/undistro/pkg/cloud"
+	"github.com/getupio-undistro/undistro/pkg/scheme"
+	"github.com/pkg/errors"
+	"k8s.io/client-go/rest"
+	capi "sigs.k8s.io/cluster-api/api/v1alpha3"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func init() {
+	cloud.Register(provider{})
+}
+
+var (
+	errGetCredentials     = errors.New("cannot retrieve credentials from secrets")
+	errDatacenterRequired = errors.New("region is required and must be a datacenter name")
+	ErrNoProviderMeta     = errors.New("meta is required. supported are " +
+		"['datacenters', 'networks', 'templates', 'supportedFlavors']")
+)
+
+type metaParam string
+
+const (
+	DatacentersMeta      = metaParam("datacenters")
+	NetworksMeta         = metaParam("networks")
+	TemplatesMeta        = metaParam("templates")
+	SupportedFlavorsMeta = metaParam("supportedFlavors")
+)
+
+type flavor struct {
+	Name               string   `json:"name"`
+	KubernetesVersions []string `json:"kubernetesVersion"`
+}
+
+var flavors = []flavor{
+	{
+		Name: appv1alpha1.Kubeadm.String(),
+		KubernetesVersions: []string{
+			"v1.18.19", "v1.18.20", "v1.21.2", "v1.19.12", "v1.20.8",
+		},
+	},
+}
+
+// provider implements cloud.Provider for vSphere.
+// The network is an existing port group and the control plane endpoint
+// is a virtual IP, so there is nothing to reconcile back from the infrastructure.
+type provider struct{}
+
+func (provider) Name() string {
+	return appv1alpha1.VSphere.String()
+}
+
+func (provider) Flavors() []appv1alpha1.InfraFlavor {
+	return appv1alpha1.BuiltinFlavors(appv1alpha1.VSphere.String())
+}
+
+func (provider) DefaultRegion() string {
+	return ""
+}
+
+func (provider) Init(ctx context.Context, c client.Client, cfg []appv1alpha1.ValuesReference, version string) ([]appv1alpha1.ValuesReference, error) {
+	return Init(ctx, c, cfg, version)
+}
+
+func (provider) Upgrade(ctx context.Context, c client.Client, cfg []appv1alpha1.ValuesReference, version string) ([]appv1alpha1.ValuesReference, error) {
+	return Upgrade(ctx, c, cfg, version)
+}
+
+func (provider) PostInstall(ctx context.Context, c client.Client) error {
+	return nil
+}
+
+func (provider) ReconcileNetwork(ctx context.Context, c client.Client, cl *appv1alpha1.Cluster, capiCluster *capi.Cluster) error {
+	return nil
+}
+
+func (provider) ReconcileLaunchTemplate(ctx context.Context, c client.Client, cl *appv1alpha1.Cluster) error {
+	return nil
+}
+
+func (provider) GetAccount(ctx context.Context, c client.Client, cl *appv1alpha1.Cluster) (cloud.Account, error) {
+	acc, err := NewAccount(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	return acc, nil
+}
+
+func (provider) CalicoValues(flavor string) map[string]interface{} {
+	return nil
+}
+
+// DescribeMetadata lists vCenter objects. Networks are listed by datacenter, given as region.
+func (provider) DescribeMetadata(config *rest.Config, region, meta string, page, itemsPerPage int) (interface{}, error) {
+	switch meta {
+	case string(SupportedFlavorsMeta):
+		return flavors, nil
+	case string(DatacentersMeta), string(NetworksMeta), string(TemplatesMeta):
+	default:
+		return nil, ErrNoProviderMeta
+	}
+	if meta == string(NetworksMeta) && region == "" {
+		return nil, errDatacenterRequired
+	}
+	ctx := context.Background()
+	k8sClient, err := client.New(config, client.Options{
+		Scheme: scheme.Scheme,
+	})
+	if err != nil {
+		return nil, errGetCredentials
+	}
+	cred, _, err := Credentials(ctx, k8sClient)
+	if err != nil {
+		return nil, errGetCredentials
+	}
+	vc, err := login(ctx, cred)
+	if err != nil {
+		return nil, err
+	}
+	switch meta {
+	case string(DatacentersMeta):
+		dcs, err := vc.datacenters(ctx)
+		if err != nil {
+			return nil, err
+		}
+		names := make([]string, 0, len(dcs))
+		for _, dc := range dcs {
+			names = append(names, dc.Name)
+		}
+		return names, nil
+	case string(NetworksMeta):
+		nets, err := vc.networks(ctx, region)
+		if err != nil {
+			return nil, err
+		}
+		names := make([]string, 0, len(nets))
+		for _, n := range nets {
+			names = append(names, n.Name)
+		}
+		return names, nil
+	}
+	return vc.templates(ctx)
+}
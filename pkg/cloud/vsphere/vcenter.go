@@ -0,0 +1,218 @@
+/*
+Copyright 2021 The UnDistro authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package vsphere
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	sessionHeader    = "vmware-api-session-id"
+	vmTemplateItem   = "vm-template"
+	ovfTemplateItem  = "ovf"
+	maxResponseBytes = 10 << 20
+)
+
+var errMissingServer = errors.New("server is required in vSphere credentials")
+
+type datacenter struct {
+	Datacenter string `json:"datacenter"`
+	Name       string `json:"name"`
+}
+
+type network struct {
+	Network string `json:"network"`
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+}
+
+type libraryItem struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// vcenterClient talks to the vSphere Automation REST API
+type vcenterClient struct {
+	httpClient *http.Client
+	baseURL    string
+	session    string
+}
+
+func newVCenterClient(cred VSphereCredentials) (*vcenterClient, error) {
+	if cred.Server == "" {
+		return nil, errMissingServer
+	}
+	tlsConfig := &tls.Config{}
+	if cred.Thumbprint != "" {
+		// vCenter usually has a self signed certificate, so it's pinned by its SHA-1 thumbprint like govc does
+		tlsConfig.InsecureSkipVerify = true
+		tlsConfig.VerifyPeerCertificate = verifyThumbprint(cred.Thumbprint)
+	}
+	server := strings.TrimSuffix(cred.Server, "/")
+	if !strings.Contains(server, "://") {
+		server = fmt.Sprintf("https://%s", server)
+	}
+	return &vcenterClient{
+		httpClient: &http.Client{
+			Timeout: 30 * time.Second,
+			Transport: &http.Transport{
+				Proxy:           http.ProxyFromEnvironment,
+				TLSClientConfig: tlsConfig,
+			},
+		},
+		baseURL: fmt.Sprintf("%s/rest", server),
+	}, nil
+}
+
+func verifyThumbprint(thumbprint string) func([][]byte, [][]*x509.Certificate) error {
+	return func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		if len(rawCerts) == 0 {
+			return errors.New("vCenter didn't present a certificate")
+		}
+		if got := Thumbprint(rawCerts[0]); !strings.EqualFold(got, thumbprint) {
+			return errors.Errorf("vCenter certificate thumbprint %s doesn't match %s", got, thumbprint)
+		}
+		return nil
+	}
+}
+
+// Thumbprint returns the SHA-1 thumbprint of a DER certificate in the format used by vSphere
+func Thumbprint(der []byte) string {
+	sum := sha1.Sum(der)
+	parts := make([]string, len(sum))
+	for i, b := range sum {
+		parts[i] = fmt.Sprintf("%02X", b)
+	}
+	return strings.Join(parts, ":")
+}
+
+// login creates an API session used by the next requests
+func (c *vcenterClient) login(ctx context.Context, username, password string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf("%s/com/vmware/cis/session", c.baseURL), nil)
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(username, password)
+	var session string
+	err = c.do(req, &session)
+	if err != nil {
+		return errors.Wrapf(err, "unable to login on %s", c.baseURL)
+	}
+	c.session = session
+	return nil
+}
+
+func (c *vcenterClient) get(ctx context.Context, path string, query url.Values, out interface{}) error {
+	addr := fmt.Sprintf("%s/%s", c.baseURL, path)
+	if len(query) > 0 {
+		addr = fmt.Sprintf("%s?%s", addr, query.Encode())
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, addr, nil)
+	if err != nil {
+		return err
+	}
+	return c.do(req, out)
+}
+
+// do sends the request and decodes the value field of the response
+func (c *vcenterClient) do(req *http.Request, out interface{}) error {
+	req.Header.Set("Accept", "application/json")
+	if c.session != "" {
+		req.Header.Set(sessionHeader, c.session)
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxResponseBytes))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("%s %s: %s", req.Method, req.URL.Path, http.StatusText(resp.StatusCode))
+	}
+	v := struct {
+		Value interface{} `json:"value"`
+	}{
+		Value: out,
+	}
+	return json.NewDecoder(bytes.NewReader(body)).Decode(&v)
+}
+
+func (c *vcenterClient) datacenters(ctx context.Context) ([]datacenter, error) {
+	dcs := make([]datacenter, 0)
+	err := c.get(ctx, "vcenter/datacenter", nil, &dcs)
+	return dcs, err
+}
+
+// networks lists the networks of the datacenter with the given name
+func (c *vcenterClient) networks(ctx context.Context, datacenterName string) ([]network, error) {
+	dcs := make([]datacenter, 0)
+	err := c.get(ctx, "vcenter/datacenter", url.Values{"filter.names": {datacenterName}}, &dcs)
+	if err != nil {
+		return nil, err
+	}
+	if len(dcs) == 0 {
+		return nil, errors.Errorf("datacenter %s not found", datacenterName)
+	}
+	nets := make([]network, 0)
+	err = c.get(ctx, "vcenter/network", url.Values{"filter.datacenters": {dcs[0].Datacenter}}, &nets)
+	return nets, err
+}
+
+// templates lists the VM templates of all content libraries
+func (c *vcenterClient) templates(ctx context.Context) ([]string, error) {
+	libs := make([]string, 0)
+	err := c.get(ctx, "com/vmware/content/library", nil, &libs)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]string, 0)
+	for _, lib := range libs {
+		items := make([]string, 0)
+		err = c.get(ctx, "com/vmware/content/library/item", url.Values{"library_id": {lib}}, &items)
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range items {
+			item := libraryItem{}
+			err = c.get(ctx, fmt.Sprintf("com/vmware/content/library/item/id:%s", url.PathEscape(id)), nil, &item)
+			if err != nil {
+				return nil, err
+			}
+			if item.Type == vmTemplateItem || item.Type == ovfTemplateItem {
+				res = append(res, item.Name)
+			}
+		}
+	}
+	return res, nil
+}
@@ -0,0 +1,168 @@
+/*
+Copyright 2021 The UnDistro authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package vsphere
+
+import (
+	"context"
+
+	appv1alpha1 "github.com/getupio-undistro/undistro/apis/app/v1alpha1"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	name          = "undistro-vsphere-config"
+	namespace     = "undistro-system"
+	serverKey     = "server"
+	usernameKey   = "username"
+	passwordKey   = "password"
+	thumbprintKey = "thumbprint"
+)
+
+type VSphereCredentials struct {
+	Server     string
+	Username   string
+	Password   string
+	Thumbprint string
+}
+
+func Credentials(ctx context.Context, c client.Client) (VSphereCredentials, *corev1.Secret, error) {
+	secret := corev1.Secret{}
+	nm := client.ObjectKey{
+		Name:      name,
+		Namespace: namespace,
+	}
+	err := c.Get(ctx, nm, &secret)
+	if err != nil {
+		return VSphereCredentials{}, nil, err
+	}
+	cred, err := credentialsFromSecret(&secret)
+	if err != nil {
+		return VSphereCredentials{}, nil, err
+	}
+	return cred, &secret, nil
+}
+
+func credentialsFromSecret(s *corev1.Secret) (VSphereCredentials, error) {
+	cred := VSphereCredentials{
+		Server:     string(s.Data[serverKey]),
+		Username:   string(s.Data[usernameKey]),
+		Password:   string(s.Data[passwordKey]),
+		Thumbprint: string(s.Data[thumbprintKey]),
+	}
+	for _, k := range []string{serverKey, usernameKey, passwordKey} {
+		if len(s.Data[k]) == 0 {
+			return VSphereCredentials{}, errors.Errorf("missing key %q in secret %s/%s", k, s.Namespace, s.Name)
+		}
+	}
+	return cred, nil
+}
+
+// login returns a client with a session opened using the given credentials
+func login(ctx context.Context, cred VSphereCredentials) (*vcenterClient, error) {
+	vc, err := newVCenterClient(cred)
+	if err != nil {
+		return nil, err
+	}
+	err = vc.login(ctx, cred.Username, cred.Password)
+	if err != nil {
+		return nil, err
+	}
+	return vc, nil
+}
+
+// Init providers
+func Init(ctx context.Context, c client.Client, cfg []appv1alpha1.ValuesReference, version string) ([]appv1alpha1.ValuesReference, error) {
+	err := verifyCredentials(ctx, c)
+	if err != nil {
+		return cfg, err
+	}
+	return cfg, nil
+}
+
+// Upgrade providers
+func Upgrade(ctx context.Context, c client.Client, cfg []appv1alpha1.ValuesReference, version string) ([]appv1alpha1.ValuesReference, error) {
+	err := verifyCredentials(ctx, c)
+	if err != nil {
+		return cfg, err
+	}
+	return cfg, nil
+}
+
+// verifyCredentials logs in vCenter to fail fast on bad credentials
+func verifyCredentials(ctx context.Context, c client.Client) error {
+	cred, _, err := Credentials(ctx, c)
+	if err != nil {
+		return err
+	}
+	_, err = login(ctx, cred)
+	return err
+}
+
+// Account is the vCenter user used by UnDistro.
+// It also exposes the connection settings rendered in cluster templates.
+type Account struct {
+	cred VSphereCredentials
+}
+
+func NewAccount(ctx context.Context, c client.Client) (*Account, error) {
+	cred, _, err := Credentials(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	_, err = login(ctx, cred)
+	if err != nil {
+		return nil, err
+	}
+	return &Account{
+		cred: cred,
+	}, nil
+}
+
+func (a *Account) GetID() string {
+	return a.cred.Server
+}
+
+func (a *Account) GetUsername() string {
+	return a.cred.Username
+}
+
+func (a *Account) IsRoot() bool {
+	return false
+}
+
+// Server returns the vCenter address
+func (a *Account) Server() string {
+	return a.cred.Server
+}
+
+// Thumbprint returns the SHA-1 thumbprint of the vCenter certificate, if any
+func (a *Account) Thumbprint() string {
+	return a.cred.Thumbprint
+}
+
+// NumCPUs returns the number of CPUs of a machine type like 4cpu-8gb
+func (a *Account) NumCPUs(machineType string) (int32, error) {
+	cpus, _, err := appv1alpha1.ParseVSphereMachineType(machineType)
+	return cpus, err
+}
+
+// MemoryMiB returns the memory of a machine type like 4cpu-8gb
+func (a *Account) MemoryMiB(machineType string) (int64, error) {
+	_, mem, err := appv1alpha1.ParseVSphereMachineType(machineType)
+	return mem, err
+}
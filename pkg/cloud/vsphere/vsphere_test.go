@@ -0,0 +1,107 @@
+/*
+Copyright 2021 The UnDistro authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package vsphere
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+// newVCenter stubs the vSphere REST API accepting only the given password
+func newVCenter(password string) *httptest.Server {
+	const session = "6f7f8e0c"
+	mux := http.NewServeMux()
+	mux.HandleFunc("/rest/com/vmware/cis/session", func(w http.ResponseWriter, r *http.Request) {
+		_, p, ok := r.BasicAuth()
+		if r.Method != http.MethodPost || !ok || p != password {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprintf(w, `{"value": %q}`, session)
+	})
+	authenticated := func(h http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get(sessionHeader) != session {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			h(w, r)
+		}
+	}
+	mux.HandleFunc("/rest/vcenter/datacenter", authenticated(func(w http.ResponseWriter, r *http.Request) {
+		if name := r.URL.Query().Get("filter.names"); name != "" && name != "dc1" {
+			fmt.Fprint(w, `{"value": []}`)
+			return
+		}
+		fmt.Fprint(w, `{"value": [{"datacenter": "datacenter-1", "name": "dc1"}]}`)
+	}))
+	mux.HandleFunc("/rest/vcenter/network", authenticated(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("filter.datacenters") != "datacenter-1" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		fmt.Fprint(w, `{"value": [{"network": "network-1", "name": "VM Network", "type": "STANDARD_PORTGROUP"}]}`)
+	}))
+	mux.HandleFunc("/rest/com/vmware/content/library", authenticated(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"value": ["lib-1"]}`)
+	}))
+	mux.HandleFunc("/rest/com/vmware/content/library/item", authenticated(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"value": ["item-1", "item-2"]}`)
+	}))
+	mux.HandleFunc("/rest/com/vmware/content/library/item/id:item-1", authenticated(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"value": {"id": "item-1", "name": "ubuntu-2004-kube-v1.20.8", "type": "vm-template"}}`)
+	}))
+	mux.HandleFunc("/rest/com/vmware/content/library/item/id:item-2", authenticated(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"value": {"id": "item-2", "name": "notes", "type": "file"}}`)
+	}))
+	return httptest.NewTLSServer(mux)
+}
+
+func TestVCenterClient(t *testing.T) {
+	g := NewWithT(t)
+	vc := newVCenter("secret")
+	defer vc.Close()
+	thumbprint := Thumbprint(vc.Certificate().Raw)
+	ctx := context.Background()
+
+	c, err := login(ctx, VSphereCredentials{Server: vc.URL, Username: "undistro", Password: "secret", Thumbprint: thumbprint})
+	g.Expect(err).ToNot(HaveOccurred())
+	dcs, err := c.datacenters(ctx)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(dcs).To(Equal([]datacenter{{Datacenter: "datacenter-1", Name: "dc1"}}))
+	nets, err := c.networks(ctx, "dc1")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(nets).To(HaveLen(1))
+	g.Expect(nets[0].Name).To(Equal("VM Network"))
+	_, err = c.networks(ctx, "unknown")
+	g.Expect(err).To(HaveOccurred())
+	templates, err := c.templates(ctx)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(templates).To(Equal([]string{"ubuntu-2004-kube-v1.20.8"}))
+
+	_, err = login(ctx, VSphereCredentials{Server: vc.URL, Username: "undistro", Password: "wrong", Thumbprint: thumbprint})
+	g.Expect(err).To(HaveOccurred())
+	_, err = login(ctx, VSphereCredentials{Server: vc.URL, Username: "undistro", Password: "secret", Thumbprint: "00:11"})
+	g.Expect(err).To(HaveOccurred())
+	// the test certificate isn't trusted without the thumbprint
+	_, err = login(ctx, VSphereCredentials{Server: vc.URL, Username: "undistro", Password: "secret"})
+	g.Expect(err).To(HaveOccurred())
+}
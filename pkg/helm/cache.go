@@ -0,0 +1,202 @@
+/*
+Copyright 2020-2021 The UnDistro authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package helm
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const (
+	cacheKindIndex = "index"
+	cacheKindChart = "chart"
+	cacheKindGit   = "git"
+)
+
+var (
+	cacheHits = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "undistro_helm_cache_hits_total",
+		Help: "Number of Helm repository indexes and charts served by the cache.",
+	}, []string{"kind"})
+	cacheMisses = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "undistro_helm_cache_misses_total",
+		Help: "Number of Helm repository indexes and charts downloaded because they were not cached or were stale.",
+	}, []string{"kind"})
+	cacheEvictions = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "undistro_helm_cache_evictions_total",
+		Help: "Number of entries evicted from the Helm cache to keep it under its maximum size.",
+	})
+	cacheSize = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "undistro_helm_cache_size_bytes",
+		Help: "Size of the Helm repository indexes and charts in the cache.",
+	})
+)
+
+func init() {
+	metrics.Registry.MustRegister(cacheHits, cacheMisses, cacheEvictions, cacheSize)
+}
+
+// Cache is a size-bounded LRU cache of repository indexes, chart archives and Git charts shared by the reconciles.
+// Indexes are keyed by the repository URL and credentials and revalidated after the IndexTTL,
+// charts are keyed by their digest and Git charts by their revision. A nil Cache caches nothing.
+type Cache struct {
+	maxSize  int64
+	indexTTL time.Duration
+	now      func() time.Time
+
+	mu      sync.Mutex
+	size    int64
+	entries map[string]*list.Element
+	lru     *list.List
+}
+
+type cacheEntry struct {
+	key          string
+	data         []byte
+	etag         string
+	lastModified string
+	fetched      time.Time
+}
+
+// NewCache returns a cache holding up to maxSize bytes. It returns nil when maxSize isn't positive.
+func NewCache(maxSize int64, indexTTL time.Duration) *Cache {
+	if maxSize <= 0 {
+		return nil
+	}
+	return &Cache{
+		maxSize:  maxSize,
+		indexTTL: indexTTL,
+		now:      time.Now,
+		entries:  make(map[string]*list.Element),
+		lru:      list.New(),
+	}
+}
+
+// Size returns the size in bytes of the cached data.
+func (c *Cache) Size() int64 {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.size
+}
+
+// Len returns the number of cached entries.
+func (c *Cache) Len() int {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Len()
+}
+
+// get returns a copy of the entry and marks it as the most recently used.
+// The data is shared and must not be modified.
+func (c *Cache) get(key string) (cacheEntry, bool) {
+	if c == nil {
+		return cacheEntry{}, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[key]
+	if !ok {
+		return cacheEntry{}, false
+	}
+	c.lru.MoveToFront(el)
+	return *el.Value.(*cacheEntry), true
+}
+
+// set adds or replaces the entry fetched now, evicting the least recently used ones over the
+// maximum size. Entries bigger than the maximum size are not cached.
+func (c *Cache) set(e cacheEntry) {
+	if c == nil || int64(len(e.data)) > c.maxSize {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e.fetched = c.now()
+	if el, ok := c.entries[e.key]; ok {
+		c.remove(el)
+	}
+	c.entries[e.key] = c.lru.PushFront(&e)
+	c.size += int64(len(e.data))
+	for c.size > c.maxSize {
+		c.remove(c.lru.Back())
+		cacheEvictions.Inc()
+	}
+	cacheSize.Set(float64(c.size))
+}
+
+// touch marks the entry as fetched now, after it was revalidated
+func (c *Cache) touch(key string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[key]; ok {
+		el.Value.(*cacheEntry).fetched = c.now()
+	}
+}
+
+// fresh returns if the entry was fetched in the IndexTTL, so it doesn't need revalidation
+func (c *Cache) fresh(e cacheEntry) bool {
+	return c.now().Sub(e.fetched) < c.indexTTL
+}
+
+func (c *Cache) remove(el *list.Element) {
+	e := c.lru.Remove(el).(*cacheEntry)
+	delete(c.entries, e.key)
+	c.size -= int64(len(e.data))
+	cacheSize.Set(float64(c.size))
+}
+
+// indexCacheKey identifies the index by the repository URL and a hash of the secret data,
+// so repositories accessed with different credentials don't share indexes
+func indexCacheKey(repositoryURL string, secret *corev1.Secret) string {
+	h := sha256.New()
+	h.Write([]byte(repositoryURL))
+	if secret != nil {
+		keys := make([]string, 0, len(secret.Data))
+		for k := range secret.Data {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			h.Write([]byte{0})
+			h.Write([]byte(k))
+			h.Write([]byte{0})
+			h.Write(secret.Data[k])
+		}
+	}
+	return cacheKindIndex + ":" + hex.EncodeToString(h.Sum(nil))
+}
+
+// chartCacheKey identifies the chart archive by its sha256 digest
+func chartCacheKey(digest string) string {
+	return cacheKindChart + ":" + digest
+}
@@ -0,0 +1,206 @@
+/*
+Copyright 2020-2021 The UnDistro authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package helm
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/repo"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestCache_set(t *testing.T) {
+	c := NewCache(10, time.Minute)
+	c.set(cacheEntry{key: "a", data: []byte("aaaa")})
+	c.set(cacheEntry{key: "b", data: []byte("bbbb")})
+	// a is the most recently used, so b is evicted
+	if _, ok := c.get("a"); !ok {
+		t.Fatal("get(a) missed")
+	}
+	c.set(cacheEntry{key: "c", data: []byte("cccc")})
+	if _, ok := c.get("b"); ok {
+		t.Error("get(b) hit after eviction")
+	}
+	if c.Len() != 2 || c.Size() != 8 {
+		t.Errorf("cache has %d entries with %d bytes, want 2 with 8 bytes", c.Len(), c.Size())
+	}
+	c.set(cacheEntry{key: "a", data: []byte("a")})
+	if c.Len() != 2 || c.Size() != 5 {
+		t.Errorf("cache has %d entries with %d bytes after replace, want 2 with 5 bytes", c.Len(), c.Size())
+	}
+	c.set(cacheEntry{key: "d", data: []byte("ddddddddddd")})
+	if _, ok := c.get("d"); ok {
+		t.Error("get(d) hit for entry bigger than the cache")
+	}
+	if NewCache(0, time.Minute) != nil {
+		t.Error("NewCache(0) is not nil")
+	}
+	var nilCache *Cache
+	nilCache.set(cacheEntry{key: "a", data: []byte("a")})
+	if _, ok := nilCache.get("a"); ok {
+		t.Error("nil cache get(a) hit")
+	}
+}
+
+func TestChartRepository_DownloadIndexWithCache(t *testing.T) {
+	index, err := ioutil.ReadFile(chartmuseumtestfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	etag := `"v1"`
+	requests, notModified := 0, 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.URL.Path != "/index.yaml" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if user, pass, ok := r.BasicAuth(); ok && (user != "user" || pass != "pass") {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.Header.Get("If-None-Match") == etag {
+			notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		w.Write(index)
+	}))
+	defer srv.Close()
+	now := time.Now()
+	cache := NewCache(1<<20, time.Minute)
+	cache.now = func() time.Time { return now }
+	download := func(secret *corev1.Secret) {
+		t.Helper()
+		r := &ChartRepository{URL: srv.URL}
+		if err := r.DownloadIndexWithCache(context.Background(), cache, secret); err != nil {
+			t.Fatal(err)
+		}
+		verifyLocalIndex(t, r.Index)
+	}
+	hits := testutil.ToFloat64(cacheHits.WithLabelValues(cacheKindIndex))
+	misses := testutil.ToFloat64(cacheMisses.WithLabelValues(cacheKindIndex))
+
+	download(nil)
+	download(nil)
+	if requests != 1 {
+		t.Errorf("fresh index requested %d times, want 1", requests)
+	}
+	now = now.Add(2 * time.Minute)
+	download(nil)
+	download(nil)
+	if requests != 2 || notModified != 1 {
+		t.Errorf("stale index requested %d times with %d not modified, want 2 with 1", requests, notModified)
+	}
+	now = now.Add(2 * time.Minute)
+	etag = `"v2"`
+	download(nil)
+	if requests != 3 || notModified != 1 {
+		t.Errorf("changed index requested %d times with %d not modified, want 3 with 1", requests, notModified)
+	}
+	// other credentials don't share the cached index
+	download(&corev1.Secret{Data: map[string][]byte{"username": []byte("user"), "password": []byte("pass")}})
+	if requests != 4 {
+		t.Errorf("index with credentials requested %d times, want 4", requests)
+	}
+	if got := testutil.ToFloat64(cacheHits.WithLabelValues(cacheKindIndex)) - hits; got != 3 {
+		t.Errorf("index cache hits = %v, want 3", got)
+	}
+	if got := testutil.ToFloat64(cacheMisses.WithLabelValues(cacheKindIndex)) - misses; got != 3 {
+		t.Errorf("index cache misses = %v, want 3", got)
+	}
+}
+
+func TestChartRepository_DownloadChartWithCache(t *testing.T) {
+	data := []byte("chart archive")
+	digest := strings.TrimPrefix(sha256Digest(data), "sha256:")
+	tests := []struct {
+		name      string
+		digest    string
+		wantCache bool
+	}{
+		{name: "digest", digest: digest, wantCache: true},
+		{name: "no digest"},
+		{name: "wrong digest", digest: strings.Repeat("0", 64)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache := NewCache(1<<20, time.Minute)
+			mg := &mockGetter{response: data}
+			r := &ChartRepository{URL: "https://example.com", Client: mg}
+			cv := &repo.ChartVersion{
+				Metadata: &chart.Metadata{Name: "chart"},
+				URLs:     []string{"charts/chart-1.0.0.tgz"},
+				Digest:   tt.digest,
+			}
+			for i := 0; i < 2; i++ {
+				mg.requestedURL = ""
+				res, err := r.DownloadChartWithCache(cache, cv)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(res.Bytes(), data) {
+					t.Errorf("DownloadChartWithCache() = %q, want %q", res.Bytes(), data)
+				}
+				if downloaded := mg.requestedURL != ""; downloaded != (i == 0 || !tt.wantCache) {
+					t.Errorf("DownloadChartWithCache() call %d downloaded = %t", i, downloaded)
+				}
+			}
+		})
+	}
+}
+
+func TestOCIRepository_DownloadChartWithCache(t *testing.T) {
+	reg := newTestRegistry(t)
+	defer reg.Close()
+	blobs := 0
+	handler := reg.Config.Handler
+	reg.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.URL.Path, "/blobs/") && r.Header.Get("Authorization") != "" {
+			blobs++
+		}
+		handler.ServeHTTP(w, r)
+	})
+	cache := NewCache(1<<20, time.Minute)
+	for i := 0; i < 2; i++ {
+		repo := reg.repository(t)
+		repo.Cache = cache
+		buf, _, err := repo.DownloadChart(context.Background(), "helmchart", "0.1.0", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(buf.Bytes(), reg.chart) {
+			t.Fatal("DownloadChart() returned another chart")
+		}
+	}
+	if blobs != 1 {
+		t.Errorf("chart blob pulled %d times, want 1", blobs)
+	}
+	if _, ok := cache.get(chartCacheKey(sha256Digest(reg.chart))); !ok {
+		t.Errorf("chart %s not cached", sha256Digest(reg.chart))
+	}
+}
@@ -0,0 +1,214 @@
+/*
+Copyright 2020-2021 The UnDistro authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package helm
+
+import (
+	"encoding/base64"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/getupio-undistro/undistro/pkg/scheme"
+	"github.com/getupio-undistro/undistro/pkg/util"
+	"helm.sh/helm/v3/pkg/release"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// ReleaseObjects returns the objects of the release manifest. Namespaced objects without
+// namespace are in the release namespace, like when Helm applies them.
+func ReleaseObjects(rel *release.Release, mapper apimeta.RESTMapper) ([]unstructured.Unstructured, error) {
+	objs, err := util.ToUnstructured([]byte(rel.Manifest))
+	if err != nil {
+		return nil, err
+	}
+	for i := range objs {
+		if objs[i].GetNamespace() != "" {
+			continue
+		}
+		gvk := objs[i].GroupVersionKind()
+		mapping, err := mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get the mapping of %s %s: %w", gvk.Kind, objs[i].GetName(), err)
+		}
+		if mapping.Scope.Name() == apimeta.RESTScopeNameNamespace {
+			objs[i].SetNamespace(rel.Namespace)
+		}
+	}
+	return objs, nil
+}
+
+// DriftedFields returns the paths of the fields set in the desired object with other values in
+// the live object. Fields the desired object doesn't set, like the ones defaulted by the API server,
+// are ignored, as well as the status and the metadata other than labels and annotations.
+// Both objects are normalized before, so values the API server rewrites, like quantities,
+// aren't reported.
+func DriftedFields(desired, live *unstructured.Unstructured) []string {
+	desired, live = normalize(desired), normalize(live)
+	fields := make([]string, 0)
+	for k, v := range desired.Object {
+		switch k {
+		case "apiVersion", "kind", "status":
+			continue
+		case "metadata":
+			dm, _ := v.(map[string]interface{})
+			lm, _ := live.Object[k].(map[string]interface{})
+			for _, mk := range []string{"labels", "annotations"} {
+				if dv, ok := dm[mk]; ok {
+					fields = driftedFields("metadata."+mk, dv, lm[mk], fields)
+				}
+			}
+			continue
+		}
+		fields = driftedFields(k, v, live.Object[k], fields)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// normalize returns a copy of the object decoded through its type when the scheme knows it,
+// so quantities and int-or-string fields are in the form the API server returns.
+// The stringData of secrets is moved to the data, which is the only one returned.
+func normalize(obj *unstructured.Unstructured) *unstructured.Unstructured {
+	obj = obj.DeepCopy()
+	gvk := obj.GroupVersionKind()
+	if gvk.Group == "" && gvk.Kind == "Secret" {
+		stringData, _, _ := unstructured.NestedStringMap(obj.Object, "stringData")
+		if len(stringData) > 0 {
+			data, _, _ := unstructured.NestedMap(obj.Object, "data")
+			if data == nil {
+				data = make(map[string]interface{}, len(stringData))
+			}
+			for k, v := range stringData {
+				data[k] = base64.StdEncoding.EncodeToString([]byte(v))
+			}
+			obj.Object["data"] = data
+		}
+		delete(obj.Object, "stringData")
+	}
+	typed, err := scheme.Scheme.New(gvk)
+	if err != nil {
+		return obj
+	}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, typed); err != nil {
+		return obj
+	}
+	m, err := runtime.DefaultUnstructuredConverter.ToUnstructured(typed)
+	if err != nil {
+		return obj
+	}
+	obj.Object = normalized(obj.Object, m).(map[string]interface{})
+	return obj
+}
+
+// normalized returns the fields of v with the values of the typed n, keeping the
+// fields the typed object omits, like the ones set to zero values.
+func normalized(v, n interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		nm, _ := n.(map[string]interface{})
+		for k := range t {
+			if nv, ok := nm[k]; ok {
+				t[k] = normalized(t[k], nv)
+			}
+		}
+		return t
+	case []interface{}:
+		ns, _ := n.([]interface{})
+		if len(ns) != len(t) {
+			return t
+		}
+		for i := range t {
+			t[i] = normalized(t[i], ns[i])
+		}
+		return t
+	}
+	if n == nil {
+		return v
+	}
+	return n
+}
+
+func driftedFields(path string, desired, live interface{}, fields []string) []string {
+	// unset fields are omitted by the API server
+	if live == nil && isZero(desired) {
+		return fields
+	}
+	switch d := desired.(type) {
+	case map[string]interface{}:
+		l, ok := live.(map[string]interface{})
+		if !ok {
+			return append(fields, path)
+		}
+		for k, v := range d {
+			fields = driftedFields(path+"."+k, v, l[k], fields)
+		}
+		return fields
+	case []interface{}:
+		l, ok := live.([]interface{})
+		if !ok || len(l) != len(d) {
+			return append(fields, path)
+		}
+		for i := range d {
+			fields = driftedFields(fmt.Sprintf("%s[%d]", path, i), d[i], l[i], fields)
+		}
+		return fields
+	}
+	// numbers are float64 in the manifest and int64 in the live objects
+	df, dok := toFloat(desired)
+	lf, lok := toFloat(live)
+	if dok && lok {
+		if df != lf {
+			return append(fields, path)
+		}
+		return fields
+	}
+	if !reflect.DeepEqual(desired, live) {
+		return append(fields, path)
+	}
+	return fields
+}
+
+func isZero(v interface{}) bool {
+	if v == nil {
+		return true
+	}
+	switch t := v.(type) {
+	case map[string]interface{}:
+		return len(t) == 0
+	case []interface{}:
+		return len(t) == 0
+	}
+	return reflect.ValueOf(v).IsZero()
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case float32:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
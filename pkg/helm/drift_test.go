@@ -0,0 +1,268 @@
+/*
+Copyright 2020-2021 The UnDistro authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package helm
+
+import (
+	"reflect"
+	"testing"
+
+	"helm.sh/helm/v3/pkg/release"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const driftManifest = `---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: config
+data:
+  key: value
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  name: role
+rules: []
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+  namespace: other
+  labels:
+    app: app
+spec:
+  replicas: 2
+  template:
+    spec:
+      containers:
+      - name: app
+        image: app:1.0.0
+        resources: {}
+`
+
+func TestReleaseObjects(t *testing.T) {
+	mapper := apimeta.NewDefaultRESTMapper(nil)
+	mapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}, apimeta.RESTScopeNamespace)
+	mapper.Add(schema.GroupVersionKind{Group: "rbac.authorization.k8s.io", Version: "v1", Kind: "ClusterRole"}, apimeta.RESTScopeRoot)
+	mapper.Add(schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}, apimeta.RESTScopeNamespace)
+	objs, err := ReleaseObjects(&release.Release{Namespace: "release", Manifest: driftManifest}, mapper)
+	if err != nil {
+		t.Fatal(err)
+	}
+	namespaces := make([]string, len(objs))
+	for i := range objs {
+		namespaces[i] = objs[i].GetNamespace()
+	}
+	if want := []string{"release", "", "other"}; !reflect.DeepEqual(namespaces, want) {
+		t.Errorf("ReleaseObjects() namespaces = %v, want %v", namespaces, want)
+	}
+	_, err = ReleaseObjects(&release.Release{Namespace: "release", Manifest: driftManifest}, apimeta.NewDefaultRESTMapper(nil))
+	if err == nil {
+		t.Error("ReleaseObjects() succeeded with unknown kinds")
+	}
+}
+
+func TestDriftedFields(t *testing.T) {
+	desired := func() *unstructured.Unstructured {
+		return &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "apps/v1",
+			"kind":       "Deployment",
+			"metadata": map[string]interface{}{
+				"name":   "app",
+				"labels": map[string]interface{}{"app": "app"},
+			},
+			"spec": map[string]interface{}{
+				"replicas": float64(2),
+				"paused":   false,
+				"template": map[string]interface{}{
+					"spec": map[string]interface{}{
+						"containers": []interface{}{
+							map[string]interface{}{"name": "app", "image": "app:1.0.0", "resources": map[string]interface{}{}},
+						},
+					},
+				},
+			},
+		}}
+	}
+	// live objects have int64 numbers and the fields defaulted by the API server
+	live := func() *unstructured.Unstructured {
+		return &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "apps/v1",
+			"kind":       "Deployment",
+			"metadata": map[string]interface{}{
+				"name":            "app",
+				"namespace":       "default",
+				"resourceVersion": "42",
+				"labels":          map[string]interface{}{"app": "app", "pod-template-hash": "abc"},
+				"annotations":     map[string]interface{}{"deployment.kubernetes.io/revision": "1"},
+			},
+			"spec": map[string]interface{}{
+				"replicas":             int64(2),
+				"revisionHistoryLimit": int64(10),
+				"template": map[string]interface{}{
+					"spec": map[string]interface{}{
+						"containers": []interface{}{
+							map[string]interface{}{"name": "app", "image": "app:1.0.0", "imagePullPolicy": "IfNotPresent", "resources": map[string]interface{}{}},
+						},
+					},
+				},
+			},
+			"status": map[string]interface{}{"replicas": int64(2)},
+		}}
+	}
+	setResources := func(obj *unstructured.Unstructured, resources map[string]interface{}) {
+		containers, _, _ := unstructured.NestedSlice(obj.Object, "spec", "template", "spec", "containers")
+		containers[0].(map[string]interface{})["resources"] = resources
+		unstructured.SetNestedSlice(obj.Object, containers, "spec", "template", "spec", "containers")
+	}
+	secret := func(obj *unstructured.Unstructured, key string, data map[string]interface{}) {
+		obj.Object = map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "Secret",
+			"metadata":   map[string]interface{}{"name": "app"},
+			key:          data,
+		}
+	}
+	tests := []struct {
+		name          string
+		modifyDesired func(desired *unstructured.Unstructured)
+		modify        func(live *unstructured.Unstructured)
+		want          []string
+	}{
+		{
+			name:   "no drift",
+			modify: func(*unstructured.Unstructured) {},
+			want:   []string{},
+		},
+		{
+			name: "scalar",
+			modify: func(live *unstructured.Unstructured) {
+				unstructured.SetNestedField(live.Object, int64(5), "spec", "replicas")
+			},
+			want: []string{"spec.replicas"},
+		},
+		{
+			name: "list element",
+			modify: func(live *unstructured.Unstructured) {
+				containers, _, _ := unstructured.NestedSlice(live.Object, "spec", "template", "spec", "containers")
+				containers[0].(map[string]interface{})["image"] = "app:2.0.0"
+				unstructured.SetNestedSlice(live.Object, containers, "spec", "template", "spec", "containers")
+			},
+			want: []string{"spec.template.spec.containers[0].image"},
+		},
+		{
+			name: "list length",
+			modify: func(live *unstructured.Unstructured) {
+				unstructured.SetNestedSlice(live.Object, []interface{}{}, "spec", "template", "spec", "containers")
+			},
+			want: []string{"spec.template.spec.containers"},
+		},
+		{
+			name: "label removed",
+			modify: func(live *unstructured.Unstructured) {
+				live.SetLabels(nil)
+			},
+			want: []string{"metadata.labels"},
+		},
+		{
+			name: "status and metadata",
+			modify: func(live *unstructured.Unstructured) {
+				live.SetNamespace("other")
+				unstructured.SetNestedField(live.Object, int64(0), "status", "replicas")
+			},
+			want: []string{},
+		},
+		{
+			name: "unset zero value",
+			modify: func(live *unstructured.Unstructured) {
+				unstructured.SetNestedField(live.Object, true, "spec", "paused")
+			},
+			want: []string{"spec.paused"},
+		},
+		{
+			name: "quantities",
+			modifyDesired: func(desired *unstructured.Unstructured) {
+				setResources(desired, map[string]interface{}{
+					"limits":   map[string]interface{}{"cpu": float64(1), "memory": "512Mi"},
+					"requests": map[string]interface{}{"cpu": 0.5},
+				})
+			},
+			modify: func(live *unstructured.Unstructured) {
+				setResources(live, map[string]interface{}{
+					"limits":   map[string]interface{}{"cpu": "1", "memory": "512Mi"},
+					"requests": map[string]interface{}{"cpu": "500m"},
+				})
+			},
+			want: []string{},
+		},
+		{
+			name: "quantity changed",
+			modifyDesired: func(desired *unstructured.Unstructured) {
+				setResources(desired, map[string]interface{}{"requests": map[string]interface{}{"cpu": 0.5}})
+			},
+			modify: func(live *unstructured.Unstructured) {
+				setResources(live, map[string]interface{}{"requests": map[string]interface{}{"cpu": "1"}})
+			},
+			want: []string{"spec.template.spec.containers[0].resources.requests.cpu"},
+		},
+		{
+			name: "int or string",
+			modifyDesired: func(desired *unstructured.Unstructured) {
+				unstructured.SetNestedMap(desired.Object, map[string]interface{}{"maxSurge": "25%", "maxUnavailable": float64(1)}, "spec", "strategy", "rollingUpdate")
+			},
+			modify: func(live *unstructured.Unstructured) {
+				unstructured.SetNestedMap(live.Object, map[string]interface{}{"maxSurge": "25%", "maxUnavailable": int64(1)}, "spec", "strategy", "rollingUpdate")
+			},
+			want: []string{},
+		},
+		{
+			name: "secret string data",
+			modifyDesired: func(desired *unstructured.Unstructured) {
+				secret(desired, "stringData", map[string]interface{}{"password": "s3cr3t"})
+			},
+			modify: func(live *unstructured.Unstructured) {
+				secret(live, "data", map[string]interface{}{"password": "czNjcjN0"})
+			},
+			want: []string{},
+		},
+		{
+			name: "secret string data changed",
+			modifyDesired: func(desired *unstructured.Unstructured) {
+				secret(desired, "stringData", map[string]interface{}{"password": "s3cr3t"})
+			},
+			modify: func(live *unstructured.Unstructured) {
+				secret(live, "data", map[string]interface{}{"password": "b3RoZXI="})
+			},
+			want: []string{"data.password"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, l := desired(), live()
+			if tt.modifyDesired != nil {
+				tt.modifyDesired(d)
+			}
+			tt.modify(l)
+			if got := DriftedFields(d, l); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("DriftedFields() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,334 @@
+/*
+Copyright 2020-2021 The UnDistro authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package helm
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+
+	appv1alpha1 "github.com/getupio-undistro/undistro/apis/app/v1alpha1"
+	"github.com/go-git/go-billy/v5"
+	"github.com/go-git/go-billy/v5/memfs"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+	gitssh "github.com/go-git/go-git/v5/plumbing/transport/ssh"
+	"github.com/go-git/go-git/v5/storage/memory"
+	"golang.org/x/crypto/ssh"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// CloneChart clones the Git repository in memory and loads the chart in its path.
+// It returns the chart and the commit checked out.
+func CloneChart(ctx context.Context, source appv1alpha1.GitChartSource, secret *corev1.Secret) (*chart.Chart, string, error) {
+	gc, err := cloneChartFiles(ctx, source, secret)
+	if err != nil {
+		return nil, "", err
+	}
+	return gc.load(source)
+}
+
+// CloneChartWithCache resolves the reference of the source in the remote repository and loads the chart
+// cloned from the same revision from the cache, so the repository is just cloned when the reference changes.
+// Abbreviated commits can't be resolved without cloning, so they aren't cached. Without a cache it's the
+// same as CloneChart.
+func CloneChartWithCache(ctx context.Context, cache *Cache, source appv1alpha1.GitChartSource, secret *corev1.Secret) (*chart.Chart, string, error) {
+	if cache == nil {
+		return CloneChart(ctx, source, secret)
+	}
+	revision, err := remoteRevision(ctx, source, secret)
+	if err != nil {
+		return nil, "", err
+	}
+	if revision == "" {
+		return CloneChart(ctx, source, secret)
+	}
+	key := gitCacheKey(source, revision, secret)
+	if cached, ok := cache.get(key); ok {
+		gc := gitChart{}
+		if err := gob.NewDecoder(bytes.NewReader(cached.data)).Decode(&gc); err == nil {
+			cacheHits.WithLabelValues(cacheKindGit).Inc()
+			return gc.load(source)
+		}
+	}
+	cacheMisses.WithLabelValues(cacheKindGit).Inc()
+	gc, err := cloneChartFiles(ctx, source, secret)
+	if err != nil {
+		return nil, "", err
+	}
+	c, commit, err := gc.load(source)
+	if err != nil {
+		return nil, "", err
+	}
+	buf := bytes.Buffer{}
+	if err := gob.NewEncoder(&buf).Encode(gc); err == nil {
+		cache.set(cacheEntry{key: key, data: buf.Bytes()})
+	}
+	return c, commit, nil
+}
+
+// gitChart holds the chart files cloned from a commit
+type gitChart struct {
+	Commit string
+	Files  []*loader.BufferedFile
+}
+
+func (gc gitChart) load(source appv1alpha1.GitChartSource) (*chart.Chart, string, error) {
+	c, err := loader.LoadFiles(gc.Files)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to load chart in %s/%s: %w", source.URL, strings.Trim(source.Path, "/"), err)
+	}
+	return c, gc.Commit, nil
+}
+
+// remoteRevision returns the hash of the source reference listed by the remote repository, like git ls-remote.
+// Full commit hashes are returned as they are and abbreviated ones as empty.
+func remoteRevision(ctx context.Context, source appv1alpha1.GitChartSource, secret *corev1.Secret) (string, error) {
+	if source.Commit != "" {
+		if len(source.Commit) != 40 {
+			return "", nil
+		}
+		return strings.ToLower(source.Commit), nil
+	}
+	auth, caBundle, err := gitAuth(source.URL, secret)
+	if err != nil {
+		return "", err
+	}
+	remote := git.NewRemote(memory.NewStorage(), &config.RemoteConfig{Name: git.DefaultRemoteName, URLs: []string{source.URL}})
+	refs, err := remote.ListContext(ctx, &git.ListOptions{Auth: auth, CABundle: caBundle})
+	if err != nil {
+		return "", fmt.Errorf("failed to list references of %s: %w", source.URL, err)
+	}
+	name := plumbing.HEAD
+	switch {
+	case source.Branch != "":
+		name = plumbing.NewBranchReferenceName(source.Branch)
+	case source.Tag != "":
+		name = plumbing.NewTagReferenceName(source.Tag)
+	}
+	byName := make(map[plumbing.ReferenceName]*plumbing.Reference, len(refs))
+	for _, ref := range refs {
+		byName[ref.Name()] = ref
+	}
+	ref, ok := byName[name]
+	if ok && ref.Type() == plumbing.SymbolicReference {
+		ref, ok = byName[ref.Target()]
+	}
+	if !ok {
+		return "", fmt.Errorf("reference %s not found in %s", name, source.URL)
+	}
+	return ref.Hash().String(), nil
+}
+
+// gitCacheKey identifies the chart files by the repository URL, the revision, the chart path
+// and a hash of the secret data, so charts of private repositories aren't shared without the credentials
+func gitCacheKey(source appv1alpha1.GitChartSource, revision string, secret *corev1.Secret) string {
+	return cacheKindGit + ":" + revision + ":" + path.Clean("/"+source.Path) + ":" + indexCacheKey(source.URL, secret)
+}
+
+func gitAuth(repositoryURL string, secret *corev1.Secret) (transport.AuthMethod, []byte, error) {
+	if secret == nil {
+		return nil, nil, nil
+	}
+	auth, err := GitAuthFromSecret(repositoryURL, *secret)
+	if err != nil {
+		return nil, nil, err
+	}
+	return auth, secret.Data["caFile"], nil
+}
+
+// cloneChartFiles clones the Git repository in memory and returns the files in the chart path
+// with the commit checked out
+func cloneChartFiles(ctx context.Context, source appv1alpha1.GitChartSource, secret *corev1.Secret) (gitChart, error) {
+	opts := &git.CloneOptions{
+		URL:          source.URL,
+		SingleBranch: true,
+		Depth:        1,
+		Tags:         git.NoTags,
+	}
+	switch {
+	case source.Branch != "":
+		opts.ReferenceName = plumbing.NewBranchReferenceName(source.Branch)
+	case source.Tag != "":
+		opts.ReferenceName = plumbing.NewTagReferenceName(source.Tag)
+	case source.Commit != "":
+		// the commit can be in any branch, so the whole history is fetched
+		opts.SingleBranch = false
+		opts.Depth = 0
+		opts.NoCheckout = true
+	}
+	var err error
+	opts.Auth, opts.CABundle, err = gitAuth(source.URL, secret)
+	if err != nil {
+		return gitChart{}, err
+	}
+	fs := memfs.New()
+	repo, err := git.CloneContext(ctx, memory.NewStorage(), fs, opts)
+	if err != nil {
+		return gitChart{}, fmt.Errorf("failed to clone %s: %w", source.URL, err)
+	}
+	var commit plumbing.Hash
+	if source.Commit != "" {
+		w, err := repo.Worktree()
+		if err != nil {
+			return gitChart{}, err
+		}
+		h, err := repo.ResolveRevision(plumbing.Revision(source.Commit))
+		if err != nil {
+			return gitChart{}, fmt.Errorf("commit %s not found in %s: %w", source.Commit, source.URL, err)
+		}
+		err = w.Checkout(&git.CheckoutOptions{Hash: *h})
+		if err != nil {
+			return gitChart{}, fmt.Errorf("failed to checkout commit %s: %w", source.Commit, err)
+		}
+		commit = *h
+	} else {
+		head, err := repo.Head()
+		if err != nil {
+			return gitChart{}, err
+		}
+		commit = head.Hash()
+	}
+	files, err := chartFiles(fs, path.Clean("/"+source.Path))
+	if err != nil {
+		return gitChart{}, err
+	}
+	return gitChart{Commit: commit.String(), Files: files}, nil
+}
+
+// chartFiles returns the files in the chart directory with their paths relative to it
+func chartFiles(fs billy.Filesystem, dir string) ([]*loader.BufferedFile, error) {
+	files := make([]*loader.BufferedFile, 0)
+	var walk func(p string) error
+	walk = func(p string) error {
+		infos, err := fs.ReadDir(p)
+		if err != nil {
+			return err
+		}
+		for _, info := range infos {
+			name := path.Join(p, info.Name())
+			if info.IsDir() {
+				err = walk(name)
+				if err != nil {
+					return err
+				}
+				continue
+			}
+			f, err := fs.Open(name)
+			if err != nil {
+				return err
+			}
+			data, err := ioutil.ReadAll(f)
+			f.Close()
+			if err != nil {
+				return err
+			}
+			files = append(files, &loader.BufferedFile{
+				Name: strings.TrimPrefix(strings.TrimPrefix(name, dir), "/"),
+				Data: data,
+			})
+		}
+		return nil
+	}
+	_, err := fs.Stat(dir)
+	if err != nil {
+		return nil, fmt.Errorf("chart path %s not found: %w", dir, err)
+	}
+	return files, walk(dir)
+}
+
+// GitAuthFromSecret returns the authentication for the repository URL from the secret.
+// SSH repositories use the identity private key, verified with the known_hosts keys.
+// HTTP repositories use the username and password keys, or the token key as the password.
+// Secrets without the keys of the URL scheme are ignored.
+func GitAuthFromSecret(repositoryURL string, secret corev1.Secret) (transport.AuthMethod, error) {
+	ep, err := transport.NewEndpoint(repositoryURL)
+	if err != nil {
+		return nil, err
+	}
+	switch ep.Protocol {
+	case "ssh":
+		identity := secret.Data["identity"]
+		if len(identity) == 0 {
+			return nil, nil
+		}
+		knownHosts := secret.Data["known_hosts"]
+		if len(knownHosts) == 0 {
+			return nil, fmt.Errorf("invalid '%s' secret data: field 'known_hosts' is required with 'identity'", secret.Name)
+		}
+		user := ep.User
+		if user == "" {
+			user = "git"
+		}
+		auth, err := gitssh.NewPublicKeys(user, identity, string(secret.Data["password"]))
+		if err != nil {
+			return nil, fmt.Errorf("invalid '%s' secret data: %w", secret.Name, err)
+		}
+		auth.HostKeyCallback, err = knownHostsCallback(secret.Name, knownHosts)
+		if err != nil {
+			return nil, err
+		}
+		return auth, nil
+	case "http", "https":
+		username, password := string(secret.Data["username"]), string(secret.Data["password"])
+		if token := string(secret.Data["token"]); token != "" {
+			if username == "" {
+				username = "git"
+			}
+			password = token
+		}
+		switch {
+		case username == "" && password == "":
+			return nil, nil
+		case username == "" || password == "":
+			return nil, fmt.Errorf("invalid '%s' secret data: required fields 'username' and 'password' or 'token'", secret.Name)
+		}
+		return &githttp.BasicAuth{Username: username, Password: password}, nil
+	}
+	// local repositories have no authentication
+	return nil, nil
+}
+
+// knownHostsCallback verifies the host keys against the known_hosts data,
+// which is only read from files by the knownhosts package
+func knownHostsCallback(secretName string, knownHosts []byte) (ssh.HostKeyCallback, error) {
+	f, err := ioutil.TempFile("", "known_hosts-"+secretName)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(f.Name())
+	_, err = f.Write(knownHosts)
+	f.Close()
+	if err != nil {
+		return nil, err
+	}
+	cb, err := gitssh.NewKnownHostsCallback(f.Name())
+	if err != nil {
+		return nil, fmt.Errorf("invalid '%s' secret data: %w", secretName, err)
+	}
+	return cb, nil
+}
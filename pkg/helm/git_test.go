@@ -0,0 +1,288 @@
+/*
+Copyright 2020-2021 The UnDistro authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package helm
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	appv1alpha1 "github.com/getupio-undistro/undistro/apis/app/v1alpha1"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// newTestGitRepository creates a bare repository with the test chart in the charts/helmchart path.
+// The v0.1.0 tag points to the first commit and master to the second one, which bumps the chart to 0.2.0.
+func newTestGitRepository(t *testing.T) (url string, first string, second string) {
+	dir := t.TempDir()
+	work := filepath.Join(dir, "work")
+	repo, err := git.PlainInit(work, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := repo.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	chartDir := filepath.Join(work, "charts", "helmchart")
+	err = filepath.Walk("testdata/charts/helmchart", func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel("testdata/charts/helmchart", p)
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return os.MkdirAll(filepath.Join(chartDir, rel), 0755)
+		}
+		data, err := ioutil.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		return ioutil.WriteFile(filepath.Join(chartDir, rel), data, 0644)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	commit := func(msg string) string {
+		_, err := w.Add(".")
+		if err != nil {
+			t.Fatal(err)
+		}
+		h, err := w.Commit(msg, &git.CommitOptions{
+			Author: &object.Signature{Name: "undistro", Email: "undistro@example.com", When: time.Now()},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return h.String()
+	}
+	first = commit("add helmchart")
+	_, err = repo.CreateTag("v0.1.0", plumbing.NewHash(first), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chartFile := filepath.Join(chartDir, "Chart.yaml")
+	data, err := ioutil.ReadFile(chartFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(chartFile, []byte(strings.Replace(string(data), "version: 0.1.0", "version: 0.2.0", 1)), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second = commit("bump helmchart to 0.2.0")
+	url = filepath.Join(dir, "charts.git")
+	_, err = git.PlainClone(url, true, &git.CloneOptions{URL: work})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return url, first, second
+}
+
+func TestCloneChart(t *testing.T) {
+	url, first, second := newTestGitRepository(t)
+	tests := []struct {
+		name    string
+		source  appv1alpha1.GitChartSource
+		version string
+		commit  string
+		wantErr bool
+	}{
+		{
+			name:    "default branch",
+			source:  appv1alpha1.GitChartSource{URL: url, Path: "charts/helmchart"},
+			version: "0.2.0",
+			commit:  second,
+		},
+		{
+			name:    "branch",
+			source:  appv1alpha1.GitChartSource{URL: url, Branch: "master", Path: "/charts/helmchart/"},
+			version: "0.2.0",
+			commit:  second,
+		},
+		{
+			name:    "tag",
+			source:  appv1alpha1.GitChartSource{URL: url, Tag: "v0.1.0", Path: "charts/helmchart"},
+			version: "0.1.0",
+			commit:  first,
+		},
+		{
+			name:    "commit",
+			source:  appv1alpha1.GitChartSource{URL: url, Commit: first, Path: "charts/helmchart"},
+			version: "0.1.0",
+			commit:  first,
+		},
+		{
+			name:    "unknown branch",
+			source:  appv1alpha1.GitChartSource{URL: url, Branch: "main", Path: "charts/helmchart"},
+			wantErr: true,
+		},
+		{
+			name:    "unknown path",
+			source:  appv1alpha1.GitChartSource{URL: url, Path: "charts/redis"},
+			wantErr: true,
+		},
+		{
+			name:    "path without chart",
+			source:  appv1alpha1.GitChartSource{URL: url, Path: "charts"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, commit, err := CloneChart(context.Background(), tt.source, nil)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CloneChart() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if c.Metadata.Name != "helmchart" || c.Metadata.Version != tt.version {
+				t.Errorf("CloneChart() chart = %s-%s, want helmchart-%s", c.Metadata.Name, c.Metadata.Version, tt.version)
+			}
+			if commit != tt.commit {
+				t.Errorf("CloneChart() commit = %s, want %s", commit, tt.commit)
+			}
+		})
+	}
+}
+
+func TestCloneChartWithCache(t *testing.T) {
+	url, first, second := newTestGitRepository(t)
+	repo, err := git.PlainOpen(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache := NewCache(1<<20, time.Minute)
+	hits := testutil.ToFloat64(cacheHits.WithLabelValues(cacheKindGit))
+	misses := testutil.ToFloat64(cacheMisses.WithLabelValues(cacheKindGit))
+	clone := func(source appv1alpha1.GitChartSource, version, commit string) {
+		t.Helper()
+		c, got, err := CloneChartWithCache(context.Background(), cache, source, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c.Metadata.Version != version || got != commit {
+			t.Errorf("CloneChartWithCache() = helmchart-%s at %s, want helmchart-%s at %s", c.Metadata.Version, got, version, commit)
+		}
+	}
+	source := appv1alpha1.GitChartSource{URL: url, Path: "charts/helmchart"}
+	clone(source, "0.2.0", second)
+	clone(source, "0.2.0", second)
+	// moving the branch clones the new revision
+	err = repo.Storer.SetReference(plumbing.NewHashReference(plumbing.NewBranchReferenceName("master"), plumbing.NewHash(first)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	clone(source, "0.1.0", first)
+	// the commit pin shares the chart cloned from the branch at the same revision
+	clone(appv1alpha1.GitChartSource{URL: url, Commit: first, Path: "charts/helmchart"}, "0.1.0", first)
+	// abbreviated commits are always cloned
+	clone(appv1alpha1.GitChartSource{URL: url, Commit: first[:7], Path: "charts/helmchart"}, "0.1.0", first)
+	if got := testutil.ToFloat64(cacheHits.WithLabelValues(cacheKindGit)) - hits; got != 2 {
+		t.Errorf("git cache hits = %v, want 2", got)
+	}
+	if got := testutil.ToFloat64(cacheMisses.WithLabelValues(cacheKindGit)) - misses; got != 2 {
+		t.Errorf("git cache misses = %v, want 2", got)
+	}
+	if _, _, err := CloneChartWithCache(context.Background(), cache, appv1alpha1.GitChartSource{URL: url, Branch: "main"}, nil); err == nil {
+		t.Error("CloneChartWithCache() of an unknown branch error = nil")
+	}
+}
+
+func TestGitAuthFromSecret(t *testing.T) {
+	tests := []struct {
+		name    string
+		url     string
+		data    map[string][]byte
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "http credentials",
+			url:  "https://github.com/getupio-undistro/charts.git",
+			data: map[string][]byte{"username": []byte("user"), "password": []byte("pass")},
+			want: "user",
+		},
+		{
+			name: "http token",
+			url:  "https://github.com/getupio-undistro/charts.git",
+			data: map[string][]byte{"token": []byte("secret-token")},
+			want: "git",
+		},
+		{
+			name:    "http without password",
+			url:     "https://github.com/getupio-undistro/charts.git",
+			data:    map[string][]byte{"username": []byte("user")},
+			wantErr: true,
+		},
+		{
+			name: "http without credentials",
+			url:  "https://github.com/getupio-undistro/charts.git",
+			data: map[string][]byte{"caFile": []byte("ca")},
+		},
+		{
+			name:    "ssh without known_hosts",
+			url:     "git@github.com:getupio-undistro/charts.git",
+			data:    map[string][]byte{"identity": []byte("key")},
+			wantErr: true,
+		},
+		{
+			name:    "ssh invalid identity",
+			url:     "ssh://git@github.com/getupio-undistro/charts.git",
+			data:    map[string][]byte{"identity": []byte("key"), "known_hosts": []byte("github.com ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIOMqqnkVzrm0SdG6UOoqKLsabgH5C9okWi0dh2l9GKJl")},
+			wantErr: true,
+		},
+		{
+			name: "local repository",
+			url:  "/srv/charts.git",
+			data: map[string][]byte{"token": []byte("secret-token")},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			auth, err := GitAuthFromSecret(tt.url, corev1.Secret{Data: tt.data})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GitAuthFromSecret() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if tt.want == "" {
+				if auth != nil {
+					t.Errorf("GitAuthFromSecret() = %v, want nil", auth)
+				}
+				return
+			}
+			basic, ok := auth.(*githttp.BasicAuth)
+			if !ok || basic.Username != tt.want {
+				t.Errorf("GitAuthFromSecret() = %v, want basic auth for %s", auth, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,409 @@
+/*
+Copyright 2020-2021 The UnDistro authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package helm
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/getupio-undistro/undistro/pkg/version"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// OCIScheme is the URL scheme of the chart repositories in OCI registries
+	OCIScheme = "oci"
+
+	ociManifestMediaType = "application/vnd.oci.image.manifest.v1+json"
+	// ChartLayerMediaType is the media type of the chart archive layer
+	ChartLayerMediaType = "application/vnd.cncf.helm.chart.content.v1.tar+gzip"
+	// legacyChartLayerMediaType is used by charts pushed with Helm versions before 3.7
+	legacyChartLayerMediaType = "application/tar+gzip"
+)
+
+var digestRegexp = regexp.MustCompile(`^sha256:[a-f0-9]{64}$`)
+
+// IsOCI returns if the repository URL points to an OCI registry
+func IsOCI(repositoryURL string) bool {
+	return strings.HasPrefix(repositoryURL, OCIScheme+"://")
+}
+
+// ValidDigest returns if the digest is a sha256 digest of an OCI content, like
+// sha256:4f53cda18c2baa0c0354bb5f9a3ecbe5ed12ab4d8e11ba873c2f11161202b945
+func ValidDigest(digest string) bool {
+	return digestRegexp.MatchString(digest)
+}
+
+// OCIRepository pulls Helm charts stored as OCI artifacts in a container registry,
+// without the index of HTTP chart repositories.
+type OCIRepository struct {
+	// Host of the registry, with the port
+	Host string
+	// Path of the charts in the registry, the chart name is appended to it
+	Path string
+	// PlainHTTP disables TLS. Like in the Docker daemon, it's used for registries in the loopback interface.
+	PlainHTTP bool
+	Client    *http.Client
+	// Cache holds the chart archives by layer digest, the manifests are always pulled
+	Cache *Cache
+
+	username string
+	password string
+	// tokens are the bearer tokens by authorization scope
+	tokens map[string]string
+}
+
+// NewOCIRepository returns an OCIRepository for the oci:// repository URL.
+// The username, password, certFile, keyFile and caFile keys of the secret are used to
+// authenticate to the registry like in the chart repositories.
+func NewOCIRepository(repositoryURL string, secret *corev1.Secret, timeout time.Duration) (*OCIRepository, error) {
+	u, err := url.Parse(repositoryURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != OCIScheme {
+		return nil, fmt.Errorf("invalid OCI repository URL '%s': scheme must be %s", repositoryURL, OCIScheme)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("invalid OCI repository URL '%s': registry host is required", repositoryURL)
+	}
+	r := &OCIRepository{
+		Host:      u.Host,
+		Path:      strings.Trim(u.Path, "/"),
+		PlainHTTP: isLoopback(u.Hostname()),
+		tokens:    make(map[string]string),
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if secret != nil {
+		basicAuth, err := BasicAuthFromSecret(*secret)
+		if err != nil {
+			return nil, err
+		}
+		if basicAuth != nil {
+			r.username, r.password = string(secret.Data["username"]), string(secret.Data["password"])
+		}
+		tlsConfig, err := TLSConfigFromSecret(*secret)
+		if err != nil {
+			return nil, err
+		}
+		if tlsConfig != nil {
+			transport.TLSClientConfig = tlsConfig
+		}
+	}
+	r.Client = &http.Client{
+		Transport: transport,
+		Timeout:   timeout,
+	}
+	return r, nil
+}
+
+// TLSConfigFromSecret returns the TLS config for the certFile, keyFile and caFile of the secret.
+// Secrets with none of them are ignored, like in TLSClientConfigFromSecret.
+func TLSConfigFromSecret(secret corev1.Secret) (*tls.Config, error) {
+	certBytes, keyBytes, caBytes := secret.Data["certFile"], secret.Data["keyFile"], secret.Data["caFile"]
+	switch {
+	case len(certBytes)+len(keyBytes)+len(caBytes) == 0:
+		return nil, nil
+	case (len(certBytes) > 0 && len(keyBytes) == 0) || (len(keyBytes) > 0 && len(certBytes) == 0):
+		return nil, fmt.Errorf("invalid '%s' secret data: fields 'certFile' and 'keyFile' require each other's presence",
+			secret.Name)
+	}
+	cfg := &tls.Config{}
+	if len(certBytes) > 0 {
+		cert, err := tls.X509KeyPair(certBytes, keyBytes)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	if len(caBytes) > 0 {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caBytes) {
+			return nil, fmt.Errorf("invalid '%s' secret data: no certificates in 'caFile'", secret.Name)
+		}
+		cfg.RootCAs = pool
+	}
+	return cfg, nil
+}
+
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// Repository returns the name of the chart repository in the registry
+func (r *OCIRepository) Repository(name string) string {
+	if r.Path == "" {
+		return name
+	}
+	return path.Join(r.Path, name)
+}
+
+// Tags returns the tags of the chart
+func (r *OCIRepository) Tags(ctx context.Context, name string) ([]string, error) {
+	repository := r.Repository(name)
+	res, err := r.get(ctx, repository, fmt.Sprintf("/v2/%s/tags/list", repository), "")
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	list := struct {
+		Tags []string `json:"tags"`
+	}{}
+	err = json.NewDecoder(res.Body).Decode(&list)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode tags of %s: %w", repository, err)
+	}
+	return list.Tags, nil
+}
+
+// LatestVersion returns the latest stable version of the chart. Helm pushes the versions with
+// build metadata replacing + by _, because + is not allowed in tags.
+func (r *OCIRepository) LatestVersion(ctx context.Context, name string) (*semver.Version, error) {
+	tags, err := r.Tags(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	var latest *semver.Version
+	for _, t := range tags {
+		v, err := version.ParseVersion(strings.ReplaceAll(t, "_", "+"))
+		if err != nil || v.Prerelease() != "" {
+			continue
+		}
+		if latest == nil || v.GreaterThan(latest) {
+			latest = v
+		}
+	}
+	if latest == nil {
+		return nil, fmt.Errorf("no chart version found for %s", r.Repository(name))
+	}
+	return latest, nil
+}
+
+type ociDescriptor struct {
+	MediaType string `json:"mediaType"`
+	Digest    string `json:"digest"`
+	Size      int64  `json:"size"`
+}
+
+type ociManifest struct {
+	Layers []ociDescriptor `json:"layers"`
+}
+
+// DownloadChart pulls the chart archive of the version. When the digest is set, the manifest
+// is pulled by it, so the chart can't be replaced by pushing the version again.
+// It returns the chart archive and the digest of its manifest.
+func (r *OCIRepository) DownloadChart(ctx context.Context, name, ver, digest string) (*bytes.Buffer, string, error) {
+	repository := r.Repository(name)
+	reference := strings.ReplaceAll(ver, "+", "_")
+	if digest != "" {
+		if !ValidDigest(digest) {
+			return nil, "", fmt.Errorf("invalid digest '%s'", digest)
+		}
+		reference = digest
+	}
+	res, err := r.get(ctx, repository, fmt.Sprintf("/v2/%s/manifests/%s", repository, reference), ociManifestMediaType)
+	if err != nil {
+		return nil, "", err
+	}
+	defer res.Body.Close()
+	b, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, "", err
+	}
+	manifestDigest := sha256Digest(b)
+	if digest != "" && manifestDigest != digest {
+		return nil, "", fmt.Errorf("manifest digest of %s is %s, expected %s", repository, manifestDigest, digest)
+	}
+	m := ociManifest{}
+	err = json.Unmarshal(b, &m)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to decode manifest of %s: %w", repository, err)
+	}
+	var layer *ociDescriptor
+	for i := range m.Layers {
+		if m.Layers[i].MediaType == ChartLayerMediaType || m.Layers[i].MediaType == legacyChartLayerMediaType {
+			layer = &m.Layers[i]
+			break
+		}
+	}
+	if layer == nil {
+		return nil, "", fmt.Errorf("%s:%s is not a Helm chart, no layer with media type %s", repository, reference, ChartLayerMediaType)
+	}
+	key := chartCacheKey(layer.Digest)
+	if cached, ok := r.Cache.get(key); ok {
+		cacheHits.WithLabelValues(cacheKindChart).Inc()
+		return bytes.NewBuffer(append([]byte(nil), cached.data...)), manifestDigest, nil
+	}
+	if r.Cache != nil {
+		cacheMisses.WithLabelValues(cacheKindChart).Inc()
+	}
+	blob, err := r.get(ctx, repository, fmt.Sprintf("/v2/%s/blobs/%s", repository, layer.Digest), "")
+	if err != nil {
+		return nil, "", err
+	}
+	defer blob.Body.Close()
+	buf := &bytes.Buffer{}
+	_, err = io.Copy(buf, blob.Body)
+	if err != nil {
+		return nil, "", err
+	}
+	if d := sha256Digest(buf.Bytes()); d != layer.Digest {
+		return nil, "", fmt.Errorf("chart layer digest of %s is %s, expected %s", repository, d, layer.Digest)
+	}
+	r.Cache.set(cacheEntry{
+		key:  key,
+		data: append([]byte(nil), buf.Bytes()...),
+	})
+	return buf, manifestDigest, nil
+}
+
+func sha256Digest(b []byte) string {
+	sum := sha256.Sum256(b)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// get requests the registry API, authenticating with the challenge of the registry when it's unauthorized
+func (r *OCIRepository) get(ctx context.Context, repository, p, accept string) (*http.Response, error) {
+	scope := fmt.Sprintf("repository:%s:pull", repository)
+	res, err := r.do(ctx, p, accept, scope)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode == http.StatusUnauthorized {
+		challenge := res.Header.Get("WWW-Authenticate")
+		res.Body.Close()
+		err = r.authorize(ctx, challenge, scope)
+		if err != nil {
+			return nil, err
+		}
+		res, err = r.do(ctx, p, accept, scope)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if res.StatusCode != http.StatusOK {
+		res.Body.Close()
+		return nil, fmt.Errorf("failed to get %s from registry %s: %s", p, r.Host, res.Status)
+	}
+	return res, nil
+}
+
+func (r *OCIRepository) do(ctx context.Context, p, accept, scope string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.url(p), nil)
+	if err != nil {
+		return nil, err
+	}
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	if token, ok := r.tokens[scope]; ok {
+		req.Header.Set("Authorization", "Bearer "+token)
+	} else if r.username != "" {
+		req.SetBasicAuth(r.username, r.password)
+	}
+	return r.Client.Do(req)
+}
+
+func (r *OCIRepository) url(p string) string {
+	scheme := "https"
+	if r.PlainHTTP {
+		scheme = "http"
+	}
+	return fmt.Sprintf("%s://%s%s", scheme, r.Host, p)
+}
+
+// authorize gets a bearer token for the scope from the authorization server in the challenge.
+// Registries with basic authentication are authorized by the credentials sent in every request.
+func (r *OCIRepository) authorize(ctx context.Context, challenge, scope string) error {
+	if !strings.HasPrefix(strings.ToLower(challenge), "bearer ") {
+		return fmt.Errorf("unauthorized in registry %s", r.Host)
+	}
+	params := parseChallenge(challenge[len("bearer "):])
+	realm, err := url.Parse(params["realm"])
+	if err != nil || realm.Host == "" {
+		return fmt.Errorf("invalid authentication realm '%s' in registry %s", params["realm"], r.Host)
+	}
+	q := realm.Query()
+	if params["service"] != "" {
+		q.Set("service", params["service"])
+	}
+	q.Set("scope", scope)
+	realm.RawQuery = q.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, realm.String(), nil)
+	if err != nil {
+		return err
+	}
+	if r.username != "" {
+		req.SetBasicAuth(r.username, r.password)
+	}
+	res, err := r.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to authenticate to registry %s: %s", r.Host, res.Status)
+	}
+	token := struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}{}
+	err = json.NewDecoder(res.Body).Decode(&token)
+	if err != nil {
+		return fmt.Errorf("failed to decode token of registry %s: %w", r.Host, err)
+	}
+	if token.Token == "" {
+		token.Token = token.AccessToken
+	}
+	if token.Token == "" {
+		return fmt.Errorf("no token returned by registry %s", r.Host)
+	}
+	r.tokens[scope] = token.Token
+	return nil
+}
+
+// parseChallenge parses the key="value" parameters of a WWW-Authenticate challenge
+func parseChallenge(s string) map[string]string {
+	params := make(map[string]string)
+	for _, p := range strings.Split(s, ",") {
+		kv := strings.SplitN(strings.TrimSpace(p), "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		params[strings.ToLower(kv[0])] = strings.Trim(kv[1], `"`)
+	}
+	return params
+}
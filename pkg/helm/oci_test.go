@@ -0,0 +1,207 @@
+/*
+Copyright 2020-2021 The UnDistro authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package helm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"helm.sh/helm/v3/pkg/chart/loader"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// testRegistry serves the chart archive like a registry with token authentication
+type testRegistry struct {
+	*httptest.Server
+	chart    []byte
+	manifest []byte
+	tags     []string
+}
+
+func newTestRegistry(t *testing.T) *testRegistry {
+	chart, err := ioutil.ReadFile("testdata/charts/helmchart-0.1.0.tgz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifest, err := json.Marshal(map[string]interface{}{
+		"schemaVersion": 2,
+		"config": ociDescriptor{
+			MediaType: "application/vnd.cncf.helm.config.v1+json",
+			Digest:    sha256Digest([]byte("{}")),
+			Size:      2,
+		},
+		"layers": []ociDescriptor{
+			{
+				MediaType: ChartLayerMediaType,
+				Digest:    sha256Digest(chart),
+				Size:      int64(len(chart)),
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	reg := &testRegistry{
+		chart:    chart,
+		manifest: manifest,
+		tags:     []string{"0.0.9", "0.1.0", "0.2.0-rc.1", "latest"},
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		user, pass, ok := r.BasicAuth()
+		if !ok || user != "user" || pass != "pass" || r.URL.Query().Get("scope") != "repository:charts/helmchart:pull" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(w, `{"token":"secret-token"}`)
+	})
+	mux.HandleFunc("/v2/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret-token" {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="registry",scope="repository:charts/helmchart:pull"`, reg.URL))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/v2/charts/helmchart/tags/list":
+			json.NewEncoder(w).Encode(map[string]interface{}{"name": "charts/helmchart", "tags": reg.tags})
+		case "/v2/charts/helmchart/manifests/0.1.0", "/v2/charts/helmchart/manifests/" + sha256Digest(reg.manifest):
+			w.Header().Set("Content-Type", ociManifestMediaType)
+			w.Write(reg.manifest)
+		case "/v2/charts/helmchart/blobs/" + sha256Digest(chart):
+			w.Write(reg.chart)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+	reg.Server = httptest.NewServer(mux)
+	return reg
+}
+
+func (r *testRegistry) repository(t *testing.T) *OCIRepository {
+	secret := &corev1.Secret{
+		Data: map[string][]byte{
+			"username": []byte("user"),
+			"password": []byte("pass"),
+		},
+	}
+	repo, err := NewOCIRepository("oci://"+strings.TrimPrefix(r.URL, "http://")+"/charts", secret, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return repo
+}
+
+func TestNewOCIRepository(t *testing.T) {
+	tests := []struct {
+		url       string
+		host      string
+		path      string
+		plainHTTP bool
+		wantErr   bool
+	}{
+		{url: "oci://ghcr.io/getupio-undistro/charts", host: "ghcr.io", path: "getupio-undistro/charts"},
+		{url: "oci://localhost:5000", host: "localhost:5000", plainHTTP: true},
+		{url: "oci://127.0.0.1:5000/charts/", host: "127.0.0.1:5000", path: "charts", plainHTTP: true},
+		{url: "https://charts.example.com", wantErr: true},
+		{url: "oci:///charts", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			r, err := NewOCIRepository(tt.url, nil, 0)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewOCIRepository() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if r.Host != tt.host || r.Path != tt.path || r.PlainHTTP != tt.plainHTTP {
+				t.Errorf("NewOCIRepository() = %s %s %t, want %s %s %t", r.Host, r.Path, r.PlainHTTP, tt.host, tt.path, tt.plainHTTP)
+			}
+		})
+	}
+}
+
+func TestOCIRepository_LatestVersion(t *testing.T) {
+	reg := newTestRegistry(t)
+	defer reg.Close()
+	v, err := reg.repository(t).LatestVersion(context.Background(), "helmchart")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.String() != "0.1.0" {
+		t.Errorf("LatestVersion() = %s, want 0.1.0", v)
+	}
+}
+
+func TestOCIRepository_DownloadChart(t *testing.T) {
+	reg := newTestRegistry(t)
+	defer reg.Close()
+	manifestDigest := sha256Digest(reg.manifest)
+	tests := []struct {
+		name    string
+		version string
+		digest  string
+		wantErr bool
+	}{
+		{name: "by version", version: "0.1.0"},
+		{name: "by digest", version: "0.1.0", digest: manifestDigest},
+		{name: "unknown version", version: "0.3.0", wantErr: true},
+		{name: "unknown digest", version: "0.1.0", digest: sha256Digest([]byte("other")), wantErr: true},
+		{name: "invalid digest", version: "0.1.0", digest: "sha256:1234", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf, digest, err := reg.repository(t).DownloadChart(context.Background(), "helmchart", tt.version, tt.digest)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("DownloadChart() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if digest != manifestDigest {
+				t.Errorf("DownloadChart() digest = %s, want %s", digest, manifestDigest)
+			}
+			c, err := loader.LoadArchive(buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if c.Metadata.Name != "helmchart" || c.Metadata.Version != "0.1.0" {
+				t.Errorf("DownloadChart() chart = %s-%s, want helmchart-0.1.0", c.Metadata.Name, c.Metadata.Version)
+			}
+		})
+	}
+}
+
+func TestOCIRepository_Unauthorized(t *testing.T) {
+	reg := newTestRegistry(t)
+	defer reg.Close()
+	repo, err := NewOCIRepository("oci://"+strings.TrimPrefix(reg.URL, "http://")+"/charts", nil, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = repo.DownloadChart(context.Background(), "helmchart", "0.1.0", "")
+	if err == nil {
+		t.Error("DownloadChart() without credentials succeeded")
+	}
+}
@@ -17,8 +17,11 @@ package helm
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io/ioutil"
+	"net"
+	"net/http"
 	"net/url"
 	"path"
 	"sort"
@@ -28,6 +31,7 @@ import (
 	"github.com/getupio-undistro/undistro/pkg/version"
 	"helm.sh/helm/v3/pkg/getter"
 	"helm.sh/helm/v3/pkg/repo"
+	corev1 "k8s.io/api/core/v1"
 	"sigs.k8s.io/yaml"
 )
 
@@ -169,12 +173,39 @@ func (r *ChartRepository) DownloadChart(chart *repo.ChartVersion) (*bytes.Buffer
 		u = repoURL.ResolveReference(u)
 		u.RawQuery = q.Encode()
 	} else if u.Host != "" {
-		u.Host = fmt.Sprintf("%s.", u.Host)
+		u.Host = fqdnHost(u)
 	}
 	r.Options = append(r.Options, getter.WithURL(u.String()))
 	return r.Client.Get(u.String(), r.Options...)
 }
 
+// DownloadChartWithCache returns the chart from the cache when its digest in the index was
+// already downloaded, or downloads it with DownloadChart and caches it when it matches the digest.
+// Charts without digest in the index are never cached.
+func (r *ChartRepository) DownloadChartWithCache(cache *Cache, chart *repo.ChartVersion) (*bytes.Buffer, error) {
+	if cache == nil || chart.Digest == "" {
+		return r.DownloadChart(chart)
+	}
+	key := chartCacheKey("sha256:" + chart.Digest)
+	if cached, ok := cache.get(key); ok {
+		cacheHits.WithLabelValues(cacheKindChart).Inc()
+		return bytes.NewBuffer(append([]byte(nil), cached.data...)), nil
+	}
+	cacheMisses.WithLabelValues(cacheKindChart).Inc()
+	res, err := r.DownloadChart(chart)
+	if err != nil {
+		return nil, err
+	}
+	// some repositories have wrong digests in their indexes, so their charts are used without caching
+	if sha256Digest(res.Bytes()) == "sha256:"+chart.Digest {
+		cache.set(cacheEntry{
+			key:  key,
+			data: append([]byte(nil), res.Bytes()...),
+		})
+	}
+	return res, nil
+}
+
 // LoadIndex loads the given bytes into the Index while performing
 // minimal validity checks. It fails if the API version is not set
 // (repo.ErrNoAPIVersion), or if the unmarshal fails.
@@ -198,15 +229,12 @@ func (r *ChartRepository) LoadIndex(b []byte) error {
 // the Client and set Options, and loads the index file into the Index.
 // It returns an error on URL parsing and Client failures.
 func (r *ChartRepository) DownloadIndex() error {
-	u, err := url.Parse(r.URL)
+	u, err := r.indexURL()
 	if err != nil {
 		return err
 	}
-	u.Host = fmt.Sprintf("%s.", u.Host)
-	u.RawPath = path.Join(u.RawPath, "index.yaml")
-	u.Path = path.Join(u.Path, "index.yaml")
 
-	res, err := r.Client.Get(u.String(), r.Options...)
+	res, err := r.Client.Get(u, r.Options...)
 	if err != nil {
 		return err
 	}
@@ -217,3 +245,105 @@ func (r *ChartRepository) DownloadIndex() error {
 
 	return r.LoadIndex(b)
 }
+
+func (r *ChartRepository) indexURL() (string, error) {
+	u, err := url.Parse(r.URL)
+	if err != nil {
+		return "", err
+	}
+	u.Host = fqdnHost(u)
+	u.RawPath = path.Join(u.RawPath, "index.yaml")
+	u.Path = path.Join(u.Path, "index.yaml")
+	return u.String(), nil
+}
+
+// DownloadIndexWithCache loads the index from the cache while it's fresh. Stale indexes are
+// revalidated with the ETag or Last-Modified headers of the cached response, and downloaded
+// again only when they changed. The secret holds the repository credentials like in
+// ClientOptionsFromSecret. Without a cache it's the same as DownloadIndex.
+func (r *ChartRepository) DownloadIndexWithCache(ctx context.Context, cache *Cache, secret *corev1.Secret) error {
+	if cache == nil {
+		return r.DownloadIndex()
+	}
+	key := indexCacheKey(r.URL, secret)
+	cached, ok := cache.get(key)
+	if ok && cache.fresh(cached) {
+		cacheHits.WithLabelValues(cacheKindIndex).Inc()
+		return r.LoadIndex(cached.data)
+	}
+	u, err := r.indexURL()
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if secret != nil {
+		basicAuth, err := BasicAuthFromSecret(*secret)
+		if err != nil {
+			return err
+		}
+		if basicAuth != nil {
+			req.SetBasicAuth(string(secret.Data["username"]), string(secret.Data["password"]))
+		}
+		tlsConfig, err := TLSConfigFromSecret(*secret)
+		if err != nil {
+			return err
+		}
+		if tlsConfig != nil {
+			transport.TLSClientConfig = tlsConfig
+		}
+	}
+	if ok {
+		if cached.etag != "" {
+			req.Header.Set("If-None-Match", cached.etag)
+		}
+		if cached.lastModified != "" {
+			req.Header.Set("If-Modified-Since", cached.lastModified)
+		}
+	}
+	res, err := (&http.Client{Transport: transport}).Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	switch {
+	case res.StatusCode == http.StatusNotModified && ok:
+		cache.touch(key)
+		cacheHits.WithLabelValues(cacheKindIndex).Inc()
+		return r.LoadIndex(cached.data)
+	case res.StatusCode != http.StatusOK:
+		return fmt.Errorf("failed to fetch %s : %s", u, res.Status)
+	}
+	cacheMisses.WithLabelValues(cacheKindIndex).Inc()
+	b, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+	err = r.LoadIndex(b)
+	if err != nil {
+		return err
+	}
+	cache.set(cacheEntry{
+		key:          key,
+		data:         b,
+		etag:         res.Header.Get("ETag"),
+		lastModified: res.Header.Get("Last-Modified"),
+	})
+	return nil
+}
+
+// fqdnHost returns the host with a trailing dot, so it isn't resolved in the search domains.
+// IP addresses are returned as they are.
+func fqdnHost(u *url.URL) string {
+	host := u.Hostname()
+	if net.ParseIP(host) != nil {
+		return u.Host
+	}
+	if port := u.Port(); port != "" {
+		return net.JoinHostPort(host+".", port)
+	}
+	return host + "."
+}
@@ -0,0 +1,140 @@
+/*
+Copyright 2020-2021 The UnDistro authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kube
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"math"
+	"math/big"
+	"time"
+
+	"github.com/pkg/errors"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/clientcmd/api"
+	"sigs.k8s.io/cluster-api/util/certs"
+	"sigs.k8s.io/cluster-api/util/secret"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// clockSkew backdates the user certificates, so they are valid in API servers with clocks behind
+const clockSkew = 5 * time.Minute
+
+// NewUserKubeconfig returns a kubeconfig authenticating as the user and groups with a client
+// certificate signed by the cluster CA and valid for the ttl.
+// Clusters without the CA in the management cluster, like managed ones, are not supported.
+func NewUserKubeconfig(ctx context.Context, c client.Reader, cluster client.ObjectKey, user string, groups []string, ttl time.Duration) ([]byte, error) {
+	if user == "" {
+		return nil, errors.New("user is required")
+	}
+	if ttl <= 0 {
+		return nil, errors.New("ttl must be greater than 0")
+	}
+	ca, err := secret.GetFromNamespacedName(ctx, c, cluster, secret.ClusterCA)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, errors.Errorf("cluster %s has no CA to sign user certificates", cluster)
+		}
+		return nil, err
+	}
+	caCert, err := certs.DecodeCertPEM(ca.Data[secret.TLSCrtDataName])
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decode CA cert")
+	} else if caCert == nil {
+		return nil, errors.New("CA cert not found")
+	}
+	caKey, err := certs.DecodePrivateKeyPEM(ca.Data[secret.TLSKeyDataName])
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decode CA key")
+	} else if caKey == nil {
+		return nil, errors.New("CA key not found")
+	}
+	admin, err := GetInternalKubeconfig(ctx, c, cluster)
+	if err != nil {
+		return nil, err
+	}
+	adminCfg, err := clientcmd.Load(admin)
+	if err != nil {
+		return nil, err
+	}
+	clusterCfg, ok := adminCfg.Clusters[cluster.Name]
+	if !ok {
+		return nil, errors.Errorf("cluster %s not found in the admin kubeconfig", cluster.Name)
+	}
+	cfg, err := userKubeconfig(cluster.Name, clusterCfg.Server, caCert, caKey, user, groups, time.Now().Add(ttl))
+	if err != nil {
+		return nil, err
+	}
+	return clientcmd.Write(*cfg)
+}
+
+func userKubeconfig(clusterName, server string, caCert *x509.Certificate, caKey crypto.Signer, user string, groups []string, notAfter time.Time) (*api.Config, error) {
+	key, err := certs.NewPrivateKey()
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to create private key")
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).SetInt64(math.MaxInt64))
+	if err != nil {
+		return nil, err
+	}
+	tmpl := x509.Certificate{
+		Subject: pkix.Name{
+			CommonName:   user,
+			Organization: groups,
+		},
+		SerialNumber: serial,
+		NotBefore:    time.Now().Add(-clockSkew).UTC(),
+		NotAfter:     notAfter.UTC(),
+		KeyUsage:     x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	b, err := x509.CreateCertificate(rand.Reader, &tmpl, caCert, key.Public(), caKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to sign certificate")
+	}
+	cert, err := x509.ParseCertificate(b)
+	if err != nil {
+		return nil, err
+	}
+	contextName := fmt.Sprintf("%s@%s", user, clusterName)
+	return &api.Config{
+		Clusters: map[string]*api.Cluster{
+			clusterName: {
+				Server:                   server,
+				CertificateAuthorityData: certs.EncodeCertPEM(caCert),
+			},
+		},
+		Contexts: map[string]*api.Context{
+			contextName: {
+				Cluster:  clusterName,
+				AuthInfo: user,
+			},
+		},
+		AuthInfos: map[string]*api.AuthInfo{
+			user: {
+				ClientKeyData:         certs.EncodePrivateKeyPEM(key),
+				ClientCertificateData: certs.EncodeCertPEM(cert),
+			},
+		},
+		CurrentContext: contextName,
+	}, nil
+}
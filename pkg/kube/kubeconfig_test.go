@@ -0,0 +1,77 @@
+package kube
+
+import (
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"sort"
+	"testing"
+	"time"
+
+	"sigs.k8s.io/cluster-api/util/certs"
+)
+
+func TestUserKubeconfig(t *testing.T) {
+	caKey, err := certs.NewPrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	tmpl := x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "kubernetes"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	b, err := x509.CreateCertificate(rand.Reader, &tmpl, &tmpl, caKey.Public(), caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caCert, err := x509.ParseCertificate(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	notAfter := now.Add(time.Hour)
+	cfg, err := userKubeconfig("cool-cluster", "https://10.0.0.1:6443", caCert, caKey, "jane", []string{"developers", "viewers"}, notAfter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.CurrentContext != "jane@cool-cluster" {
+		t.Errorf("current context = %q, want jane@cool-cluster", cfg.CurrentContext)
+	}
+	if cfg.Clusters["cool-cluster"].Server != "https://10.0.0.1:6443" {
+		t.Errorf("server = %q, want https://10.0.0.1:6443", cfg.Clusters["cool-cluster"].Server)
+	}
+	user, ok := cfg.AuthInfos["jane"]
+	if !ok {
+		t.Fatal("user jane not found")
+	}
+	cert, err := certs.DecodeCertPEM(user.ClientCertificateData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cert.Subject.CommonName != "jane" {
+		t.Errorf("common name = %q, want jane", cert.Subject.CommonName)
+	}
+	groups := cert.Subject.Organization
+	sort.Strings(groups)
+	if len(groups) != 2 || groups[0] != "developers" || groups[1] != "viewers" {
+		t.Errorf("organization = %v, want [developers viewers]", groups)
+	}
+	if !cert.NotAfter.Equal(notAfter.UTC().Truncate(time.Second)) {
+		t.Errorf("not after = %v, want %v", cert.NotAfter, notAfter.UTC().Truncate(time.Second))
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(caCert)
+	_, err = cert.Verify(x509.VerifyOptions{
+		Roots:     pool,
+		KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	if err != nil {
+		t.Errorf("certificate not signed by the CA: %v", err)
+	}
+}
@@ -150,6 +150,24 @@ const (
 	// latest desired state.
 	RemediatedCondition string = "Remediated"
 
+	// DriftedCondition represents the fact that objects of the release were
+	// modified or deleted in the cluster.
+	DriftedCondition string = "Drifted"
+
+	// DriftDetectedReason represents the fact that drifted objects were found.
+	DriftDetectedReason string = "DriftDetected"
+
+	// DriftCorrectedReason represents the fact that the drifted objects were
+	// applied again.
+	DriftCorrectedReason string = "DriftCorrected"
+
+	// NoDriftReason represents the fact that the objects match the release.
+	NoDriftReason string = "NoDrift"
+
+	// DriftDetectionFailedReason represents the fact that the objects of the
+	// release couldn't be compared or corrected.
+	DriftDetectionFailedReason string = "DriftDetectionFailed"
+
 	ObjectsAppliedCondition     string = "ObjectApplied"
 	ObjectsAppliedSuccessReason string = "ObjectAppliedSuccess"
 	ObjectsApliedFailedReason   string = "ObjectAppliedFailed"
@@ -164,8 +182,38 @@ const (
 	CNIInstalledCondition         string = "CNIInstalled"
 	CNIInstalledSuccessReason     string = "CNIInstalledSuccess"
 	CNIInstalledFailedReason      string = "CNIInstalledFailed"
+	CNIProvidedByUserReason       string = "CNIProvidedByUser"
+	UpgradeInProgressCondition    string = "UpgradeInProgress"
+	NodesDrainingCondition        string = "NodesDraining"
+	DrainingNodesReason           string = "DrainingNodes"
+	NodesDrainedReason            string = "NodesDrained"
+	DrainNodesFailed              string = "DrainNodesFailed"
+	APIServerReachableCondition   string = "APIServerReachable"
+	NodesHealthyCondition         string = "NodesHealthy"
+	AddonsHealthyCondition        string = "AddonsHealthy"
+	HealthCheckSucceededReason    string = "HealthCheckSucceeded"
+	APIServerUnreachableReason    string = "APIServerUnreachable"
+	NodesNotReadyReason           string = "NodesNotReady"
+	AddonsNotReadyReason          string = "AddonsNotReady"
+	HealthCheckFailed             string = "HealthCheckFailed"
+	RemediatingNodesReason        string = "RemediatingNodes"
+	ReconcileHealthChecksFailed   string = "ReconcileHealthChecksFailed"
+	KubeconfigRotatedReason       string = "KubeconfigRotated"
+	ReconcileKubeconfigFailed     string = "ReconcileKubeconfigFailed"
+	BackupSucceededReason         string = "BackupSucceeded"
+	ReconcileBackupFailed         string = "ReconcileBackupFailed"
+	ReconcileAddonsFailed         string = "ReconcileAddonsFailed"
+	UpgradingControlPlaneReason   string = "UpgradingControlPlane"
+	UpgradingWorkerPoolReason     string = "UpgradingWorkerPool"
+	UpgradeCompletedReason        string = "UpgradeCompleted"
 	TemplateAppliedFailed         string = "TemplateAppliedFailed"
 	ReconcileNodesFailed          string = "ReconcileNodesFailed"
+	ReconcileVersionsFailed       string = "ReconcileVersionsFailed"
+	ReconcileAutoscalerFailed     string = "ReconcileAutoscalerFailed"
+	AutoscalingCondition          string = "Autoscaling"
+	AutoscalerReleasedReason      string = "AutoscalerReleased"
+	MixedWorkerPoolsReason        string = "MixedWorkerPools"
+	AutoscalingNotSupportedReason string = "AutoscalingNotSupported"
 	ReconcileNetworkFailed        string = "ReconcileNetworkFailed"
 	ReconcileLaunchTemplateFailed string = "ReconcileLaunchTemplateFailed"
 	GetClusterFailed              string = "GetClusterFailed"
@@ -23,8 +23,20 @@ const (
 	LabelUndistroMove        = "undistro.io/move"
 	LabelUndistroMoved       = "undistro.io/moved"
 	LabelUndistroInfra       = "node-role.undistro.io/infra"
+	LabelCapacityType        = "node.undistro.io/capacity-type"
 	LabelK8sMaster           = "node-role.kubernetes.io/master"
 	LabelK8sCP               = "node-role.kubernetes.io/control-plane"
 	CNIAnnotation            = "network.undistro.io/cni"
 	KyvernoAnnotation        = "security.undistro.io/kyverno"
+	// ManagedLabelsAnnotation lists the node labels set by UnDistro, they are removed when dropped from the cluster spec
+	ManagedLabelsAnnotation = "node.undistro.io/managed-labels"
+	// ManagedTaintsAnnotation lists the key:effect of the node taints set by UnDistro
+	ManagedTaintsAnnotation = "node.undistro.io/managed-taints"
+	// ProtectAnnotation set to "true" rejects the deletion of the object
+	ProtectAnnotation = "undistro.io/protect"
+	// AppliedProfileAnnotation holds the ClusterProfile spec last merged into the cluster,
+	// the fields still equal to it are replaced when the profile is merged again
+	AppliedProfileAnnotation = "undistro.io/applied-profile"
+	// LabelUndistroAddon is the name of the cluster addon installed by a HelmRelease
+	LabelUndistroAddon = "undistro.io/addon"
 )
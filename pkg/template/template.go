@@ -149,6 +149,33 @@ func (r *Render) YAML(w io.Writer, name string, binding interface{}) error {
 	return r.Render(w, h, binding)
 }
 
+// NewFromText constructs a Render with the template text, for templates kept
+// outside the binary like the ClusterTemplate ones.
+func NewFromText(name, text string) (*Render, error) {
+	r := Render{
+		opt: Options{
+			Funcs: []template.FuncMap{textFuncMap()},
+		},
+	}
+	r.prepareOptions()
+	r.templates = template.New(r.opt.Root)
+	tmpl := r.templates.New(name)
+	for _, funcs := range r.opt.Funcs {
+		tmpl = tmpl.Funcs(funcs)
+	}
+	_, err := tmpl.Parse(text)
+	return &r, err
+}
+
+// textFuncMap returns the sprig functions without the ones reading the
+// environment, as the template text is written by users
+func textFuncMap() template.FuncMap {
+	f := sprig.TxtFuncMap()
+	delete(f, "env")
+	delete(f, "expandenv")
+	return f
+}
+
 func GetObjs(fs fs.FS, dir, tplName string, vars map[string]interface{}) ([]unstructured.Unstructured, error) {
 	tpl, err := New(Options{
 		Root:       dir,
@@ -157,8 +184,21 @@ func GetObjs(fs fs.FS, dir, tplName string, vars map[string]interface{}) ([]unst
 	if err != nil {
 		return nil, err
 	}
+	return tpl.objs(tplName, vars)
+}
+
+// GetObjsFromText renders the objects of the template text like GetObjs
+func GetObjsFromText(tplName, text string, vars map[string]interface{}) ([]unstructured.Unstructured, error) {
+	tpl, err := NewFromText(tplName, text)
+	if err != nil {
+		return nil, err
+	}
+	return tpl.objs(tplName, vars)
+}
+
+func (r *Render) objs(tplName string, vars map[string]interface{}) ([]unstructured.Unstructured, error) {
 	buff := &bytes.Buffer{}
-	err = tpl.YAML(buff, tplName, vars)
+	err := r.YAML(buff, tplName, vars)
 	if err != nil {
 		return nil, err
 	}
@@ -134,3 +134,26 @@ func TestRace(t *testing.T) {
 	<-done
 	<-done
 }
+
+func TestGetObjsFromText(t *testing.T) {
+	g := NewWithT(t)
+	text := `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: {{.Name}}
+data:
+  upper: {{upper .Name}}`
+	objs, err := GetObjsFromText("custom", text, map[string]interface{}{"Name": "k8s"})
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(objs).To(HaveLen(1))
+	g.Expect(objs[0].GetName()).To(Equal("k8s"))
+	g.Expect(objs[0].Object["data"]).To(Equal(map[string]interface{}{"upper": "K8S"}))
+}
+
+func TestGetObjsFromTextEnv(t *testing.T) {
+	g := NewWithT(t)
+	for _, text := range []string{`home: {{ env "HOME" }}`, `home: {{ expandenv "$HOME" }}`} {
+		_, err := NewFromText("custom", text)
+		g.Expect(err).To(HaveOccurred(), text)
+	}
+}
@@ -18,13 +18,12 @@ package infra
 import (
 	"errors"
 
-	typesv1alpha1 "github.com/getupio-undistro/undistro/apis/app/v1alpha1"
-	"github.com/getupio-undistro/undistro/pkg/undistro/apiserver/provider/infra/aws"
+	"github.com/getupio-undistro/undistro/pkg/cloud"
 	"k8s.io/client-go/rest"
 )
 
 var ErrInvalidProviderName = errors.New("a valid infra provider name is required.\n" +
-	"supported are ['aws']")
+	"supported are ['aws', 'openstack', 'docker', 'vsphere']")
 
 type ProviderParams struct {
 	Name         string       `json:"name"`
@@ -47,13 +46,13 @@ func New(conf *rest.Config, name, region, meta string, page, itemsPerPage int) *
 }
 
 func (pr *ProviderParams) DescribeMetadata() (result interface{}, err error) {
-	switch pr.Name {
-	case typesv1alpha1.Amazon.String():
-		result, err = aws.DescribeMeta(pr.Config, pr.Region, pr.Meta, pr.Page, pr.ItemsPerPage)
-		if err != nil {
-			return nil, err
-		}
-		return
+	p, ok := cloud.Get(pr.Name)
+	if !ok {
+		return nil, ErrInvalidProviderName
 	}
-	return nil, ErrInvalidProviderName
+	result, err = p.DescribeMetadata(pr.Config, pr.Region, pr.Meta, pr.Page, pr.ItemsPerPage)
+	if err != nil {
+		return nil, err
+	}
+	return
 }
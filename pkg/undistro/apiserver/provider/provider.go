@@ -21,8 +21,8 @@ import (
 	"strconv"
 
 	configv1alpha1 "github.com/getupio-undistro/undistro/apis/config/v1alpha1"
+	"github.com/getupio-undistro/undistro/pkg/cloud/aws"
 	"github.com/getupio-undistro/undistro/pkg/undistro/apiserver/provider/infra"
-	"github.com/getupio-undistro/undistro/pkg/undistro/apiserver/provider/infra/aws"
 	"k8s.io/apimachinery/pkg/util/json"
 	"k8s.io/client-go/rest"
 )
@@ -24,8 +24,8 @@ import (
 
 	appv1alpha1 "github.com/getupio-undistro/undistro/apis/app/v1alpha1"
 	configv1alpha1 "github.com/getupio-undistro/undistro/apis/config/v1alpha1"
+	"github.com/getupio-undistro/undistro/pkg/cloud/aws"
 	"github.com/getupio-undistro/undistro/pkg/undistro/apiserver/provider/infra"
-	"github.com/getupio-undistro/undistro/pkg/undistro/apiserver/provider/infra/aws"
 	"github.com/gorilla/mux"
 	"k8s.io/apimachinery/pkg/util/json"
 )
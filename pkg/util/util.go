@@ -263,6 +263,66 @@ func RemoveDuplicateTaints(taints []corev1.Taint) []corev1.Taint {
 	return res
 }
 
+// TaintKey identifies a taint, nodes can't have two taints with the same key and effect
+func TaintKey(t corev1.Taint) string {
+	return fmt.Sprintf("%s:%s", t.Key, t.Effect)
+}
+
+// UpdateManagedLabels sets the desired labels and removes the ones managed before that aren't desired anymore.
+// Labels not managed are kept. It returns the keys of the labels managed now.
+func UpdateManagedLabels(labels map[string]string, managed []string, desired map[string]string) []string {
+	for _, k := range managed {
+		if _, ok := desired[k]; !ok {
+			delete(labels, k)
+		}
+	}
+	keys := make([]string, 0, len(desired))
+	for k, v := range desired {
+		labels[k] = v
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// UpdateManagedTaints sets the desired taints and removes the ones managed before that aren't desired anymore.
+// Taints not managed keep their order. It returns the taints and the keys of the taints managed now.
+func UpdateManagedTaints(taints []corev1.Taint, managed []string, desired []corev1.Taint) ([]corev1.Taint, []string) {
+	desiredByKey := make(map[string]corev1.Taint, len(desired))
+	keys := make([]string, 0, len(desired))
+	for _, t := range desired {
+		k := TaintKey(t)
+		if _, ok := desiredByKey[k]; !ok {
+			keys = append(keys, k)
+		}
+		desiredByKey[k] = t
+	}
+	res := make([]corev1.Taint, 0, len(taints)+len(desired))
+	set := make(map[string]bool)
+	for _, t := range taints {
+		k := TaintKey(t)
+		if d, ok := desiredByKey[k]; ok {
+			if !set[k] {
+				d.TimeAdded = t.TimeAdded
+				res = append(res, d)
+				set[k] = true
+			}
+			continue
+		}
+		if ContainsStringInSlice(managed, k) {
+			continue
+		}
+		res = append(res, t)
+	}
+	for _, k := range keys {
+		if !set[k] {
+			res = append(res, desiredByKey[k])
+		}
+	}
+	sort.Strings(keys)
+	return res, keys
+}
+
 func IsKindCluster(ctx context.Context, c client.Client) (bool, error) {
 	nodes := corev1.NodeList{}
 	err := c.List(ctx, &nodes)
@@ -341,3 +341,95 @@ func TestRemoveDuplicateTaints(t *testing.T) {
 		})
 	}
 }
+
+func TestUpdateManagedLabels(t *testing.T) {
+	labels := map[string]string{
+		"kubernetes.io/hostname": "node1",
+		"removed":                "true",
+		"updated":                "old",
+	}
+	got := UpdateManagedLabels(labels, []string{"removed", "updated"}, map[string]string{"updated": "new", "added": "true"})
+	want := map[string]string{
+		"kubernetes.io/hostname": "node1",
+		"updated":                "new",
+		"added":                  "true",
+	}
+	if !reflect.DeepEqual(labels, want) {
+		t.Errorf("UpdateManagedLabels() labels = %v, want %v", labels, want)
+	}
+	if !reflect.DeepEqual(got, []string{"added", "updated"}) {
+		t.Errorf("UpdateManagedLabels() = %v, want [added updated]", got)
+	}
+}
+
+func TestUpdateManagedTaints(t *testing.T) {
+	type args struct {
+		taints  []corev1.Taint
+		managed []string
+		desired []corev1.Taint
+	}
+	tests := []struct {
+		name     string
+		args     args
+		want     []corev1.Taint
+		wantKeys []string
+	}{
+		{
+			name: "taint changed",
+			args: args{
+				taints: []corev1.Taint{
+					{Key: "node.kubernetes.io/unreachable", Effect: corev1.TaintEffectNoExecute},
+					{Key: "dedicated", Value: "infra", Effect: corev1.TaintEffectNoSchedule},
+				},
+				managed: []string{"dedicated:NoSchedule"},
+				desired: []corev1.Taint{
+					{Key: "dedicated", Value: "gpu", Effect: corev1.TaintEffectNoExecute},
+				},
+			},
+			want: []corev1.Taint{
+				{Key: "node.kubernetes.io/unreachable", Effect: corev1.TaintEffectNoExecute},
+				{Key: "dedicated", Value: "gpu", Effect: corev1.TaintEffectNoExecute},
+			},
+			wantKeys: []string{"dedicated:NoExecute"},
+		},
+		{
+			name: "value updated in place",
+			args: args{
+				taints: []corev1.Taint{
+					{Key: "dedicated", Value: "infra", Effect: corev1.TaintEffectNoSchedule},
+					{Key: "test", Value: "test", Effect: corev1.TaintEffectNoSchedule},
+				},
+				desired: []corev1.Taint{
+					{Key: "dedicated", Value: "gpu", Effect: corev1.TaintEffectNoSchedule},
+				},
+			},
+			want: []corev1.Taint{
+				{Key: "dedicated", Value: "gpu", Effect: corev1.TaintEffectNoSchedule},
+				{Key: "test", Value: "test", Effect: corev1.TaintEffectNoSchedule},
+			},
+			wantKeys: []string{"dedicated:NoSchedule"},
+		},
+		{
+			name: "all removed",
+			args: args{
+				taints: []corev1.Taint{
+					{Key: "dedicated", Value: "infra", Effect: corev1.TaintEffectNoSchedule},
+				},
+				managed: []string{"dedicated:NoSchedule"},
+			},
+			want:     []corev1.Taint{},
+			wantKeys: []string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, keys := UpdateManagedTaints(tt.args.taints, tt.args.managed, tt.args.desired)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("UpdateManagedTaints() = %v, want %v", got, tt.want)
+			}
+			if !reflect.DeepEqual(keys, tt.wantKeys) {
+				t.Errorf("UpdateManagedTaints() keys = %v, want %v", keys, tt.wantKeys)
+			}
+		})
+	}
+}